@@ -0,0 +1,132 @@
+package gofpdi
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The appearance streams of an imported annotation are imported with their resources
+func TestImportAnnotationAppearance(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+	objs[10] = strings.Replace(objs[10], "/Contents", "/Annots [20 0 R] /Contents", 1)
+	objs[20] = "<< /Type /Annot /Subtype /Stamp /Rect [100 100 200 150] /AP << /N 21 0 R /D 22 0 R /R 23 0 R >> >>"
+	objs[21] = pdfStream("/Type /XObject /Subtype /Form /BBox [0 0 100 50] /Resources << /Font << /F2 24 0 R >> >>", "BT /F2 10 Tf (Signed normal) Tj ET")
+	objs[22] = pdfStream("/Type /XObject /Subtype /Form /BBox [0 0 100 50]", "0 0 1 rg 0 0 100 50 re f % Signed down")
+	objs[23] = pdfStream("/Type /XObject /Subtype /Form /BBox [0 0 100 50]", "1 0 0 rg 0 0 100 50 re f % Signed rollover")
+	objs[24] = "<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>"
+
+	importer := newTestImporter(t, buildPdf(objs))
+	importer.SetImportAnnotations(true)
+	tplid := importer.ImportPage(1, "/MediaBox")
+
+	_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	annots, err := importer.GetTemplateAnnotations(tplid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annots) != 1 {
+		t.Fatalf("got %d annotations, want 1", len(annots))
+	}
+	annot, ok := objects[annots[0]]
+	if !ok {
+		t.Fatalf("annotation %d was not put", annots[0])
+	}
+
+	// Each appearance references the imported appearance stream
+	for key, content := range map[string]string{"/N": "(Signed normal)", "/D": "Signed down", "/R": "Signed rollover"} {
+		m := regexp.MustCompile(key + ` (\d+) 0 R`).FindSubmatch(annot)
+		if m == nil {
+			t.Errorf("annotation %q has no appearance %s", annot, key)
+			continue
+		}
+		id, _ := strconv.Atoi(string(m[1]))
+		if appearance, ok := objects[id]; !ok {
+			t.Errorf("appearance %s references object %d, which was not put", key, id)
+		} else if !strings.Contains(string(appearance), content) {
+			t.Errorf("appearance %s is %q, want %s", key, appearance, content)
+		}
+	}
+
+	// The font of the normal appearance is imported too
+	findObject(t, objects, "/BaseFont /Courier")
+}
+
+// The /Rect and /QuadPoints of imported annotations are rotated like the page, and placed like the
+// template
+func TestTransformedAnnotationRect(t *testing.T) {
+	rectRegexp := regexp.MustCompile(`/Rect \[([^\]]*)\]`)
+	quadRegexp := regexp.MustCompile(`/QuadPoints \[([^\]]*)\]`)
+
+	tests := []struct {
+		name      string
+		rotate    int
+		placement *[6]float64
+		rect      []float64
+		quad      []float64
+	}{
+		{"unrotated", 0, nil, []float64{100, 200, 300, 250}, []float64{100, 250, 300, 250, 100, 200, 300, 200}},
+		{"rotated", 90, nil, []float64{200, 300, 250, 500}, []float64{250, 500, 250, 300, 200, 500, 200, 300}},
+		{"placed", 0, &[6]float64{0.5, 0, 0, 0.5, 10, 20}, []float64{60, 120, 160, 145}, []float64{60, 145, 160, 145, 60, 120, 160, 120}},
+		{"rotated and placed", 90, &[6]float64{0.5, 0, 0, 0.5, 10, 20}, []float64{110, 170, 135, 270}, []float64{135, 270, 135, 170, 110, 270, 110, 170}},
+	}
+
+	numbers := func(s []byte) []float64 {
+		fields := strings.Fields(string(s))
+		result := make([]float64, len(fields))
+		for i, field := range fields {
+			result[i], _ = strconv.ParseFloat(field, 64)
+		}
+		return result
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", "/MediaBox [0 0 600 800] /Rotate "+strconv.Itoa(test.rotate)+" /Annots [20 0 R]", 1)
+			objs[20] = "<< /Type /Annot /Subtype /Highlight /Rect [100 200 300 250] /QuadPoints [100 250 300 250 100 200 300 200] >>"
+
+			importer := newTestImporter(t, buildPdf(objs))
+			importer.SetImportAnnotations(true)
+			tplid := importer.ImportPage(1, "/MediaBox")
+			if test.placement != nil {
+				if err := importer.SetTemplatePlacement(tplid, *test.placement); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, annot := findObject(t, objects, "/Highlight")
+
+			for _, check := range []struct {
+				re   *regexp.Regexp
+				want []float64
+			}{{rectRegexp, test.rect}, {quadRegexp, test.quad}} {
+				m := check.re.FindSubmatch(annot)
+				if m == nil {
+					t.Errorf("annotation %q has no %s", annot, check.re)
+					continue
+				}
+				got := numbers(m[1])
+				if len(got) != len(check.want) {
+					t.Errorf("got %s, want %v", m[0], check.want)
+					continue
+				}
+				for i := range got {
+					if math.Abs(got[i]-check.want[i]) > 0.01 {
+						t.Errorf("got %s, want %v", m[0], check.want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
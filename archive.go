@@ -0,0 +1,92 @@
+package gofpdi
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Import a page of each pdf file (by .pdf extension) in a zip archive, in the order of the archive,
+// e.g. to merge single page pdfs.  Returns the template ids.  Each pdf is read into memory and set as
+// the source, so that its other pages can also be imported while it is the source.  Because each pdf
+// is a separate source, write the templates with PutAllFormXobjectsWithIds, which writes the
+// templates of all sources; PutFormXobjects only writes those of the last pdf.
+func (this *Importer) ImportPagesFromZip(zr *zip.Reader, pageno int, box string) ([]int, error) {
+	tplids := make([]int, 0)
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isPdfName(f.Name) {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to open "+f.Name)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read "+f.Name)
+		}
+
+		tplid, err := this.importPageFromData(fmt.Sprintf("%p/%s", zr, f.Name), data, pageno, box)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to import page from "+f.Name)
+		}
+		tplids = append(tplids, tplid)
+	}
+
+	return tplids, nil
+}
+
+// Like ImportPagesFromZip, for a tar archive
+func (this *Importer) ImportPagesFromTar(tr *tar.Reader, pageno int, box string) ([]int, error) {
+	tplids := make([]int, 0)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read tar archive")
+		}
+		if !hdr.FileInfo().Mode().IsRegular() || !isPdfName(hdr.Name) {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read "+hdr.Name)
+		}
+
+		tplid, err := this.importPageFromData(fmt.Sprintf("%p/%s", tr, hdr.Name), data, pageno, box)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to import page from "+hdr.Name)
+		}
+		tplids = append(tplids, tplid)
+	}
+
+	return tplids, nil
+}
+
+// Set a pdf in memory as the source and import a page from it
+func (this *Importer) importPageFromData(name string, data []byte, pageno int, box string) (int, error) {
+	if err := this.setSourceStream(name, bytes.NewReader(data)); err != nil {
+		return -1, err
+	}
+
+	return this.importPage(pageno, box, "")
+}
+
+// Check if an archive entry is a pdf by its extension
+func isPdfName(name string) bool {
+	return strings.ToLower(path.Ext(name)) == ".pdf"
+}
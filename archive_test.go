@@ -0,0 +1,95 @@
+package gofpdi
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// Create a zip and a tar archive with a single page pdf for each content stream, and a file that is
+// not a pdf
+func buildArchives(t *testing.T, contents ...string) (*zip.Reader, *tar.Reader) {
+	var zbuf, tbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	tw := tar.NewWriter(&tbuf)
+
+	files := map[string][]byte{"readme.txt": []byte("not a pdf")}
+	names := []string{"readme.txt"}
+	for i, content := range contents {
+		name := fmt.Sprintf("page%d.pdf", i)
+		files[name] = buildPdf(pagesPdf(content))
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(files[name])
+
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name]))})
+		tw.Write(files[name])
+	}
+	zw.Close()
+	tw.Close()
+
+	zr, err := zip.NewReader(bytes.NewReader(zbuf.Bytes()), int64(zbuf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return zr, tar.NewReader(&tbuf)
+}
+
+func TestImportPagesFromArchive(t *testing.T) {
+	contents := []string{"BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET", "BT /F1 12 Tf (three) Tj ET"}
+
+	tests := []struct {
+		name     string
+		importFn func(importer *Importer, zr *zip.Reader, tr *tar.Reader) ([]int, error)
+	}{
+		{"zip", func(importer *Importer, zr *zip.Reader, tr *tar.Reader) ([]int, error) {
+			return importer.ImportPagesFromZip(zr, 1, "/MediaBox")
+		}},
+		{"tar", func(importer *Importer, zr *zip.Reader, tr *tar.Reader) ([]int, error) {
+			return importer.ImportPagesFromTar(tr, 1, "/MediaBox")
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zr, tr := buildArchives(t, contents...)
+			importer := NewImporter()
+
+			tplids, err := test.importFn(importer, zr, tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tplids) != len(contents) {
+				t.Fatalf("got %d templates, want %d", len(tplids), len(contents))
+			}
+
+			n := 0
+			templates, objects, err := importer.PutAllFormXobjectsWithIds(func() int { n++; return n })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Each pdf has a form xobject and a font
+			if len(templates) != len(contents) {
+				t.Errorf("got %d form xobjects, want %d: %v", len(templates), len(contents), templates)
+			}
+			for _, tplid := range tplids {
+				if _, ok := templates[fmt.Sprintf("/GOFPDITPL%d", tplid)]; !ok {
+					t.Errorf("template %d was not written: %v", tplid, templates)
+				}
+			}
+			if len(objects) != 2*len(contents) {
+				t.Errorf("got %d objects, want %d", len(objects), 2*len(contents))
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package gofpdi
+
+import (
+	"github.com/pkg/errors"
+)
+
+// A file embedded in a pdf (e.g. the XML of a ZUGFeRD/Factur-X invoice)
+type Attachment struct {
+	Name     string // File name
+	Size     int    // Size of the decoded file in bytes
+	MimeType string // MIME type from the /Subtype of the embedded file stream (e.g. text/xml), if set
+	Data     []byte // Decoded contents of the file
+}
+
+// Get the files embedded in the document via /Names /EmbeddedFiles
+func (this *PdfReader) getAttachments() ([]Attachment, error) {
+	attachments := make([]Attachment, 0)
+
+	if this.catalog == nil || this.catalog.Value == nil {
+		return attachments, nil
+	}
+
+	names, ok := this.catalog.Value.Dictionary["/Names"]
+	if !ok {
+		return attachments, nil
+	}
+
+	names, err := this.resolveValue(names)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve names object")
+	}
+
+	tree, ok := names.Dictionary["/EmbeddedFiles"]
+	if !ok {
+		return attachments, nil
+	}
+
+	entries := make([]*PdfValue, 0)
+	if err = this.readNameTree(tree, &entries, 0); err != nil {
+		return nil, errors.Wrap(err, "Failed to read embedded files name tree")
+	}
+
+	// The name tree has a key followed by a value (the file specification) for each file
+	for i := 0; i+1 < len(entries); i += 2 {
+		attachment, err := this.getAttachment(entries[i], entries[i+1])
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to get attachment")
+		}
+		if attachment != nil {
+			attachments = append(attachments, *attachment)
+		}
+	}
+
+	return attachments, nil
+}
+
+// Collect the key/value pairs of a name tree node and its kids
+func (this *PdfReader) readNameTree(node *PdfValue, entries *[]*PdfValue, depth int) error {
+	return this.readTree(node, "/Names", entries, depth)
+}
+
+// Collect the key/value pairs of a number tree node and its kids
+func (this *PdfReader) readNumberTree(node *PdfValue, entries *[]*PdfValue, depth int) error {
+	return this.readTree(node, "/Nums", entries, depth)
+}
+
+// Collect the key/value pairs of a name or number tree node and its kids.  key is the entry that
+// holds the pairs (/Names or /Nums).
+func (this *PdfReader) readTree(node *PdfValue, key string, entries *[]*PdfValue, depth int) error {
+	// Guard against circular references in malformed documents
+	if depth > 32 {
+		return errors.New("Name tree is too deep")
+	}
+
+	node, err := this.resolveValue(node)
+	if err != nil {
+		return errors.Wrap(err, "Failed to resolve name tree node")
+	}
+
+	if names, ok := node.Dictionary[key]; ok {
+		names, err = this.resolveValue(names)
+		if err != nil {
+			return errors.Wrap(err, "Failed to resolve name tree names")
+		}
+		*entries = append(*entries, names.Array...)
+	}
+
+	if kids, ok := node.Dictionary["/Kids"]; ok {
+		kids, err = this.resolveValue(kids)
+		if err != nil {
+			return errors.Wrap(err, "Failed to resolve name tree kids")
+		}
+		for _, kid := range kids.Array {
+			if err = this.readTree(kid, key, entries, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Create an attachment from a name tree key and file specification.
+// Returns nil if the file specification has no embedded file.
+func (this *PdfReader) getAttachment(key *PdfValue, spec *PdfValue) (*Attachment, error) {
+	spec, err := this.resolveValue(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve file specification")
+	}
+
+	ef, ok := spec.Dictionary["/EF"]
+	if !ok {
+		return nil, nil
+	}
+
+	ef, err = this.resolveValue(ef)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve embedded file dictionary")
+	}
+
+	file, ok := ef.Dictionary["/F"]
+	if !ok {
+		if file, ok = ef.Dictionary["/UF"]; !ok {
+			return nil, nil
+		}
+	}
+
+	file, err = this.resolveValue(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve embedded file stream")
+	}
+
+	if file.Type != PDF_TYPE_STREAM {
+		return nil, errors.New("Embedded file is not a stream")
+	}
+
+	data, err := this.rebuildContentStream(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode embedded file stream")
+	}
+
+	attachment := &Attachment{Size: len(data), Data: data}
+
+	// Prefer the unicode file name, then the file name, then the name tree key
+	if name, ok := spec.Dictionary["/UF"]; ok {
+		attachment.Name = decode_pdf_string(name)
+	} else if name, ok := spec.Dictionary["/F"]; ok {
+		attachment.Name = decode_pdf_string(name)
+	} else {
+		attachment.Name = decode_pdf_string(key)
+	}
+
+	if subtype, ok := file.Value.Dictionary["/Subtype"]; ok {
+		attachment.MimeType = decode_pdf_name(subtype.Token)
+	}
+
+	return attachment, nil
+}
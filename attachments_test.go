@@ -0,0 +1,132 @@
+package gofpdi
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+)
+
+const invoiceXml = `<?xml version="1.0" encoding="UTF-8"?>
+<rsm:CrossIndustryInvoice xmlns:rsm="urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100" xmlns:ram="urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100">
+<rsm:ExchangedDocumentContext><ram:GuidelineSpecifiedDocumentContextParameter><ram:ID>urn:cen.eu:en16931:2017</ram:ID></ram:GuidelineSpecifiedDocumentContextParameter></rsm:ExchangedDocumentContext>
+</rsm:CrossIndustryInvoice>`
+
+// Objects of a one page pdf with an embedded file named name, whose embedded file stream object is
+// stream (see pdfStream)
+func attachmentPdf(name string, stream string) map[int]string {
+	objs := pagesPdf("BT ET")
+	objs[1] = "<< /Type /Catalog /Pages 2 0 R /Names 5 0 R >>"
+	objs[5] = fmt.Sprintf("<< /EmbeddedFiles << /Names [(%s) 6 0 R] >> >>", name)
+	objs[6] = fmt.Sprintf("<< /Type /Filespec /F (%s) /UF (%s) /EF << /F 7 0 R >> >>", name, name)
+	objs[7] = stream
+	return objs
+}
+
+func TestGetAttachments(t *testing.T) {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write([]byte(invoiceXml))
+	w.Close()
+
+	tests := []struct {
+		name string
+		objs map[int]string
+		want []Attachment
+	}{
+		{
+			"xml",
+			attachmentPdf("factur-x.xml", pdfStream("/Type /EmbeddedFile /Subtype /text#2Fxml", invoiceXml)),
+			[]Attachment{{"factur-x.xml", len(invoiceXml), "text/xml", []byte(invoiceXml)}},
+		},
+		{
+			"compressed",
+			attachmentPdf("factur-x.xml", fmt.Sprintf("<< /Type /EmbeddedFile /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", compressed.Len(), compressed.Bytes())),
+			[]Attachment{{"factur-x.xml", len(invoiceXml), "", []byte(invoiceXml)}},
+		},
+		{
+			"name tree kids",
+			func() map[int]string {
+				objs := attachmentPdf("factur-x.xml", pdfStream("/Type /EmbeddedFile", invoiceXml))
+				objs[5] = "<< /EmbeddedFiles << /Kids [8 0 R] >> >>"
+				objs[8] = "<< /Limits [(factur-x.xml) (factur-x.xml)] /Names [(factur-x.xml) 6 0 R] >>"
+				return objs
+			}(),
+			[]Attachment{{"factur-x.xml", len(invoiceXml), "", []byte(invoiceXml)}},
+		},
+		{
+			"no embedded file",
+			func() map[int]string {
+				objs := attachmentPdf("factur-x.xml", pdfStream("/Type /EmbeddedFile", invoiceXml))
+				objs[6] = "<< /Type /Filespec /F (factur-x.xml) >>"
+				return objs
+			}(),
+			[]Attachment{},
+		},
+		{"no names", pagesPdf("BT ET"), []Attachment{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := newTestImporter(t, buildPdf(test.objs))
+
+			got, err := importer.GetAttachments()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d attachments, want %d", len(got), len(test.want))
+			}
+			for i, want := range test.want {
+				if got[i].Name != want.Name || got[i].Size != want.Size || got[i].MimeType != want.MimeType || !bytes.Equal(got[i].Data, want.Data) {
+					t.Errorf("got attachment %s (%d bytes, %q), want %s (%d bytes, %q)", got[i].Name, got[i].Size, got[i].MimeType, want.Name, want.Size, want.MimeType)
+				}
+			}
+		})
+	}
+}
+
+func TestGetFacturXXML(t *testing.T) {
+	guideline := func(id string) string {
+		return `<rsm:CrossIndustryInvoice><rsm:ExchangedDocumentContext><ram:GuidelineSpecifiedDocumentContextParameter><ram:ID>` + id + `</ram:ID></ram:GuidelineSpecifiedDocumentContextParameter></rsm:ExchangedDocumentContext></rsm:CrossIndustryInvoice>`
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		xml     string
+		profile string
+		fails   bool
+	}{
+		{"factur-x", "factur-x.xml", invoiceXml, "EN 16931", false},
+		{"factur-x basic wl", "factur-x.xml", guideline("urn:factur-x.eu:1p0:basicwl"), "BASIC WL", false},
+		{"factur-x basic", "factur-x.xml", guideline("urn:factur-x.eu:1p0:basic"), "BASIC", false},
+		{"zugferd", "ZUGFeRD-invoice.xml", guideline("urn:ferd:CrossIndustryDocument:invoice:1p0:comfort"), "COMFORT", false},
+		{"xrechnung", "xrechnung.xml", guideline("urn:cen.eu:en16931:2017#compliant#urn:xoev-de:kosit:standard:xrechnung_2.0"), "XRECHNUNG", false},
+		{"unknown profile", "factur-x.xml", guideline("urn:example:invoice"), "", false},
+		{"other attachment", "invoice.xml", invoiceXml, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := newTestImporter(t, buildPdf(attachmentPdf(test.file, pdfStream("/Type /EmbeddedFile /Subtype /text#2Fxml", test.xml))))
+
+			xml, profile, err := importer.GetFacturXXML()
+			if test.fails {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(xml) != test.xml {
+				t.Errorf("got xml %q, want %q", xml, test.xml)
+			}
+			if profile != test.profile {
+				t.Errorf("got profile %q, want %q", profile, test.profile)
+			}
+		})
+	}
+}
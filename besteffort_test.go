@@ -0,0 +1,85 @@
+package gofpdi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// In best effort mode, a page with a recoverable defect is imported with a warning
+func TestBestEffort(t *testing.T) {
+	tests := []struct {
+		name    string
+		pdf     func(objs map[int]string) []byte
+		content string // Content of the template in best effort mode
+		warning string
+	}{
+		{"missing box", func(objs map[int]string) []byte {
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792] ", "", 1)
+			return buildPdf(objs)
+		}, "(one)", "Page 1: Box not found: /MediaBox"},
+		{"unsupported filter", func(objs map[int]string) []byte {
+			objs[11] = pdfStream("/Filter /UnknownDecode", "BT /F1 12 Tf (one) Tj ET")
+			return buildPdf(objs)
+		}, "", "Page 1: Failed to get content"},
+		{"unresolvable font", func(objs map[int]string) []byte {
+			// The xref entry of the font points to another object
+			return bytes.Replace(buildPdf(objs), []byte("\n3 0 obj"), []byte("\n9 0 obj"), 1)
+		}, "(one)", "Unable to resolve object 3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			data := test.pdf(objs)
+
+			// Without best effort mode, the import fails
+			importer := newTestImporter(t, data)
+			_, err := importer.ImportPages([]int{1}, "/MediaBox")
+			if err == nil {
+				_, _, err = importer.PutFormXobjectsWithIds(idCounter(100))
+			}
+			if err == nil {
+				t.Error("expected an error without best effort mode")
+			}
+
+			importer = NewImporter()
+			importer.SetBestEffort(true)
+			if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			tplids, err := importer.ImportPages([]int{1}, "/MediaBox")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w, h := templateSize(t, importer, tplids[0]); w != 612 || h != 792 {
+				t.Errorf("got template %.0f x %.0f, want 612 x 792", w, h)
+			}
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, _, _, _, _ := importer.UseTemplate(tplids[0], 0, 0, 0, 0)
+			if content := string(inflate(t, objects[templates[name]])); !strings.Contains(content, test.content) {
+				t.Errorf("got content %q, want %s", content, test.content)
+			}
+
+			found := false
+			for _, warning := range importer.GetWarnings() {
+				found = found || strings.HasPrefix(warning, test.warning)
+			}
+			if !found {
+				t.Errorf("got warnings %q, want %s", importer.GetWarnings(), test.warning)
+			}
+		})
+	}
+
+	// A document without a root is still an error
+	objs := pagesPdf("BT ET")
+	delete(objs, 1)
+	importer := NewImporter()
+	importer.SetBestEffort(true)
+	if err := importer.setSourceStream("test.pdf", bytes.NewReader(buildPdf(objs))); err == nil {
+		t.Error("no root: expected an error")
+	}
+}
@@ -0,0 +1,598 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Import the /CropBox of a page, which is offset from the origin of the /MediaBox
+func TestOffsetBox(t *testing.T) {
+	bboxRegexp := regexp.MustCompile(`/BBox \[([^\]]*)\]`)
+	matrixRegexp := regexp.MustCompile(`/Matrix \[([^\]]*)\]`)
+
+	tests := []struct {
+		name   string
+		page   string
+		w, h   float64
+		bbox   string
+		matrix string
+	}{
+		{"crop box", "/MediaBox [0 0 612 792] /CropBox [100 200 400 600]", 300, 400, "100.00 200.00 400.00 600.00", "1.00000 0.00000 0.00000 1.00000 -100.00000 -200.00000"},
+		{"reversed crop box", "/MediaBox [0 0 612 792] /CropBox [400 600 100 200]", 300, 400, "100.00 200.00 400.00 600.00", "1.00000 0.00000 0.00000 1.00000 -100.00000 -200.00000"},
+		{"rotated crop box", "/MediaBox [0 0 612 792] /CropBox [100 200 400 600] /Rotate 90", 400, 300, "100.00 200.00 400.00 600.00", "0.00000 -1.00000 1.00000 0.00000 -200.00000 400.00000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", test.page, 1)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			tplid := importer.ImportPage(1, "/CropBox")
+			sizes := importer.GetPageSizes()
+			if w, h := sizes[1]["/CropBox"]["w"], sizes[1]["/CropBox"]["h"]; w != 300 || h != 400 {
+				t.Errorf("got /CropBox %.0f x %.0f, want 300 x 400", w, h)
+			}
+
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w, h := templateSize(t, importer, tplid); w != test.w || h != test.h {
+				t.Errorf("got template %.0f x %.0f, want %.0f x %.0f", w, h, test.w, test.h)
+			}
+
+			name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 0, 0)
+
+			// The /BBox clips the content to the box in page coordinates, and the /Matrix moves the
+			// lower left corner of the box to the origin
+			form := objects[templates[name]]
+			if m := bboxRegexp.FindSubmatch(form); m == nil || string(m[1]) != test.bbox {
+				t.Errorf("got %s, want /BBox [%s]", bboxRegexp.Find(form), test.bbox)
+			}
+			if m := matrixRegexp.FindSubmatch(form); (m == nil && test.matrix != "") || (m != nil && string(m[1]) != test.matrix) {
+				t.Errorf("got %s, want /Matrix [%s]", matrixRegexp.Find(form), test.matrix)
+			}
+		})
+	}
+}
+
+// A page box with fewer than four values is an error that names the box
+func TestShortPageBox(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{"media box", "/MediaBox [0 0 612]", "Page box /MediaBox has 3 values, expected 4"},
+		{"crop box", "/MediaBox [0 0 612 792] /CropBox [0 0]", "Page box /CropBox has 2 values, expected 4"},
+		{"empty", "/MediaBox []", "Page box /MediaBox has 0 values, expected 4"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", test.page, 1)
+
+			reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildPdf(objs)))
+			if err == nil {
+				_, err = reader.getPageBoxes(1, 1)
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %s", err, test.want)
+			}
+		})
+	}
+}
+
+// Only the available boxes are resolved
+func TestSetAvailableBoxes(t *testing.T) {
+	objs := pagesPdf("BT ET")
+	objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", "/MediaBox 30 0 R /CropBox 31 0 R /BleedBox 32 0 R /TrimBox 33 0 R /ArtBox 34 0 R", 1)
+	for id := 30; id <= 34; id++ {
+		objs[id] = "[0 0 612 792]"
+	}
+	data := buildPdf(objs)
+
+	tests := []struct {
+		name  string
+		boxes []string
+		want  []string
+	}{
+		{"default", nil, []string{"/MediaBox", "/CropBox", "/BleedBox", "/TrimBox", "/ArtBox"}},
+		{"media box", []string{"/MediaBox"}, []string{"/MediaBox"}},
+		{"trim box", []string{"/TrimBox", "/MediaBox"}, []string{"/TrimBox", "/MediaBox"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved := make(map[int]bool, 0)
+			importer := NewImporter()
+			importer.SetTraceFunc(func(event string, args ...interface{}) {
+				if event == "object" {
+					resolved[args[0].(int)] = true
+				}
+			})
+			if test.boxes != nil {
+				importer.SetAvailableBoxes(test.boxes)
+			}
+			if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+
+			sizes := importer.GetPageSizes()[1]
+			if len(sizes) != len(test.want) {
+				t.Errorf("got %d boxes, want %d", len(sizes), len(test.want))
+			}
+			for _, box := range test.want {
+				if sizes[box]["w"] != 612 || sizes[box]["h"] != 792 {
+					t.Errorf("got %s %v, want 612 x 792", box, sizes[box])
+				}
+			}
+
+			// A box that is not available is not resolved
+			for i, box := range []string{"/MediaBox", "/CropBox", "/BleedBox", "/TrimBox", "/ArtBox"} {
+				if _, ok := sizes[box]; resolved[30+i] != ok {
+					t.Errorf("%s is resolved: %v, want %v", box, resolved[30+i], ok)
+				}
+			}
+		})
+	}
+}
+
+// A box that the page does not have falls back to the /CropBox, and the /CropBox to the /MediaBox
+func TestArtBoxFallback(t *testing.T) {
+	for _, box := range []string{"/ArtBox", "/BleedBox", "/TrimBox", "/CropBox", "/MediaBox"} {
+		t.Run(box, func(t *testing.T) {
+			importer := newTestImporter(t, buildPdf(pagesPdf("BT ET")))
+
+			tplids, err := importer.ImportPages([]int{1}, box)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w, h := templateSize(t, importer, tplids[0]); w != 612 || h != 792 {
+				t.Errorf("got template %.0f x %.0f, want 612 x 792", w, h)
+			}
+		})
+	}
+}
+
+// Each box falls back along the chain of the pdf spec: /BleedBox, /TrimBox and /ArtBox default to
+// the /CropBox, which defaults to the /MediaBox
+func TestBoxFallbackChain(t *testing.T) {
+	// Each box has a different width, so that the box that is used can be told apart
+	defined := map[string]string{
+		"/CropBox":  "/CropBox [0 0 500 792]",
+		"/BleedBox": "/BleedBox [0 0 400 792]",
+		"/TrimBox":  "/TrimBox [0 0 300 792]",
+		"/ArtBox":   "/ArtBox [0 0 200 792]",
+	}
+	widths := map[string]float64{"/MediaBox": 612, "/CropBox": 500, "/BleedBox": 400, "/TrimBox": 300, "/ArtBox": 200}
+
+	tests := []struct {
+		name  string
+		boxes []string          // The boxes of the page besides the /MediaBox
+		want  map[string]string // The box used for each box
+	}{
+		{"media box", nil, map[string]string{"/MediaBox": "/MediaBox", "/CropBox": "/MediaBox", "/BleedBox": "/MediaBox", "/TrimBox": "/MediaBox", "/ArtBox": "/MediaBox"}},
+		{"crop box", []string{"/CropBox"}, map[string]string{"/MediaBox": "/MediaBox", "/CropBox": "/CropBox", "/BleedBox": "/CropBox", "/TrimBox": "/CropBox", "/ArtBox": "/CropBox"}},
+		{"trim box", []string{"/TrimBox"}, map[string]string{"/MediaBox": "/MediaBox", "/CropBox": "/MediaBox", "/BleedBox": "/MediaBox", "/TrimBox": "/TrimBox", "/ArtBox": "/MediaBox"}},
+		{"crop and bleed box", []string{"/CropBox", "/BleedBox"}, map[string]string{"/MediaBox": "/MediaBox", "/CropBox": "/CropBox", "/BleedBox": "/BleedBox", "/TrimBox": "/CropBox", "/ArtBox": "/CropBox"}},
+		{"bleed, trim and art box", []string{"/BleedBox", "/TrimBox", "/ArtBox"}, map[string]string{"/MediaBox": "/MediaBox", "/CropBox": "/MediaBox", "/BleedBox": "/BleedBox", "/TrimBox": "/TrimBox", "/ArtBox": "/ArtBox"}},
+		{"all boxes", []string{"/CropBox", "/BleedBox", "/TrimBox", "/ArtBox"}, map[string]string{"/MediaBox": "/MediaBox", "/CropBox": "/CropBox", "/BleedBox": "/BleedBox", "/TrimBox": "/TrimBox", "/ArtBox": "/ArtBox"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := "/MediaBox [0 0 612 792]"
+			for _, box := range test.boxes {
+				page += " " + defined[box]
+			}
+			objs := pagesPdf("BT ET")
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", page, 1)
+			data := buildPdf(objs)
+
+			sizes := newTestImporter(t, data).GetPageSizes()[1]
+			for box, want := range test.want {
+				if sizes[box]["w"] != widths[want] {
+					t.Errorf("GetPageSizes: %s is %.0f wide, want %s, which is %.0f wide", box, sizes[box]["w"], want, widths[want])
+				}
+
+				// A page is imported once by an importer, so each box is imported by a new importer
+				importer := newTestImporter(t, data)
+				tplids, err := importer.ImportPages([]int{1}, box)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if w, _ := templateSize(t, importer, tplids[0]); w != widths[want] {
+					t.Errorf("ImportPages: %s template is %.0f wide, want %s, which is %.0f wide", box, w, want, widths[want])
+				}
+			}
+		})
+	}
+}
+
+// A box inherited from the page tree may be an indirect reference, also through several levels
+func TestInheritedIndirectBox(t *testing.T) {
+	tests := []struct {
+		name string
+		objs func(objs map[int]string)
+	}{
+		{"parent", func(objs map[int]string) {
+			objs[2] = "<< /Type /Pages /Kids [10 0 R] /Count 1 /MediaBox 30 0 R >>"
+		}},
+		{"grandparent", func(objs map[int]string) {
+			objs[2] = "<< /Type /Pages /Kids [5 0 R] /Count 1 /MediaBox 30 0 R >>"
+			objs[5] = "<< /Type /Pages /Parent 2 0 R /Kids [10 0 R] /Count 1 >>"
+			objs[10] = strings.Replace(objs[10], "/Parent 2 0 R", "/Parent 5 0 R", 1)
+		}},
+		{"indirect values", func(objs map[int]string) {
+			objs[2] = "<< /Type /Pages /Kids [10 0 R] /Count 1 /MediaBox [0 0 31 0 R 32 0 R] >>"
+			objs[31] = "400"
+			objs[32] = "500"
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792] ", "", 1)
+			objs[30] = "[0 0 400 500]"
+			test.objs(objs)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			box := importer.GetPageSizes()[1]["/MediaBox"]
+			if box["w"] != 400 || box["h"] != 500 {
+				t.Errorf("got /MediaBox %v, want 400 x 500", box)
+			}
+
+			tplid := importer.ImportPage(1, "/MediaBox")
+			if w, h := templateSize(t, importer, tplid); w != 400 || h != 500 {
+				t.Errorf("got template %.0f x %.0f, want 400 x 500", w, h)
+			}
+		})
+	}
+}
+
+// The form /Matrix places the content of an offset crop box like a viewer displays the rotated page
+func TestRotatedOffsetBox(t *testing.T) {
+	matrixRegexp := regexp.MustCompile(`/Matrix \[([^\]]*)\]`)
+
+	// The crop box is 300 x 400 with its lower left corner at (100, 200)
+	const llx, lly, w, h = 100.0, 200.0, 300.0, 400.0
+
+	// Where a viewer displays a point at (u, v) from the lower left corner of the crop box, for a
+	// page turned clockwise by the rotation
+	display := map[int]func(u, v float64) (float64, float64){
+		0:   func(u, v float64) (float64, float64) { return u, v },
+		90:  func(u, v float64) (float64, float64) { return v, w - u },
+		180: func(u, v float64) (float64, float64) { return w - u, h - v },
+		270: func(u, v float64) (float64, float64) { return h - v, u },
+	}
+
+	for rotation, want := range display {
+		t.Run(strconv.Itoa(rotation), func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", fmt.Sprintf("/MediaBox [0 0 612 792] /CropBox [100 200 400 600] /Rotate %d", rotation), 1)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			tplid := importer.ImportPage(1, "/CropBox")
+			wantW, wantH := w, h
+			if rotation%180 != 0 {
+				wantW, wantH = h, w
+			}
+			if tw, th := templateSize(t, importer, tplid); tw != wantW || th != wantH {
+				t.Errorf("got template %.0f x %.0f, want %.0f x %.0f", tw, th, wantW, wantH)
+			}
+
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 0, 0)
+			m := matrixRegexp.FindSubmatch(objects[templates[name]])
+			if m == nil {
+				t.Fatal("the form has no /Matrix")
+			}
+			var a, b, c, d, e, f float64
+			if _, err := fmt.Sscan(string(m[1]), &a, &b, &c, &d, &e, &f); err != nil {
+				t.Fatal(err)
+			}
+
+			// The corners and a point inside the crop box
+			for _, p := range [][2]float64{{0, 0}, {w, 0}, {0, h}, {w, h}, {50, 100}} {
+				x, y := llx+p[0], lly+p[1]
+				gotX, gotY := a*x+c*y+e, b*x+d*y+f
+				wantX, wantY := want(p[0], p[1])
+				if math.Abs(gotX-wantX) > 0.001 || math.Abs(gotY-wantY) > 0.001 {
+					t.Errorf("point (%.0f, %.0f) is placed at (%.2f, %.2f), want (%.0f, %.0f)", x, y, gotX, gotY, wantX, wantY)
+				}
+			}
+		})
+	}
+}
+
+// GetPageBoxesRaw returns only the boxes that a page defines, while GetPageSizes substitutes the others
+func TestGetPageBoxesRaw(t *testing.T) {
+	objs := pagesPdf("BT ET", "BT ET", "BT ET")
+	objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", "/MediaBox [0 0 612 792] /CropBox [36 36 576 756]", 1)
+	objs[12] = strings.Replace(objs[12], "/MediaBox [0 0 612 792]", "/MediaBox [0 0 612 792] /CropBox [0 0 612 792]", 1)
+	importer := newTestImporter(t, buildPdf(objs))
+
+	tests := []struct {
+		pageno int
+		boxes  map[string][4]float64 // llx, lly, urx, ury of each box that is defined
+	}{
+		{1, map[string][4]float64{"/MediaBox": {0, 0, 612, 792}, "/CropBox": {36, 36, 576, 756}}},
+		{2, map[string][4]float64{"/MediaBox": {0, 0, 612, 792}, "/CropBox": {0, 0, 612, 792}}},
+		{3, map[string][4]float64{"/MediaBox": {0, 0, 612, 792}}},
+	}
+
+	sizes := importer.GetPageSizes()
+	for _, test := range tests {
+		boxes, err := importer.GetPageBoxesRaw(test.pageno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(boxes) != len(test.boxes) {
+			t.Errorf("page %d: got boxes %v, want %v", test.pageno, boxes, test.boxes)
+		}
+		for name, want := range test.boxes {
+			box := boxes[name]
+			if got := [4]float64{box["llx"], box["lly"], box["urx"], box["ury"]}; got != want {
+				t.Errorf("page %d: got %s %v, want %v", test.pageno, name, got, want)
+			}
+		}
+
+		// GetPageSizes has every box
+		if len(sizes[test.pageno]) != 5 {
+			t.Errorf("page %d: GetPageSizes has %d boxes, want 5", test.pageno, len(sizes[test.pageno]))
+		}
+	}
+
+	if _, err := importer.GetPageBoxesRaw(4); err == nil {
+		t.Error("page 4: expected an error")
+	}
+}
+
+// Box values may mix integers and reals, and are scaled by k
+func TestMixedBoxValues(t *testing.T) {
+	tests := []struct {
+		box  string
+		k    float64
+		want [4]float64 // x, y, w, h
+	}{
+		{"[0 0 595.276 841.890]", 1, [4]float64{0, 0, 595.276, 841.89}},
+		{"[0.5 10 595 842.5]", 1, [4]float64{0.5, 10, 594.5, 832.5}},
+		{"[0 0 595.276 841.890]", 72 / 25.4, [4]float64{0, 0, 595.276 * 25.4 / 72, 841.89 * 25.4 / 72}},
+		{"[10 20.0 110 220]", 2, [4]float64{5, 10, 50, 100}},
+		{"[-10.5 -20 100 200]", 1, [4]float64{-10.5, -20, 110.5, 220}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s k %.2f", test.box, test.k), func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[10] = strings.Replace(objs[10], "[0 0 612 792]", test.box, 1)
+			reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildPdf(objs)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			boxes, err := reader.getPageBoxes(1, test.k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			box := boxes["/MediaBox"]
+			got := [4]float64{box["x"], box["y"], box["w"], box["h"]}
+			for i := range got {
+				if math.Abs(got[i]-test.want[i]) > 1e-9 {
+					t.Errorf("got x, y, w, h %v, want %v", got, test.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+// A page sized by one box can be clipped to another
+func TestClipBox(t *testing.T) {
+	bboxRegexp := regexp.MustCompile(`/BBox \[([^\]]*)\]`)
+
+	tests := []struct {
+		name    string
+		clipBox string
+		bbox    string
+		clip    string // The clipping path of the inlined content
+	}{
+		{"media box", "", "0.00 0.00 612.00 792.00", "0.00 0.00 612.00 792.00 re W n"},
+		{"trim box", "/TrimBox", "18.00 36.00 594.00 756.00", "18.00 36.00 576.00 720.00 re W n"},
+		{"box that is not defined", "/BleedBox", "0.00 0.00 612.00 792.00", "0.00 0.00 612.00 792.00 re W n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", "/MediaBox [0 0 612 792] /TrimBox [18 36 594 756]", 1)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			// The page clipped to another box is a different template
+			plain := importer.ImportPage(1, "/MediaBox")
+			tplid, err := importer.ImportPageWithClipBox(1, "/MediaBox", test.clipBox)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (tplid == plain) != (test.clipBox == "") {
+				t.Errorf("got template %d for the page imported without clip box %d", tplid, plain)
+			}
+
+			if content := templateContent(t, importer, tplid); !strings.Contains(content, test.clip) {
+				t.Errorf("got content %q, want %s", content, test.clip)
+			}
+
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The template is sized by the media box
+			if w, h := templateSize(t, importer, tplid); w != 612 || h != 792 {
+				t.Errorf("got template %.0f x %.0f, want 612 x 792", w, h)
+			}
+
+			name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 0, 0)
+			form := objects[templates[name]]
+			if m := bboxRegexp.FindSubmatch(form); m == nil || string(m[1]) != test.bbox {
+				t.Errorf("got %s, want /BBox [%s]", bboxRegexp.Find(form), test.bbox)
+			}
+		})
+	}
+}
+
+// A media box may be given by any two opposite corners, also with negative coordinates
+func TestReversedMediaBox(t *testing.T) {
+	bboxRegexp := regexp.MustCompile(`/BBox \[([^\]]*)\]`)
+	matrixRegexp := regexp.MustCompile(`/Matrix \[([^\]]*)\]`)
+
+	tests := []struct {
+		mediaBox string
+		x, y     float64
+		bbox     string
+		matrix   string // The /Matrix, or empty if it is the identity, which is left out
+	}{
+		{"[612 792 0 0]", 0, 0, "0.00 0.00 612.00 792.00", ""},
+		{"[0 792 612 0]", 0, 0, "0.00 0.00 612.00 792.00", ""},
+		{"[612 0 0 792]", 0, 0, "0.00 0.00 612.00 792.00", ""},
+		{"[-306 -396 306 396]", -306, -396, "-306.00 -396.00 306.00 396.00", "1.00000 0.00000 0.00000 1.00000 306.00000 396.00000"},
+		{"[306 396 -306 -396]", -306, -396, "-306.00 -396.00 306.00 396.00", "1.00000 0.00000 0.00000 1.00000 306.00000 396.00000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mediaBox, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			objs[10] = strings.Replace(objs[10], "[0 0 612 792]", test.mediaBox, 1)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			box := importer.GetPageSizes()[1]["/MediaBox"]
+			if box["x"] != test.x || box["y"] != test.y || box["w"] != 612 || box["h"] != 792 {
+				t.Errorf("got /MediaBox %v, want 612 x 792 at %.0f, %.0f", box, test.x, test.y)
+			}
+
+			tplid := importer.ImportPage(1, "/MediaBox")
+			if w, h := templateSize(t, importer, tplid); w != 612 || h != 792 {
+				t.Errorf("got template %.0f x %.0f, want 612 x 792", w, h)
+			}
+
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 0, 0)
+			form := objects[templates[name]]
+			if m := bboxRegexp.FindSubmatch(form); m == nil || string(m[1]) != test.bbox {
+				t.Errorf("got %s, want /BBox [%s]", bboxRegexp.Find(form), test.bbox)
+			}
+			if m := matrixRegexp.FindSubmatch(form); (m == nil && test.matrix != "") || (m != nil && string(m[1]) != test.matrix) {
+				t.Errorf("got %s, want /Matrix [%s]", matrixRegexp.Find(form), test.matrix)
+			}
+		})
+	}
+}
+
+// A region of a page is imported as a template of its size, clipped to it
+func TestImportPageRegion(t *testing.T) {
+	bboxRegexp := regexp.MustCompile(`/BBox \[([^\]]*)\]`)
+	matrixRegexp := regexp.MustCompile(`/Matrix \[([^\]]*)\]`)
+
+	tests := []struct {
+		name   string
+		region [4]float64
+		w, h   float64
+		bbox   string
+		matrix string
+	}{
+		{"lower left quarter", [4]float64{0, 0, 306, 396}, 306, 396, "0.00 0.00 306.00 396.00", ""},
+		{"upper right quarter", [4]float64{306, 396, 612, 792}, 306, 396, "306.00 396.00 612.00 792.00", "1.00000 0.00000 0.00000 1.00000 -306.00000 -396.00000"},
+		{"reversed corners", [4]float64{612, 792, 306, 396}, 306, 396, "306.00 396.00 612.00 792.00", "1.00000 0.00000 0.00000 1.00000 -306.00000 -396.00000"},
+		{"limited to the box", [4]float64{-100, 500, 100, 1000}, 100, 292, "0.00 500.00 100.00 792.00", "1.00000 0.00000 0.00000 1.00000 0.00000 -500.00000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := newTestImporter(t, buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET")))
+
+			// The region is a different template than the page
+			page := importer.ImportPage(1, "/MediaBox")
+			tplid, err := importer.ImportPageRegion(1, test.region, "/MediaBox")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tplid == page {
+				t.Errorf("got the template of the page for a region")
+			}
+			if w, h := templateSize(t, importer, tplid); w != test.w || h != test.h {
+				t.Errorf("got template %.0f x %.0f, want %.0f x %.0f", w, h, test.w, test.h)
+			}
+
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 0, 0)
+			form := objects[templates[name]]
+			if m := bboxRegexp.FindSubmatch(form); m == nil || string(m[1]) != test.bbox {
+				t.Errorf("got %s, want /BBox [%s]", bboxRegexp.Find(form), test.bbox)
+			}
+			if m := matrixRegexp.FindSubmatch(form); (m == nil && test.matrix != "") || (m != nil && string(m[1]) != test.matrix) {
+				t.Errorf("got %s, want /Matrix [%s]", matrixRegexp.Find(form), test.matrix)
+			}
+		})
+	}
+
+	// A region outside of the box is an error
+	importer := newTestImporter(t, buildPdf(pagesPdf("BT ET")))
+	if _, err := importer.ImportPageRegion(1, [4]float64{700, 0, 800, 100}, "/MediaBox"); err == nil {
+		t.Error("expected an error for a region outside of the box")
+	}
+}
+
+// A page with its own /MediaBox inherits the /CropBox of its parent, while the other boxes are not
+// inherited and default to the /CropBox
+func TestInheritedCropBox(t *testing.T) {
+	objs := pagesPdf("BT ET", "BT ET")
+	objs[2] = "<< /Type /Pages /Kids [10 0 R 12 0 R] /Count 2 /CropBox [0 0 300 400] /TrimBox [0 0 100 100] >>"
+	objs[12] = strings.Replace(objs[12], "/MediaBox [0 0 612 792]", "/MediaBox [0 0 612 792] /CropBox [0 0 200 250]", 1)
+
+	tests := []struct {
+		pageno int
+		box    string
+		w, h   float64
+	}{
+		{1, "/MediaBox", 612, 792},
+		{1, "/CropBox", 300, 400},
+		{1, "/TrimBox", 300, 400},
+		{2, "/MediaBox", 612, 792},
+		{2, "/CropBox", 200, 250},
+		{2, "/TrimBox", 200, 250},
+	}
+
+	data := buildPdf(objs)
+	sizes := newTestImporter(t, data).GetPageSizes()
+	for _, test := range tests {
+		box := sizes[test.pageno][test.box]
+		if box["w"] != test.w || box["h"] != test.h {
+			t.Errorf("page %d: got %s %v, want %.0f x %.0f", test.pageno, test.box, box, test.w, test.h)
+		}
+
+		// Imported pages are cached by page number, so each box is imported by a new importer
+		importer := newTestImporter(t, data)
+		tplid := importer.ImportPage(test.pageno, test.box)
+		if w, h := templateSize(t, importer, tplid); w != test.w || h != test.h {
+			t.Errorf("page %d: got %s template %.0f x %.0f, want %.0f x %.0f", test.pageno, test.box, w, h, test.w, test.h)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package gofpdi
+
+import (
+	"sort"
+)
+
+// Features supported by this build of gofpdi, see Capabilities
+type Caps struct {
+	// Stream filters that are decoded (e.g. /FlateDecode)
+	Filters []string
+	// Image filters that are passed through without decoding (e.g. /DCTDecode)
+	ImageFilters []string
+	// Crypt filters that can be read.  Only /Identity, which does not encrypt, is supported.
+	CryptFilters []string
+	// Whether encrypted documents (other than with /Identity crypt filters) can be decrypted
+	Decryption bool
+	// Whether cross-reference streams and object streams (PDF 1.5) can be read
+	XrefStreams   bool
+	ObjectStreams bool
+	// Whether annotations and the structure elements of tagged pages can be imported
+	Annotations   bool
+	StructureTree bool
+}
+
+// Get the features supported by this build, so that integrators can check them before importing
+func Capabilities() Caps {
+	filters := make([]string, 0, len(streamDecoders))
+	for name := range streamDecoders {
+		filters = append(filters, name)
+	}
+	sort.Strings(filters)
+
+	return Caps{
+		Filters:       filters,
+		ImageFilters:  append([]string(nil), imageFilters...),
+		CryptFilters:  []string{"/Identity"},
+		Decryption:    false,
+		XrefStreams:   true,
+		ObjectStreams: true,
+		Annotations:   true,
+		StructureTree: true,
+	}
+}
+
+// Check if a stream filter (e.g. /LZWDecode) is decoded or passed through as an image filter
+func (this Caps) SupportsFilter(name string) bool {
+	return in_array(name, this.Filters) || in_array(name, this.ImageFilters)
+}
@@ -0,0 +1,95 @@
+package gofpdi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// The reported capabilities match what is supported
+func TestCapabilities(t *testing.T) {
+	caps := Capabilities()
+	content := "BT /F1 12 Tf 72 712 Td (Hello) Tj ET"
+
+	encoders := map[string]func([]byte) []byte{
+		"/FlateDecode":   deflate,
+		"/LZWDecode":     func(data []byte) []byte { return lzwEncode(data, 1) },
+		"/ASCII85Decode": encodeAscii85,
+		"/ASCIIHexDecode": func(data []byte) []byte {
+			return []byte(hex.EncodeToString(data) + ">")
+		},
+		"/RunLengthDecode": func(data []byte) []byte {
+			return append(append([]byte{byte(len(data) - 1)}, data...), 128)
+		},
+		"/Crypt": func(data []byte) []byte { return data },
+	}
+
+	// Every reported filter is decoded, and every filter is reported
+	for _, filter := range caps.Filters {
+		encode, ok := encoders[filter]
+		if !ok {
+			t.Errorf("filter %s is not tested", filter)
+			continue
+		}
+		delete(encoders, filter)
+
+		objs := pagesPdf("")
+		objs[11] = pdfStream("/Filter "+filter, string(encode([]byte(content))))
+		got, err := newTestImporter(t, buildPdf(objs)).GetPageContentStream(1)
+		if err != nil {
+			t.Errorf("%s: %v", filter, err)
+		} else if string(got) != content {
+			t.Errorf("%s: got content %q, want %q", filter, got, content)
+		}
+		if !caps.SupportsFilter(filter) {
+			t.Errorf("%s is not supported", filter)
+		}
+	}
+	for filter := range encoders {
+		t.Errorf("filter %s is not reported", filter)
+	}
+
+	// Image filters are passed through
+	reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildPdf(pagesPdf("BT ET"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filter := range caps.ImageFilters {
+		data, image, err := reader.decodeStreamToImage([]byte("image"), []*PdfValue{{Type: PDF_TYPE_TOKEN, Token: filter}}, nil)
+		if err != nil || image != filter || string(data) != "image" {
+			t.Errorf("%s: got data %q, image filter %s and error %v", filter, data, image, err)
+		}
+		if !caps.SupportsFilter(filter) {
+			t.Errorf("%s is not supported", filter)
+		}
+	}
+	if caps.SupportsFilter("/UnknownDecode") {
+		t.Errorf("/UnknownDecode is supported")
+	}
+
+	// Only documents that are not encrypted can be read without decryption
+	if caps.Decryption || len(caps.CryptFilters) != 1 || caps.CryptFilters[0] != "/Identity" {
+		t.Errorf("got decryption %v and crypt filters %v, want only /Identity", caps.Decryption, caps.CryptFilters)
+	}
+	encrypt := "<< /Filter /Standard /R 4 /Length 128 /O <00> /U <00> /P -4 /V 4 /CF << /StdCF << /CFM /AESV2 /Length 16 >> >> /StmF /StdCF /StrF /StdCF >>"
+	if _, err := newTestImporter(t, encryptedPdf(pagesPdf(content), encrypt)).GetPageContentStream(1); errors.Cause(err) != ErrEncrypted {
+		t.Errorf("got error %v for an aes encrypted document, want ErrEncrypted", err)
+	}
+
+	// Xref streams, object streams, annotations and structure trees can be read
+	if !caps.XrefStreams || !caps.ObjectStreams || !caps.Annotations || !caps.StructureTree {
+		t.Errorf("got capabilities %+v", caps)
+	}
+	objs := pagesPdf(content)
+	compressed := map[int]string{3: objs[3]}
+	delete(objs, 3)
+	importer := newTestImporter(t, buildObjStmPdf(objs, compressed, "/FlateDecode", deflate))
+	importer.ImportPage(1, "/MediaBox")
+	_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	findObject(t, objects, "/BaseFont /Helvetica")
+}
@@ -15,3 +15,12 @@ const (
 	PDF_TYPE_BOOLEAN
 	PDF_TYPE_REAL
 )
+
+// How UseTemplateFit fits a template into a box
+type FitMode int
+
+const (
+	FIT_CONTAIN FitMode = iota // Scale to fit inside the box, keeping the aspect ratio, and center
+	FIT_COVER                  // Scale to cover the box, keeping the aspect ratio, and center.  The template overflows the box.
+	FIT_STRETCH                // Scale to the size of the box, not keeping the aspect ratio
+)
@@ -0,0 +1,320 @@
+package gofpdi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// An operator of a content stream and its operands
+type contentOp struct {
+	Operator string
+	Operands []*PdfValue
+	// The image dictionary (between BI and ID) and data (between ID and EI) of an inline image,
+	// whose operator is EI
+	Image *PdfValue
+	Data  []byte
+}
+
+// Parse a decoded content stream into operators.  The data of inline images is not length-prefixed,
+// so it is skipped separately instead of being parsed as operators.
+func (this *PdfReader) parseContent(data []byte) ([]contentOp, error) {
+	// Use a separate parser, so that the token stack of this reader is not affected
+	parser := &PdfReader{limits: this.limits}
+
+	ops := make([]contentOp, 0)
+	operands := make([]*PdfValue, 0)
+
+	// A token must be followed by a delimiter, also at the end of the content
+	data = append(data[:len(data):len(data)], '\n')
+
+	br := bytes.NewReader(data)
+	r := bufio.NewReader(br)
+	for {
+		t, err := parser.readToken(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read content token")
+		}
+		if t == "" {
+			break
+		}
+
+		if t == "BI" {
+			op, end, err := parser.readInlineImage(r, br, data)
+			if err != nil {
+				return nil, errors.Wrap(err, "Failed to read inline image")
+			}
+			ops = append(ops, op)
+			operands = make([]*PdfValue, 0)
+
+			// Continue after the EI operator
+			br.Seek(int64(end), 0)
+			r.Reset(br)
+			continue
+		}
+
+		value, err := parser.readValue(r, t)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read content value for token: "+t)
+		}
+
+		// Operators are tokens that are not names
+		if value.Type == PDF_TYPE_TOKEN && !strings.HasPrefix(value.Token, "/") {
+			ops = append(ops, contentOp{Operator: value.Token, Operands: operands})
+			operands = make([]*PdfValue, 0)
+		} else {
+			operands = append(operands, value)
+		}
+	}
+
+	return ops, nil
+}
+
+// Read an inline image after the BI operator.  r buffers br, which reads the content stream data.
+// Returns the image and the position in data after the EI operator.
+func (this *PdfReader) readInlineImage(r *bufio.Reader, br *bytes.Reader, data []byte) (contentOp, int, error) {
+	op := contentOp{Operator: "EI", Image: &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, 0)}}
+
+	// Read the image dictionary up to the ID operator
+	for {
+		key, err := this.readToken(r)
+		if err != nil {
+			return op, 0, errors.Wrap(err, "Failed to read token")
+		}
+		if key == "" {
+			return op, 0, errors.New("Missing ID operator")
+		}
+		if key == "ID" {
+			break
+		}
+
+		t, err := this.readToken(r)
+		if err != nil {
+			return op, 0, errors.Wrap(err, "Failed to read token")
+		}
+		value, err := this.readValue(r, t)
+		if err != nil {
+			return op, 0, errors.Wrap(err, "Failed to read value for token: "+t)
+		}
+		op.Image.Dictionary[key] = value
+	}
+
+	// A single whitespace character follows ID.  Tokens pushed back on the stack would be lost,
+	// but after ID there are none, because ID is never read ahead of a number.
+	pos := len(data) - br.Len() - r.Buffered()
+	if len(this.stack) > 0 {
+		return op, 0, errors.New("Unexpected tokens before inline image data")
+	}
+	if pos < len(data) && isWhitespace(data[pos]) {
+		pos++
+	}
+
+	end := -1
+
+	// The length is known if it is set (PDF 2.0), or if the data is not compressed
+	if length := inlineImageLength(op.Image); length >= 0 && pos+length <= len(data) {
+		if i := skipToEI(data, pos+length); i >= 0 {
+			op.Data = data[pos : pos+length]
+			end = i
+		}
+	}
+
+	// Otherwise, look for EI preceded by whitespace and followed by something that is not binary
+	for i := pos; end < 0 && i+1 < len(data); i++ {
+		if data[i] != 'E' || data[i+1] != 'I' || (i > pos && !isWhitespace(data[i-1])) {
+			continue
+		}
+		if i+2 < len(data) && !isDelimiter(data[i+2]) {
+			continue
+		}
+		if !isText(data[i+2:]) {
+			continue
+		}
+
+		// The data ends before the whitespace that precedes EI
+		dataEnd := i
+		if dataEnd > pos {
+			dataEnd--
+		}
+		op.Data = data[pos:dataEnd]
+		end = i + 2
+	}
+
+	if end < 0 {
+		return op, 0, errors.New(fmt.Sprintf("Missing EI operator of inline image at offset %d", pos))
+	}
+
+	return op, end, nil
+}
+
+// Get the length of the data of an inline image from its /L entry, or from its size if it is not
+// compressed.  Returns -1 if the length is not known.
+func inlineImageLength(image *PdfValue) int {
+	if l := inlineImageEntry(image, "/L", "/Length"); l != nil && l.Type == PDF_TYPE_NUMERIC {
+		return l.Int
+	}
+
+	if inlineImageEntry(image, "/F", "/Filter") != nil {
+		return -1
+	}
+
+	w := inlineImageEntry(image, "/W", "/Width")
+	h := inlineImageEntry(image, "/H", "/Height")
+	if w == nil || h == nil || w.Type != PDF_TYPE_NUMERIC || h.Type != PDF_TYPE_NUMERIC {
+		return -1
+	}
+
+	bpc, colors := 1, 1
+	if mask := inlineImageEntry(image, "/IM", "/ImageMask"); mask == nil || !mask.Bool {
+		if v := inlineImageEntry(image, "/BPC", "/BitsPerComponent"); v != nil && v.Type == PDF_TYPE_NUMERIC {
+			bpc = v.Int
+		}
+
+		cs := inlineImageEntry(image, "/CS", "/ColorSpace")
+		if cs == nil {
+			return -1
+		}
+		if cs.Type == PDF_TYPE_ARRAY && len(cs.Array) > 0 {
+			cs = cs.Array[0]
+		}
+
+		switch cs.Token {
+		case "/G", "/DeviceGray", "/I", "/Indexed":
+			colors = 1
+		case "/RGB", "/DeviceRGB":
+			colors = 3
+		case "/CMYK", "/DeviceCMYK":
+			colors = 4
+		default:
+			// A named color space of the resources
+			return -1
+		}
+	}
+
+	return (w.Int*colors*bpc + 7) / 8 * h.Int
+}
+
+// Get an entry of an inline image dictionary by its abbreviated or full key
+func inlineImageEntry(image *PdfValue, abbr string, key string) *PdfValue {
+	if v, ok := image.Dictionary[abbr]; ok {
+		return v
+	}
+
+	return image.Dictionary[key]
+}
+
+// Get the position after the EI operator that follows the whitespace at pos, or -1 if there is none
+func skipToEI(data []byte, pos int) int {
+	for pos < len(data) && isWhitespace(data[pos]) {
+		pos++
+	}
+
+	if pos+1 < len(data) && data[pos] == 'E' && data[pos+1] == 'I' && (pos+2 == len(data) || isDelimiter(data[pos+2])) {
+		return pos + 2
+	}
+
+	return -1
+}
+
+// Check if a byte is whitespace
+func isWhitespace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\f' || b == 0
+}
+
+// Check if a byte ends a token
+func isDelimiter(b byte) bool {
+	return isWhitespace(b) || bytes.IndexByte([]byte("/[]<>()%"), b) >= 0
+}
+
+// Check if the start of data is text, i.e. printable ASCII or whitespace, like the operators that
+// follow an inline image
+func isText(data []byte) bool {
+	if len(data) > 32 {
+		data = data[:32]
+	}
+
+	for _, b := range data {
+		if (b < 32 || b > 126) && !isWhitespace(b) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Get the names of the resources that a content stream uses, by resource category (e.g. "/Font")
+func (this *PdfReader) getContentResourceNames(data []byte) (map[string][]string, error) {
+	ops, err := this.parseContent(data)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]map[string]bool, 0)
+	use := func(category string, value *PdfValue) {
+		if value == nil || value.Type != PDF_TYPE_TOKEN || !strings.HasPrefix(value.Token, "/") {
+			return
+		}
+		if used[category] == nil {
+			used[category] = make(map[string]bool, 0)
+		}
+		used[category][value.Token] = true
+	}
+	operand := func(op contentOp, i int) *PdfValue {
+		if i < 0 || i >= len(op.Operands) {
+			return nil
+		}
+		return op.Operands[i]
+	}
+
+	for _, op := range ops {
+		switch op.Operator {
+		case "Do":
+			use("/XObject", operand(op, 0))
+		case "Tf":
+			use("/Font", operand(op, 0))
+		case "gs":
+			use("/ExtGState", operand(op, 0))
+		case "sh":
+			use("/Shading", operand(op, 0))
+		case "cs", "CS":
+			if cs := operand(op, 0); cs != nil && !in_array(cs.Token, []string{"/DeviceGray", "/DeviceRGB", "/DeviceCMYK", "/Pattern"}) {
+				use("/ColorSpace", cs)
+			}
+		case "scn", "SCN":
+			use("/Pattern", operand(op, len(op.Operands)-1))
+		case "BDC", "DP":
+			use("/Properties", operand(op, 1))
+		case "EI":
+			cs := inlineImageEntry(op.Image, "/CS", "/ColorSpace")
+			if cs != nil && !in_array(cs.Token, []string{"/G", "/RGB", "/CMYK", "/I", "/DeviceGray", "/DeviceRGB", "/DeviceCMYK", "/Indexed"}) {
+				use("/ColorSpace", cs)
+			}
+		}
+	}
+
+	result := make(map[string][]string, len(used))
+	for category, names := range used {
+		for name := range names {
+			result[category] = append(result[category], name)
+		}
+		sort.Strings(result[category])
+	}
+
+	return result, nil
+}
+
+// Get the names of the resources that the content of a page uses, by resource category (e.g.
+// "/Font": ["/F1"]).  Unlike the resources in GetPages, this leaves out resources that are defined
+// but not used, e.g. because the resources are shared by all pages.
+func (this *Importer) GetPageUsedResources(pageno int) (map[string][]string, error) {
+	content, err := this.GetReader().getContent(pageno)
+	if err != nil {
+		return nil, err
+	}
+
+	return this.GetReader().getContentResourceNames([]byte(content))
+}
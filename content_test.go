@@ -0,0 +1,447 @@
+package gofpdi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A page without /Resources is imported with empty resources, or the resources it inherits
+func TestPageResources(t *testing.T) {
+	tests := []struct {
+		name      string
+		objs      func(objs map[int]string)
+		resources string // A regexp for the /Resources of the form xobject
+	}{
+		{"no resources", func(objs map[int]string) {
+			objs[10] = "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 11 0 R >>"
+		}, `/Resources\s*<<\s*>>`},
+		{"inherited resources", func(objs map[int]string) {
+			objs[2] = "<< /Type /Pages /Kids [10 0 R] /Count 1 /Resources << /Font << /F1 3 0 R >> >> >>"
+			objs[10] = "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 11 0 R >>"
+		}, `/Resources\s*<<\s*/Font\s*<<\s*/F1 \d+ 0 R\s*>>\s*>>`},
+		{"procset only", func(objs map[int]string) {
+			objs[10] = "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /ProcSet [/PDF] >> /Contents 11 0 R >>"
+		}, `/Resources\s*<<\s*/ProcSet\s*\[\s*/PDF\s*\]\s*>>`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("0 0 m 100 100 l S")
+			test.objs(objs)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			tplid, err := importer.ImportPages([]int{1}, "/MediaBox")
+			if err != nil {
+				t.Fatal(err)
+			}
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, _, _, _, _ := importer.UseTemplate(tplid[0], 0, 0, 0, 0)
+			form := objects[templates[name]]
+
+			if dict, _ := splitStream(t, form); !regexp.MustCompile(test.resources).MatchString(dict) {
+				t.Errorf("got form %q, want /Resources matching %s", dict, test.resources)
+			}
+			if content := string(inflate(t, form)); !strings.Contains(content, "0 0 m 100 100 l S") {
+				t.Errorf("got content %q", content)
+			}
+			for _, ref := range regexp.MustCompile(`(\d+) 0 R`).FindAllSubmatch(form, -1) {
+				id, _ := strconv.Atoi(string(ref[1]))
+				if _, ok := objects[id]; !ok {
+					t.Errorf("the resources reference object %d, which was not put", id)
+				}
+			}
+		})
+	}
+}
+
+// A blank page is imported as an empty form xobject with the size of the page
+func TestBlankPage(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+	}{
+		{"no contents", "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 300 400] >>"},
+		{"null contents", "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 300 400] /Contents null >>"},
+		{"empty array", "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 300 400] /Contents [] >>"},
+		{"empty stream", "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 300 400] /Contents 20 0 R >>"},
+		{"reference to null", "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 300 400] /Contents 21 0 R >>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[10] = test.page
+			objs[20] = pdfStream("", "")
+			objs[21] = "null"
+			importer := newTestImporter(t, buildPdf(objs))
+
+			tplids, err := importer.ImportPages([]int{1}, "/MediaBox")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w, h := templateSize(t, importer, tplids[0]); w != 300 || h != 400 {
+				t.Errorf("got template %.0f x %.0f, want 300 x 400", w, h)
+			}
+
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, _, _, _, _ := importer.UseTemplate(tplids[0], 0, 0, 0, 0)
+			form := objects[templates[name]]
+			if dict, _ := splitStream(t, form); !strings.Contains(dict, "/BBox [0.00 0.00 300.00 400.00]") {
+				t.Errorf("got form %q, want /BBox [0 0 300 400]", dict)
+			}
+			if content := inflate(t, form); len(content) != 0 {
+				t.Errorf("got content %q, want none", content)
+			}
+		})
+	}
+}
+
+// The content streams of a page are separated, so that the tokens at the end of one stream and the
+// start of the next are not merged
+func TestContentStreamArray(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf")
+	objs[10] = strings.Replace(objs[10], "/Contents 11 0 R", "/Contents [11 0 R 20 0 R 21 0 R]", 1)
+	objs[20] = pdfStream("", "72 712 Td (Hello)")
+	objs[21] = pdfStream("", "Tj ET")
+	importer := newTestImporter(t, buildPdf(objs))
+
+	want := "BT /F1 12 Tf 72 712 Td (Hello) Tj ET"
+
+	content, err := importer.GetPageContentStream(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(strings.Fields(string(content)), " "); got != want {
+		t.Errorf("GetPageContentStream: got %q, want %q", content, want)
+	}
+
+	tplid := importer.ImportPage(1, "/MediaBox")
+	if got := strings.Join(strings.Fields(templateContent(t, importer, tplid)), " "); !strings.Contains(got, want) {
+		t.Errorf("template: got %q, want %q", got, want)
+	}
+}
+
+// Null and undefined entries of /Contents arrays are skipped
+func TestNullContents(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		warning  string
+	}{
+		{"null", "[null 11 0 R null 20 0 R null]", ""},
+		{"undefined", "[11 0 R 99 0 R 20 0 R]", "Content stream 99 is not defined and is left out"},
+		{"null in an indirect array", "22 0 R", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf")
+			objs[10] = strings.Replace(objs[10], "/Contents 11 0 R", "/Contents "+test.contents, 1)
+			objs[20] = pdfStream("", "(Hello) Tj ET")
+			objs[22] = "[11 0 R null 20 0 R]"
+			importer := newTestImporter(t, buildPdf(objs))
+
+			content, err := importer.GetPageContentStream(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(strings.Fields(string(content)), " "); got != "BT /F1 12 Tf (Hello) Tj ET" {
+				t.Errorf("got content %q", content)
+			}
+
+			tplid := importer.ImportPage(1, "/MediaBox")
+			if got := strings.Join(strings.Fields(templateContent(t, importer, tplid)), " "); !strings.Contains(got, "BT /F1 12 Tf (Hello) Tj ET") {
+				t.Errorf("got template content %q", got)
+			}
+
+			if warnings := strings.Join(importer.GetWarnings(), "\n"); test.warning != "" && !strings.Contains(warnings, test.warning) {
+				t.Errorf("got warnings %q, want %s", warnings, test.warning)
+			}
+		})
+	}
+}
+
+// GetPageContentStream decodes the content stream of a page with all of its filters
+func TestGetPageContentStream(t *testing.T) {
+	content := "BT /F1 12 Tf 72 712 Td (Hello) Tj ET"
+	compressed := deflate([]byte(content))
+
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		{"uncompressed", pdfStream("", content)},
+		{"flate", pdfStream("/Filter /FlateDecode", string(compressed))},
+		{"filter array", pdfStream("/Filter [/FlateDecode]", string(compressed))},
+		{"hex and flate", pdfStream("/Filter [/ASCIIHexDecode /FlateDecode]", hex.EncodeToString(compressed)+">")},
+		{"ascii85 and flate", pdfStream("/Filter [/ASCII85Decode /FlateDecode]", string(encodeAscii85(compressed)))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("")
+			objs[11] = test.stream
+			importer := newTestImporter(t, buildPdf(objs))
+
+			got, err := importer.GetPageContentStream(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("got %q, want %q", got, content)
+			}
+		})
+	}
+
+	importer := newTestImporter(t, buildPdf(pagesPdf(content)))
+	if _, err := importer.GetPageContentStream(2); err == nil {
+		t.Error("page 2: expected an error")
+	}
+}
+
+// The content of a template inlined with GetTemplateContent is drawn like the form xobject: with the
+// /Matrix of the form as cm, clipped to its /BBox, with the same operators and resources
+func TestGetTemplateContent(t *testing.T) {
+	matrixRegexp := regexp.MustCompile(`/Matrix \[([^\]]*)\]`)
+	bboxRegexp := regexp.MustCompile(`/BBox \[([^\]]*)\]`)
+	fontRegexp := regexp.MustCompile(`/F1 (\d+) 0 R`)
+	content := "BT /F1 12 Tf 72 712 Td (Hello) Tj ET"
+
+	tests := []struct {
+		name string
+		page string
+	}{
+		{"media box", "/MediaBox [0 0 612 792]"},
+		{"rotated crop box", "/MediaBox [0 0 612 792] /CropBox [100 200 400 600] /Rotate 90"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf(content)
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", test.page, 1)
+			data := buildPdf(objs)
+
+			// The form xobject
+			importer := newTestImporter(t, data)
+			tplid := importer.ImportPage(1, "/CropBox")
+			templates, formObjects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 0, 0)
+			form := formObjects[templates[name]]
+			dict, _ := splitStream(t, form)
+
+			// The inlined content
+			importer = newTestImporter(t, data)
+			tplid = importer.ImportPage(1, "/CropBox")
+			inlined, resources, objects, err := importer.GetTemplateContent(tplid, idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(string(inlined)), "\n")
+			if lines[0] != "q" || lines[len(lines)-1] != "Q" {
+				t.Errorf("the content %q is not enclosed in q/Q", inlined)
+			}
+			matrix := "1.00000 0.00000 0.00000 1.00000 0.00000 0.00000"
+			if m := matrixRegexp.FindStringSubmatch(dict); m != nil {
+				matrix = m[1]
+			}
+			if matrix != "1.00000 0.00000 0.00000 1.00000 0.00000 0.00000" && !strings.Contains(string(inlined), matrix+" cm\n") {
+				t.Errorf("the content %q does not set the /Matrix [%s] of the form", inlined, matrix)
+			}
+			var llx, lly, urx, ury float64
+			if _, err := fmt.Sscan(bboxRegexp.FindStringSubmatch(dict)[1], &llx, &lly, &urx, &ury); err != nil {
+				t.Fatal(err)
+			}
+			if clip := fmt.Sprintf("%.2f %.2f %.2f %.2f re W n\n", llx, lly, urx-llx, ury-lly); !strings.Contains(string(inlined), clip) {
+				t.Errorf("the content %q is not clipped like the /BBox of the form, with %q", inlined, clip)
+			}
+			if formContent := string(inflate(t, form)); !strings.Contains(string(inlined), formContent) {
+				t.Errorf("the content %q does not have the content %q of the form", inlined, formContent)
+			}
+
+			// Both use the font of the page
+			for _, r := range []struct {
+				resources []byte
+				objects   map[int][]byte
+			}{{[]byte(dict), formObjects}, {resources, objects}} {
+				font := fontRegexp.FindSubmatch(r.resources)
+				if font == nil {
+					t.Fatalf("the resources %q have no /F1", r.resources)
+				}
+				id, _ := strconv.Atoi(string(font[1]))
+				if !bytes.Contains(r.objects[id], []byte("/BaseFont /Helvetica")) {
+					t.Errorf("got font %q", r.objects[id])
+				}
+			}
+		})
+	}
+}
+
+// Content streams cannot be in object streams, but arrays of content streams can
+func TestCompressedContent(t *testing.T) {
+	tests := []struct {
+		name       string
+		objs       map[int]string
+		compressed map[int]string
+		want       string // The error, or empty if the content is read
+	}{
+		{"stream", nil, map[int]string{11: "<< /Length 24 >>"}, "Content stream 11 is in an object stream"},
+		{"array", map[int]string{13: pdfStream("", "BT /F1 12 Tf (one) Tj ET")}, map[int]string{11: "[13 0 R]"}, ""},
+		{"stream in an array", nil, map[int]string{11: "[13 0 R]", 13: "<< /Length 24 >>"}, "Content stream 13 is in an object stream"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			delete(objs, 11)
+			for id, obj := range test.objs {
+				objs[id] = obj
+			}
+			importer := newTestImporter(t, buildObjStmPdf(objs, test.compressed, "", nil))
+
+			content, err := importer.GetPageContentStream(1)
+			if test.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(content) != "BT /F1 12 Tf (one) Tj ET" {
+					t.Errorf("got content %q", content)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got content %q and error %v, want %s", content, err, test.want)
+			}
+		})
+	}
+}
+
+// The data of inline images is skipped, also if it looks like operators
+func TestInlineImages(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		operators string
+		data      string // The data of the inline image
+		fails     bool
+	}{
+		{"uncompressed", "q BI /W 4 /H 1 /CS /G /BPC 8 ID \x00EI/ EI Q\nBT /F1 12 Tf (one) Tj ET", "q EI Q BT Tf Tj ET", "\x00EI/", false},
+		{"length", "BI /W 2 /H 2 /CS /RGB /BPC 8 /F /Fl /L 9 ID EI /F9 Tf EI\nBT /F1 12 Tf (one) Tj ET", "EI BT Tf Tj ET", "EI /F9 Tf", false},
+		{"compressed", "BI /W 2 /H 2 /CS /RGB /BPC 8 /F /DCT ID \xff\xd8 EI\x01\x02\nEI Q", "EI Q", "\xff\xd8 EI\x01\x02", false},
+		{"at the end", "BI /W 1 /H 1 /CS /G /BPC 8 ID \x80 EI", "EI", "\x80", false},
+		{"full keys", "BI /Width 3 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8 ID abc EI S", "EI S", "abc", false},
+		{"missing EI", "BI /W 2 /H 2 /CS /RGB /BPC 8 /F /DCT ID \xff\xd8\xff", "", "", true},
+		{"missing ID", "BI /W 2 /H 2", "", "", true},
+	}
+
+	reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildPdf(pagesPdf("BT ET"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ops, err := reader.parseContent([]byte(test.content))
+			if test.fails {
+				if err == nil {
+					t.Errorf("expected an error, got operators %v", ops)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			operators := make([]string, len(ops))
+			data := ""
+			for i, op := range ops {
+				operators[i] = op.Operator
+				if op.Image != nil {
+					data = string(op.Data)
+				}
+			}
+			if got := strings.Join(operators, " "); got != test.operators {
+				t.Errorf("got operators %s, want %s", got, test.operators)
+			}
+			if data != test.data {
+				t.Errorf("got image data %q, want %q", data, test.data)
+			}
+		})
+	}
+
+	// Names in the data of an inline image are not used resources, but its named color space is
+	objs := pagesPdf("BI /W 9 /H 1 /CS /CS0 /BPC 8 ID /F9 Tf q EI\nBT /F1 12 Tf (one) Tj ET")
+	used, err := newTestImporter(t, buildPdf(objs)).GetPageUsedResources(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(used); got != "map[/ColorSpace:[/CS0] /Font:[/F1]]" {
+		t.Errorf("got used resources %s", got)
+	}
+}
+
+// The content rewriter changes the content of imported pages before it is stored in the template
+func TestContentRewriter(t *testing.T) {
+	importer := newTestImporter(t, buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET")))
+	pagenos := make([]int, 0)
+	importer.SetContentRewriter(func(pageno int, content []byte) ([]byte, error) {
+		pagenos = append(pagenos, pageno)
+		return append([]byte("1 0 0 rg "), bytes.Replace(content, []byte("(two)"), []byte("(2)"), 1)...), nil
+	})
+
+	tplids, err := importer.ImportPages([]int{1, 2}, "/MediaBox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(pagenos) != "[1 2]" {
+		t.Errorf("rewriter was called for pages %v, want [1 2]", pagenos)
+	}
+
+	for i, want := range []string{"1 0 0 rg BT /F1 12 Tf (one) Tj ET", "1 0 0 rg BT /F1 12 Tf (2) Tj ET"} {
+		tplInfo, err := importer.getTplInfo(tplids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buffer := tplInfo.Writer.tpls[tplInfo.TemplateId].Buffer; !strings.Contains(buffer, want) {
+			t.Errorf("page %d: got template buffer %q, want %s", i+1, buffer, want)
+		}
+	}
+
+	// The form xobjects have the rewritten content
+	templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _, _, _, _ := importer.UseTemplate(tplids[1], 0, 0, 0, 0)
+	if content := string(inflate(t, objects[templates[name]])); !strings.Contains(content, "1 0 0 rg BT /F1 12 Tf (2) Tj ET") {
+		t.Errorf("got form content %q", content)
+	}
+
+	// An error of the rewriter fails the import
+	if err := importer.setSourceStream("other.pdf", bytes.NewReader(buildPdf(pagesPdf("BT ET", "BT ET", "BT ET")))); err != nil {
+		t.Fatal(err)
+	}
+	importer.SetContentRewriter(func(pageno int, content []byte) ([]byte, error) {
+		if pageno == 3 {
+			return nil, fmt.Errorf("Cannot rewrite page %d", pageno)
+		}
+		return content, nil
+	})
+	if _, err := importer.ImportPages([]int{3}, "/MediaBox"); err == nil || !strings.Contains(err.Error(), "Failed to rewrite content: Cannot rewrite page 3") {
+		t.Errorf("got error %v, want the error of the rewriter", err)
+	}
+}
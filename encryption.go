@@ -0,0 +1,120 @@
+package gofpdi
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Check the /Encrypt dictionary of the trailer.  Returns nil if the document is not encrypted, or if
+// its crypt filters are /Identity, so that strings and streams are not actually encrypted.  Otherwise
+// returns ErrEncrypted wrapped with the security handler or crypt filter that is not supported.
+func (this *PdfReader) checkEncryption() error {
+	if this.trailer == nil {
+		return nil
+	}
+
+	encrypt, ok := this.trailer.Dictionary["/Encrypt"]
+	if !ok {
+		return nil
+	}
+
+	encrypt, err := this.resolveValue(encrypt)
+	if err != nil {
+		return errors.Wrap(ErrEncrypted, "Failed to resolve /Encrypt: "+err.Error())
+	}
+	if encrypt.Type != PDF_TYPE_DICTIONARY {
+		return errors.Wrap(ErrEncrypted, "/Encrypt is not a dictionary")
+	}
+
+	// Public-key security (/Adobe.PubSec) and custom handlers need keys that gofpdi does not have
+	handler := ""
+	if filter, ok := encrypt.Dictionary["/Filter"]; ok && filter.Type == PDF_TYPE_TOKEN {
+		handler = filter.Token
+	}
+	if handler != "/Standard" {
+		return errors.Wrap(ErrEncrypted, fmt.Sprintf("Unsupported security handler %s", handler))
+	}
+
+	// Before /V 4, strings and streams are always encrypted with RC4
+	v := decodeParm(encrypt, "/V", 0)
+	if v < 4 {
+		return errors.Wrap(ErrEncrypted, fmt.Sprintf("Unsupported encryption /V %d of security handler /Standard", v))
+	}
+
+	// Crypt filters for streams, strings and embedded files
+	for _, key := range []string{"/StmF", "/StrF", "/EFF"} {
+		name := "/Identity"
+		if f, ok := encrypt.Dictionary[key]; ok && f.Type == PDF_TYPE_TOKEN {
+			name = f.Token
+		} else if key == "/EFF" {
+			// Embedded files default to the stream filter, which has already been checked
+			continue
+		}
+
+		method, err := this.getCryptFilterMethod(encrypt, name)
+		if err != nil {
+			return errors.Wrap(ErrEncrypted, err.Error())
+		}
+		if method != "/None" {
+			return errors.Wrap(ErrEncrypted, fmt.Sprintf("Unsupported crypt filter %s (%s) for %s", name, method, key))
+		}
+	}
+
+	return nil
+}
+
+// Get the /CFM method of a crypt filter: /None for no encryption, or e.g. /V2, /AESV2 or /AESV3
+func (this *PdfReader) getCryptFilterMethod(encrypt *PdfValue, name string) (string, error) {
+	if name == "/Identity" {
+		return "/None", nil
+	}
+
+	cf, ok := encrypt.Dictionary["/CF"]
+	if !ok {
+		return "", errors.New("Crypt filter " + name + " not found")
+	}
+	cf, err := this.resolveValue(cf)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to resolve /CF")
+	}
+
+	filter, ok := cf.Dictionary[name]
+	if !ok {
+		return "", errors.New("Crypt filter " + name + " not found")
+	}
+	filter, err = this.resolveValue(filter)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to resolve crypt filter "+name)
+	}
+
+	if method, ok := filter.Dictionary["/CFM"]; ok && method.Type == PDF_TYPE_TOKEN {
+		return method.Token, nil
+	}
+
+	return "/None", nil
+}
+
+// Check if the metadata stream is encrypted along with the rest of the document.  It is not if
+// /EncryptMetadata is false, which applies from /V 4 on.
+func (this *PdfReader) encryptsMetadata() bool {
+	if this.trailer == nil {
+		return false
+	}
+
+	encrypt, ok := this.trailer.Dictionary["/Encrypt"]
+	if !ok {
+		return false
+	}
+
+	encrypt, err := this.resolveValue(encrypt)
+	if err != nil || encrypt.Type != PDF_TYPE_DICTIONARY {
+		return true
+	}
+
+	if v, ok := encrypt.Dictionary["/EncryptMetadata"]; ok && v.Type == PDF_TYPE_BOOLEAN && !v.Bool {
+		return decodeParm(encrypt, "/V", 0) < 4
+	}
+
+	return true
+}
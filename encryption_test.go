@@ -0,0 +1,126 @@
+package gofpdi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// A pdf whose trailer has an /Encrypt dictionary (object 8) and the given objects
+func encryptedPdf(objs map[int]string, encrypt string) []byte {
+	objs[8] = encrypt
+	return bytes.Replace(buildPdf(objs), []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Encrypt 8 0 R /ID [<0123456789abcdef> <0123456789abcdef>]"), 1)
+}
+
+func TestEncryption(t *testing.T) {
+	const standard = "/Filter /Standard /R 4 /Length 128 /O <00> /U <00> /P -4"
+
+	tests := []struct {
+		name    string
+		encrypt string
+		content string // A content stream, or the default one
+		want    string // The unsupported encryption, or empty if the content is readable
+	}{
+		{"identity", "<< " + standard + " /V 4 /StmF /Identity /StrF /Identity >>", "", ""},
+		{"identity by default", "<< " + standard + " /V 4 >>", "", ""},
+		{"crypt filter without encryption", "<< " + standard + " /V 4 /CF << /StdCF << /CFM /None >> >> /StmF /StdCF /StrF /StdCF >>", "", ""},
+		{"identity crypt filter on a stream", "<< " + standard + " /V 4 /StmF /Identity /StrF /Identity >>", pdfStream("/Filter /Crypt /DecodeParms << /Name /Identity >>", "BT /F1 12 Tf (one) Tj ET"), ""},
+		{"public key", "<< /Filter /Adobe.PubSec /SubFilter /adbe.pkcs7.s5 /V 4 /CF << /DefaultCryptFilter << /CFM /AESV2 >> >> /StmF /DefaultCryptFilter /StrF /DefaultCryptFilter /Recipients [<3082>] >>", "", "Unsupported security handler /Adobe.PubSec"},
+		{"rc4", "<< " + standard + " /V 2 >>", "", "Unsupported encryption /V 2"},
+		{"aes", "<< " + standard + " /V 4 /CF << /StdCF << /CFM /AESV2 /Length 16 >> >> /StmF /StdCF /StrF /StdCF >>", "", "Unsupported crypt filter /StdCF (/AESV2) for /StmF"},
+		{"missing crypt filter", "<< " + standard + " /V 4 /StmF /StdCF /StrF /StdCF >>", "", "Crypt filter /StdCF not found"},
+		{"other crypt filter on a stream", "<< " + standard + " /V 4 /StmF /Identity /StrF /Identity >>", pdfStream("/Filter /Crypt /DecodeParms << /Name /MyFilter >>", "BT /F1 12 Tf (one) Tj ET"), "Unsupported crypt filter /MyFilter"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			if test.content != "" {
+				objs[11] = test.content
+			}
+			data := encryptedPdf(objs, test.encrypt)
+
+			// The structure of the document can be read, but not the content of an encrypted document
+			importer := newTestImporter(t, data)
+			if n := importer.GetNumPages(); n != 1 {
+				t.Errorf("got %d pages, want 1", n)
+			}
+			content, err := importer.GetPageContentStream(1)
+			validateErr := ValidateStream(bytes.NewReader(data))
+
+			if test.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(content) != "BT /F1 12 Tf (one) Tj ET" {
+					t.Errorf("got content %q", content)
+				}
+				if validateErr != nil {
+					t.Errorf("ValidateStream: %v", validateErr)
+				}
+				return
+			}
+
+			if errors.Cause(err) != ErrEncrypted || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want ErrEncrypted with %s", err, test.want)
+			}
+
+			// A crypt filter on a stream is only found when the stream is decoded
+			if test.content == "" && (errors.Cause(validateErr) != ErrEncrypted || !strings.Contains(validateErr.Error(), test.want)) {
+				t.Errorf("ValidateStream: got error %v, want ErrEncrypted with %s", validateErr, test.want)
+			}
+		})
+	}
+}
+
+// The metadata stream can be read from an encrypted document if it is not encrypted with the document
+func TestGetMetadata(t *testing.T) {
+	const xmp = `<?xpacket begin=""?><x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta><?xpacket end="r"?>`
+	const aes = "/Filter /Standard /R 4 /Length 128 /O <00> /U <00> /P -4 /V 4 /CF << /StdCF << /CFM /AESV2 /Length 16 >> >> /StmF /StdCF /StrF /StdCF"
+
+	tests := []struct {
+		name    string
+		encrypt string // The /Encrypt dictionary, or empty if the document is not encrypted
+		fails   bool
+	}{
+		{"not encrypted", "", false},
+		{"encrypted metadata", "<< " + aes + " >>", true},
+		{"unencrypted metadata", "<< " + aes + " /EncryptMetadata false >>", false},
+		{"explicitly encrypted metadata", "<< " + aes + " /EncryptMetadata true >>", true},
+		{"unencrypted metadata before /V 4", "<< /Filter /Standard /R 2 /O <00> /U <00> /P -4 /V 1 /EncryptMetadata false >>", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			objs[1] = "<< /Type /Catalog /Pages 2 0 R /Metadata 5 0 R >>"
+			objs[5] = pdfStream("/Type /Metadata /Subtype /XML", xmp)
+			data := buildPdf(objs)
+			if test.encrypt != "" {
+				data = encryptedPdf(objs, test.encrypt)
+			}
+
+			metadata, err := newTestImporter(t, data).GetMetadata()
+			if test.fails {
+				if errors.Cause(err) != ErrEncrypted {
+					t.Errorf("got error %v, want ErrEncrypted", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(metadata) != xmp {
+				t.Errorf("got metadata %q, want %q", metadata, xmp)
+			}
+		})
+	}
+
+	// A document without metadata has none
+	metadata, err := newTestImporter(t, buildPdf(pagesPdf("BT ET"))).GetMetadata()
+	if metadata != nil || err != nil {
+		t.Errorf("got metadata %q and error %v, want none", metadata, err)
+	}
+}
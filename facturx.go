@@ -0,0 +1,67 @@
+package gofpdi
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Conventional names of the invoice XML attachment in Factur-X, ZUGFeRD and XRechnung pdfs
+var facturXNames = []string{"factur-x.xml", "zugferd-invoice.xml", "xrechnung.xml", "zugferd_invoice.xml"}
+
+// Guideline ids and the profile they identify.  Longer ids come first, because some ids are
+// a prefix of others (e.g. basic and basicwl).
+var facturXProfiles = []struct {
+	id      string
+	profile string
+}{
+	{"xrechnung", "XRECHNUNG"},
+	{"urn:factur-x.eu:1p0:minimum", "MINIMUM"},
+	{"urn:factur-x.eu:1p0:basicwl", "BASIC WL"},
+	{"urn:factur-x.eu:1p0:basic", "BASIC"},
+	{"urn:factur-x.eu:1p0:extended", "EXTENDED"},
+	{"urn:cen.eu:en16931:2017", "EN 16931"},
+	{"urn:ferd:crossindustrydocument:invoice:1p0:basic", "BASIC"},
+	{"urn:ferd:crossindustrydocument:invoice:1p0:comfort", "COMFORT"},
+	{"urn:ferd:crossindustrydocument:invoice:1p0:extended", "EXTENDED"},
+}
+
+// Matches the guideline id of the invoice, e.g. <ram:ID>urn:factur-x.eu:1p0:minimum</ram:ID>
+var facturXGuidelineRegexp = regexp.MustCompile(`GuidelineSpecifiedDocumentContextParameter>\s*<(?:[\w-]+:)?ID[^>]*>([^<]*)<`)
+
+// Find the invoice XML attachment of a Factur-X/ZUGFeRD/XRechnung pdf.
+// Returns the XML and the profile (e.g. BASIC, EN 16931, EXTENDED), or an empty profile if it is not recognized.
+func (this *Importer) GetFacturXXML() ([]byte, string, error) {
+	attachments, err := this.GetAttachments()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Failed to get attachments")
+	}
+
+	for _, attachment := range attachments {
+		if !in_array(strings.ToLower(attachment.Name), facturXNames) {
+			continue
+		}
+
+		return attachment.Data, facturXProfile(attachment.Data), nil
+	}
+
+	return nil, "", errors.New("No Factur-X or ZUGFeRD invoice attachment found")
+}
+
+// Detect the profile of an invoice from its guideline id
+func facturXProfile(xml []byte) string {
+	match := facturXGuidelineRegexp.FindSubmatch(xml)
+	if match == nil {
+		return ""
+	}
+
+	id := strings.ToLower(strings.TrimSpace(string(match[1])))
+	for _, p := range facturXProfiles {
+		if strings.Contains(id, p.id) {
+			return p.profile
+		}
+	}
+
+	return ""
+}
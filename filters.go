@@ -0,0 +1,463 @@
+package gofpdi
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Decoders for stream filters by filter name.  parms is the /DecodeParms dictionary of the filter,
+// or nil if it has none.  Decoders that expand data stop with ErrResourceLimit when the output
+// exceeds maxSize bytes, unless maxSize is 0.
+var streamDecoders = map[string]func(data []byte, parms *PdfValue, maxSize int) ([]byte, error){
+	"/FlateDecode": func(data []byte, parms *PdfValue, maxSize int) ([]byte, error) {
+		data, err := flateDecode(data, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		return applyPredictor(data, parms)
+	},
+	"/LZWDecode": func(data []byte, parms *PdfValue, maxSize int) ([]byte, error) {
+		data, err := lzwDecode(data, decodeParm(parms, "/EarlyChange", 1), maxSize)
+		if err != nil {
+			return nil, err
+		}
+		return applyPredictor(data, parms)
+	},
+	"/ASCII85Decode": func(data []byte, parms *PdfValue, maxSize int) ([]byte, error) {
+		return ascii85Decode(data, maxSize)
+	},
+	"/ASCIIHexDecode": func(data []byte, parms *PdfValue, maxSize int) ([]byte, error) {
+		return asciiHexDecode(data)
+	},
+	"/RunLengthDecode": func(data []byte, parms *PdfValue, maxSize int) ([]byte, error) {
+		return runLengthDecode(data, maxSize)
+	},
+	"/Crypt": func(data []byte, parms *PdfValue, maxSize int) ([]byte, error) {
+		// Only the /Identity crypt filter, which does not change the data, is supported
+		if parms != nil {
+			if name, ok := parms.Dictionary["/Name"]; ok && name.Token != "/Identity" {
+				return nil, errors.Wrap(ErrEncrypted, "Unsupported crypt filter "+name.Token)
+			}
+		}
+		return data, nil
+	},
+}
+
+// Error for decoded data that exceeds maxSize
+func decodedSizeError(maxSize int) error {
+	return errors.Wrap(ErrResourceLimit, fmt.Sprintf("Decoded stream is larger than %d bytes", maxSize))
+}
+
+// Filters that have /DecodeParms
+var parmFilters = []string{"/FlateDecode", "/LZWDecode", "/CCITTFaxDecode", "/JBIG2Decode", "/DCTDecode", "/Crypt"}
+
+// Get the filters of a stream and their /DecodeParms.  The parms slice has the same length as the
+// filters slice, with nil for filters without parameters.
+func (this *PdfReader) getStreamFilters(dict *PdfValue) ([]*PdfValue, []*PdfValue, error) {
+	filters := make([]*PdfValue, 0)
+	parms := make([]*PdfValue, 0)
+
+	if dict == nil {
+		return filters, parms, nil
+	}
+
+	if filter, ok := dict.Dictionary["/Filter"]; ok {
+		// If filter type is a reference, resolve it
+		filter, err := this.resolveValue(filter)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Failed to resolve filter")
+		}
+
+		if filter.Type == PDF_TYPE_TOKEN {
+			// If filter type is a token (e.g. FlateDecode), append it to filters slice
+			filters = append(filters, filter)
+		} else if filter.Type == PDF_TYPE_ARRAY {
+			// If filter type is an array, then there are multiple filters
+			for _, f := range filter.Array {
+				f, err = this.resolveValue(f)
+				if err != nil {
+					return nil, nil, errors.Wrap(err, "Failed to resolve filter")
+				}
+				filters = append(filters, f)
+			}
+		}
+	}
+
+	parms = make([]*PdfValue, len(filters))
+
+	if parm, ok := dict.Dictionary["/DecodeParms"]; ok {
+		parm, err := this.resolveValue(parm)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Failed to resolve decode parms")
+		}
+
+		if parm.Type == PDF_TYPE_DICTIONARY && len(parms) > 0 {
+			// A single dictionary for several filters is invalid, but commonly meant for the filter
+			// that takes parameters (e.g. the /FlateDecode of [/ASCII85Decode /FlateDecode])
+			parms[0] = parm
+			for i := 0; i < len(filters); i++ {
+				if in_array(filters[i].Token, parmFilters) {
+					parms[0] = nil
+					parms[i] = parm
+					break
+				}
+			}
+		} else if parm.Type == PDF_TYPE_ARRAY {
+			// One entry for each filter, which may be null
+			for i := 0; i < len(parm.Array) && i < len(parms); i++ {
+				p, err := this.resolveValue(parm.Array[i])
+				if err != nil {
+					return nil, nil, errors.Wrap(err, "Failed to resolve decode parms")
+				}
+				if p.Type == PDF_TYPE_DICTIONARY {
+					parms[i] = p
+				}
+			}
+		}
+	}
+
+	return filters, parms, nil
+}
+
+// Image filters are not decoded, because their data is an image file format (e.g. a JPEG file
+// for /DCTDecode).  Decoding stops at the first image filter and the data is returned as it is.
+var imageFilters = []string{"/DCTDecode", "/JPXDecode", "/JBIG2Decode", "/CCITTFaxDecode"}
+
+// Decode stream data by applying each filter in the order in which they are specified.
+// parms has the /DecodeParms dictionary for each filter, or nil.
+func (this *PdfReader) decodeStream(data []byte, filters []*PdfValue, parms []*PdfValue) ([]byte, error) {
+	data, _, err := this.decodeStreamToImage(data, filters, parms)
+	return data, err
+}
+
+// Like decodeStream, but also return the image filter at which decoding stopped, or an empty string
+// if the data was decoded completely
+func (this *PdfReader) decodeStreamToImage(data []byte, filters []*PdfValue, parms []*PdfValue) ([]byte, string, error) {
+	var err error
+
+	for i := 0; i < len(filters); i++ {
+		if in_array(filters[i].Token, imageFilters) {
+			return data, filters[i].Token, nil
+		}
+
+		decoder, ok := streamDecoders[filters[i].Token]
+		if !ok && this.unknownFilter != nil {
+			// Let the handler decode filters that are not supported
+			data, err = this.unknownFilter(filters[i].Token, data)
+			if err == nil && this.limits.MaxStreamSize > 0 && len(data) > this.limits.MaxStreamSize {
+				err = decodedSizeError(this.limits.MaxStreamSize)
+			}
+		} else if !ok {
+			return nil, "", errors.New("Unspported filter: " + filters[i].Token)
+		} else {
+			var parm *PdfValue
+			if i < len(parms) {
+				parm = parms[i]
+			}
+
+			data, err = decoder(data, parm, this.limits.MaxStreamSize)
+		}
+		if err != nil {
+			return nil, "", errors.Wrap(err, "Failed to decode "+filters[i].Token)
+		}
+
+		if this.trace != nil {
+			this.trace("filter", filters[i].Token)
+		}
+	}
+
+	return data, "", nil
+}
+
+// Get an integer entry of a /DecodeParms dictionary, or def if it is not set
+func decodeParm(parms *PdfValue, key string, def int) int {
+	if parms == nil {
+		return def
+	}
+
+	if v, ok := parms.Dictionary[key]; ok && v.Type == PDF_TYPE_NUMERIC {
+		return v.Int
+	}
+
+	return def
+}
+
+// Decode /FlateDecode data.  Data after a corrupt or truncated part of the stream is ignored.
+func flateDecode(data []byte, maxSize int) ([]byte, error) {
+	zlibReader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "zlib.NewReader error")
+	}
+	defer zlibReader.Close()
+
+	var out bytes.Buffer
+	if maxSize > 0 {
+		// Read one byte more than allowed to detect data that is too large
+		io.Copy(&out, io.LimitReader(zlibReader, int64(maxSize)+1))
+		if out.Len() > maxSize {
+			return nil, decodedSizeError(maxSize)
+		}
+	} else {
+		io.Copy(&out, zlibReader)
+	}
+
+	return out.Bytes(), nil
+}
+
+// Undo the TIFF or PNG predictor of /FlateDecode or /LZWDecode data
+func applyPredictor(data []byte, parms *PdfValue) ([]byte, error) {
+	predictor := decodeParm(parms, "/Predictor", 1)
+	if predictor <= 1 {
+		return data, nil
+	}
+
+	colors := decodeParm(parms, "/Colors", 1)
+	bpc := decodeParm(parms, "/BitsPerComponent", 8)
+	columns := decodeParm(parms, "/Columns", 1)
+
+	if colors < 1 || bpc < 1 || columns < 1 {
+		return nil, errors.New("Invalid /DecodeParms")
+	}
+
+	// Bytes per pixel (at least 1) and bytes per row
+	bpp := (colors*bpc + 7) / 8
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	if predictor == 2 {
+		// TIFF predictor: each byte is the difference to the byte of the previous pixel
+		if bpc != 8 {
+			return nil, errors.New(fmt.Sprintf("Unsupported TIFF predictor with %d bits per component", bpc))
+		}
+		for start := 0; start < len(data); start += rowLen {
+			end := start + rowLen
+			if end > len(data) {
+				end = len(data)
+			}
+			for i := start + bpp; i < end; i++ {
+				data[i] += data[i-bpp]
+			}
+		}
+		return data, nil
+	}
+
+	// PNG predictors: each row starts with a byte with the PNG filter type of the row
+	out := make([]byte, 0, len(data)/(rowLen+1)*rowLen)
+	prev := make([]byte, rowLen)
+
+	for pos := 0; pos < len(data); pos += rowLen + 1 {
+		filterType := data[pos]
+
+		row := make([]byte, rowLen)
+		copy(row, data[pos+1:])
+
+		switch filterType {
+		case 0:
+			// None
+		case 1:
+			// Sub
+			for i := bpp; i < rowLen; i++ {
+				row[i] += row[i-bpp]
+			}
+		case 2:
+			// Up
+			for i := 0; i < rowLen; i++ {
+				row[i] += prev[i]
+			}
+		case 3:
+			// Average
+			for i := 0; i < rowLen; i++ {
+				left := 0
+				if i >= bpp {
+					left = int(row[i-bpp])
+				}
+				row[i] += byte((left + int(prev[i])) / 2)
+			}
+		case 4:
+			// Paeth
+			filterPaeth(row, prev, bpp)
+		default:
+			return nil, errors.New(fmt.Sprintf("Unsupported PNG filter type %d", filterType))
+		}
+
+		out = append(out, row...)
+		prev = row
+	}
+
+	return out, nil
+}
+
+// Decode /LZWDecode data.  If earlyChange is 1 (the default in pdf), the code length is increased
+// one code early.
+func lzwDecode(data []byte, earlyChange int, maxSize int) ([]byte, error) {
+	var out bytes.Buffer
+
+	// Codes 256 and 257 are the clear table and end of data markers
+	table := make([][]byte, 258, 4096)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+
+	codeLen := 9
+	var prev []byte
+	var bitBuf uint32
+	bitCnt := 0
+	pos := 0
+
+	for {
+		// Read the next code, most significant bit first
+		for bitCnt < codeLen {
+			if pos >= len(data) {
+				return out.Bytes(), nil
+			}
+			bitBuf = bitBuf<<8 | uint32(data[pos])
+			pos++
+			bitCnt += 8
+		}
+		code := int(bitBuf>>uint(bitCnt-codeLen)) & (1<<uint(codeLen) - 1)
+		bitCnt -= codeLen
+
+		if code == 256 {
+			table = table[:258]
+			codeLen = 9
+			prev = nil
+			continue
+		}
+		if code == 257 {
+			return out.Bytes(), nil
+		}
+
+		var entry []byte
+		if code < len(table) && table[code] != nil {
+			entry = table[code]
+		} else if code == len(table) && prev != nil {
+			// The code that is about to be added to the table
+			entry = append(append([]byte{}, prev...), prev[0])
+		} else {
+			return nil, errors.New("Invalid LZW code")
+		}
+
+		out.Write(entry)
+		if maxSize > 0 && out.Len() > maxSize {
+			return nil, decodedSizeError(maxSize)
+		}
+
+		if prev != nil && len(table) < 4096 {
+			newEntry := make([]byte, len(prev)+1)
+			copy(newEntry, prev)
+			newEntry[len(prev)] = entry[0]
+			table = append(table, newEntry)
+		}
+		prev = entry
+
+		if len(table)+earlyChange >= 1<<uint(codeLen) && codeLen < 12 {
+			codeLen++
+		}
+	}
+}
+
+// Decode /ASCII85Decode data
+func ascii85Decode(data []byte, maxSize int) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+
+	// Data ends at the ~> marker
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+
+	// The z shorthand expands to 4 bytes, so the size of the output is not known in advance
+	src := bytes.NewReader(data)
+	decoder := ascii85.NewDecoder(src)
+
+	var out bytes.Buffer
+	var err error
+	if maxSize > 0 {
+		// Read one byte more than allowed to detect data that is too large
+		_, err = io.Copy(&out, io.LimitReader(decoder, int64(maxSize)+1))
+		if err == nil && out.Len() > maxSize {
+			return nil, decodedSizeError(maxSize)
+		}
+	} else {
+		_, err = io.Copy(&out, decoder)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid ASCII85 data")
+	}
+	if src.Len() > 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid ASCII85 data: %d bytes were not decoded", src.Len()))
+	}
+
+	return out.Bytes(), nil
+}
+
+// Decode /ASCIIHexDecode data
+func asciiHexDecode(data []byte) ([]byte, error) {
+	h := make([]byte, 0, len(data))
+
+	for _, c := range data {
+		// Data ends at the > marker
+		if c == '>' {
+			break
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0 {
+			continue
+		}
+		h = append(h, c)
+	}
+
+	// A missing last digit is 0
+	if len(h)%2 == 1 {
+		h = append(h, '0')
+	}
+
+	out := make([]byte, len(h)/2)
+	if _, err := hex.Decode(out, h); err != nil {
+		return nil, errors.Wrap(err, "Invalid ASCIIHex data")
+	}
+
+	return out, nil
+}
+
+// Decode /RunLengthDecode data
+func runLengthDecode(data []byte, maxSize int) ([]byte, error) {
+	var out bytes.Buffer
+
+	for i := 0; i < len(data); {
+		length := int(data[i])
+		i++
+
+		switch {
+		case length == 128:
+			// End of data
+			return out.Bytes(), nil
+
+		case length < 128:
+			// Copy the next length+1 bytes
+			if i+length+1 > len(data) {
+				return nil, errors.New("Invalid RunLength data")
+			}
+			out.Write(data[i : i+length+1])
+			i += length + 1
+
+		default:
+			// Repeat the next byte 257-length times
+			if i >= len(data) {
+				return nil, errors.New("Invalid RunLength data")
+			}
+			out.Write(bytes.Repeat(data[i:i+1], 257-length))
+			i++
+		}
+
+		if maxSize > 0 && out.Len() > maxSize {
+			return nil, decodedSizeError(maxSize)
+		}
+	}
+
+	return out.Bytes(), nil
+}
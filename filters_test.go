@@ -0,0 +1,430 @@
+package gofpdi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Encode data as ASCII85 with the end marker.  Groups of zero bytes are encoded as z.
+func encodeAscii85(data []byte) []byte {
+	out := make([]byte, ascii85.MaxEncodedLen(len(data)))
+	return append(out[:ascii85.Encode(out, data)], "~>"...)
+}
+
+func TestAscii85Decode(t *testing.T) {
+	zeros := append(make([]byte, 40), "BT ET"...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int
+		want    []byte
+		fails   bool
+		limited bool
+	}{
+		{"text", encodeAscii85([]byte("BT /F1 12 Tf ET")), 0, []byte("BT /F1 12 Tf ET"), false, false},
+		{"z shorthand", encodeAscii85(zeros), 0, zeros, false, false},
+		{"z shorthand within limit", encodeAscii85(zeros), len(zeros), zeros, false, false},
+		{"z shorthand over limit", encodeAscii85(zeros), len(zeros) - 1, nil, true, true},
+		{"prefix and whitespace", append([]byte("<~"), bytes.Replace(encodeAscii85(zeros), []byte("z"), []byte("z\n"), -1)...), 0, zeros, false, false},
+		{"invalid character", []byte("87cURD{~>"), 0, nil, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ascii85Decode(test.data, test.maxSize)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %d bytes", len(got))
+				}
+				if test.limited && errors.Cause(err) != ErrResourceLimit {
+					t.Fatalf("expected ErrResourceLimit, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAscii85ContentStream(t *testing.T) {
+	content := string(encodeAscii85(append(make([]byte, 40), "BT ET"...)))
+	objs := pagesPdf("")
+	objs[11] = pdfStream("/Filter /ASCII85Decode", content)
+
+	reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildPdf(objs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reader.getContent(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 45 || got[40:] != "BT ET" {
+		t.Errorf("got %d bytes %q, want 45 bytes", len(got), got)
+	}
+}
+
+// Encode data as /LZWDecode data with an earlyChange of 0 or 1.  The table is not cleared, so the
+// data must be short enough for the table to not become full.
+func lzwEncode(data []byte, earlyChange int) []byte {
+	var out []byte
+	var bitBuf uint32
+	bitCnt := 0
+	codeLen := 9
+	write := func(code int) {
+		bitBuf = bitBuf<<uint(codeLen) | uint32(code)
+		bitCnt += codeLen
+		for bitCnt >= 8 {
+			out = append(out, byte(bitBuf>>uint(bitCnt-8)))
+			bitCnt -= 8
+		}
+	}
+
+	table := make(map[string]int, 0)
+	for i := 0; i < 256; i++ {
+		table[string([]byte{byte(i)})] = i
+	}
+	next := 258
+
+	// The decoder adds an entry for a code when it reads the next code, so it is one entry behind
+	write(256)
+	w := ""
+	for _, b := range data {
+		c := string([]byte{b})
+		if _, ok := table[w+c]; ok || w == "" {
+			w += c
+			continue
+		}
+		write(table[w])
+		table[w+c] = next
+		next++
+		if next-1+earlyChange >= 1<<uint(codeLen) && codeLen < 12 {
+			codeLen++
+		}
+		w = c
+	}
+	if w != "" {
+		write(table[w])
+		if next+earlyChange >= 1<<uint(codeLen) && codeLen < 12 {
+			codeLen++
+		}
+	}
+	write(257)
+	if bitCnt > 0 {
+		out = append(out, byte(bitBuf<<uint(8-bitCnt)))
+	}
+
+	return out
+}
+
+func TestLzwDecode(t *testing.T) {
+	// Text that makes the codes grow to 11 bits
+	var text bytes.Buffer
+	for i := 0; text.Len() < 6000; i++ {
+		fmt.Fprintf(&text, "%d 0 obj << /Type /Page /Index %d >> ", i, i*i)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		earlyChange int
+		maxSize     int
+		limited     bool
+	}{
+		{"short", []byte("BT /F1 12 Tf (abababababab) Tj ET"), 1, 0, false},
+		{"binary", []byte{0, 255, 128, 255, 0, 255, 128, 255, 200, 1}, 1, 0, false},
+		{"long", text.Bytes(), 1, 0, false},
+		{"long without early change", text.Bytes(), 0, 0, false},
+		{"within limit", text.Bytes(), 1, text.Len(), false},
+		{"over limit", text.Bytes(), 1, text.Len() - 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := lzwDecode(lzwEncode(test.data, test.earlyChange), test.earlyChange, test.maxSize)
+			if test.limited {
+				if errors.Cause(err) != ErrResourceLimit {
+					t.Errorf("expected ErrResourceLimit, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, test.data) {
+				t.Errorf("got %d bytes, want %d bytes", len(got), len(test.data))
+			}
+		})
+	}
+}
+
+// Objects in an object stream that is not compressed with /FlateDecode, including the page tree
+func TestObjectStreamFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		encode func([]byte) []byte
+	}{
+		{"none", "", nil},
+		{"LZWDecode", "/LZWDecode", func(data []byte) []byte { return lzwEncode(data, 1) }},
+		{"ASCII85Decode", "/ASCII85Decode", encodeAscii85},
+		{"ASCIIHexDecode", "/ASCIIHexDecode", func(data []byte) []byte { return []byte(hex.EncodeToString(data) + ">") }},
+		{"FlateDecode", "/FlateDecode", deflate},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET")
+			compressed := map[int]string{1: objs[1], 2: objs[2], 3: objs[3], 10: objs[10], 12: objs[12]}
+			for id := range compressed {
+				delete(objs, id)
+			}
+
+			reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildObjStmPdf(objs, compressed, test.filter, test.encode)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := reader.getNumPages()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 2 {
+				t.Fatalf("got %d pages, want 2", n)
+			}
+			content, err := reader.getContent(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(content, "(two)") {
+				t.Errorf("got content %q of page 2", content)
+			}
+
+			// The font is read from the object stream when the page is imported
+			importer := newTestImporter(t, buildObjStmPdf(objs, compressed, test.filter, test.encode))
+			importer.ImportPage(1, "/MediaBox")
+			_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			font := false
+			for _, object := range objects {
+				font = font || bytes.Contains(object, []byte("/BaseFont /Helvetica"))
+			}
+			if !font {
+				t.Error("the font was not imported")
+			}
+		})
+	}
+}
+
+// The same filters are decoded for content streams, object streams and xref streams
+func TestDecodeStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		encode func([]byte) []byte
+	}{
+		{"flate", "/FlateDecode", deflate},
+		{"hex and flate", "[/ASCIIHexDecode /FlateDecode]", func(data []byte) []byte {
+			return []byte(hex.EncodeToString(deflate(data)) + ">")
+		}},
+		{"ascii85 and lzw", "[/ASCII85Decode /LZWDecode]", func(data []byte) []byte {
+			return encodeAscii85(lzwEncode(data, 1))
+		}},
+	}
+
+	content := "BT /F1 12 Tf 72 712 Td (Hello) Tj ET"
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// A content stream
+			objs := pagesPdf("")
+			objs[11] = pdfStream("/Filter "+test.filter, string(test.encode([]byte(content))))
+			got, err := newTestImporter(t, buildPdf(objs)).GetPageContentStream(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("content stream: got %q, want %q", got, content)
+			}
+
+			// An object stream with the page, listed in an xref stream
+			objs = pagesPdf(content)
+			compressed := map[int]string{1: objs[1], 2: objs[2], 10: objs[10]}
+			for id := range compressed {
+				delete(objs, id)
+			}
+			got, err = newTestImporter(t, buildObjStmPdf(objs, compressed, test.filter, test.encode)).GetPageContentStream(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("object stream: got %q, want %q", got, content)
+			}
+
+			// The filters decoded directly
+			reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildPdf(pagesPdf("BT ET"))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := bufio.NewReader(strings.NewReader(test.filter + " "))
+			token, err := reader.readToken(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter, err := reader.readValue(r, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filters := filter.Array
+			if filter.Type != PDF_TYPE_ARRAY {
+				filters = []*PdfValue{filter}
+			}
+			got, err = reader.decodeStream(test.encode([]byte(content)), filters, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("decodeStream: got %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+// Encode data with the PNG Up predictor (/Predictor 12) in rows of columns bytes
+func pngUpPredict(data []byte, columns int) []byte {
+	out := make([]byte, 0, len(data)+len(data)/columns+1)
+	prev := make([]byte, columns)
+	for i := 0; i < len(data); i += columns {
+		row := data[i:]
+		if len(row) > columns {
+			row = row[:columns]
+		}
+		out = append(out, 2)
+		for j, b := range row {
+			out = append(out, b-prev[j])
+		}
+		copy(prev, row)
+	}
+	return out
+}
+
+// The /DecodeParms of a filter chain are applied to the filter they belong to
+func TestDecodeParmsFilterChain(t *testing.T) {
+	// Rows of 8 bytes
+	content := "BT /F1 12 Tf 72 712 Td (Hello) Tj ET    "
+	predicted := deflate(pngUpPredict([]byte(content), 8))
+	parms := "<< /Predictor 12 /Columns 8 >>"
+
+	tests := []struct {
+		name  string
+		dict  string
+		data  []byte
+		fails bool
+	}{
+		{"ascii85 and flate", "/Filter [/ASCII85Decode /FlateDecode] /DecodeParms [null " + parms + "]", encodeAscii85(predicted), false},
+		{"hex and flate", "/Filter [/ASCIIHexDecode /FlateDecode] /DecodeParms [null " + parms + "]", []byte(hex.EncodeToString(predicted) + ">"), false},
+		{"single dictionary", "/Filter [/ASCII85Decode /FlateDecode] /DecodeParms " + parms, encodeAscii85(predicted), false},
+		{"flate", "/Filter /FlateDecode /DecodeParms " + parms, predicted, false},
+		{"flate in array", "/Filter [/FlateDecode] /DecodeParms [" + parms + "]", predicted, false},
+		{"parms for the wrong filter", "/Filter [/ASCII85Decode /FlateDecode] /DecodeParms [" + parms + " null]", encodeAscii85(predicted), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("")
+			objs[11] = pdfStream(test.dict, string(test.data))
+			importer := newTestImporter(t, buildPdf(objs))
+
+			got, err := importer.GetPageContentStream(1)
+			if test.fails {
+				if err == nil && string(got) == content {
+					t.Error("expected the parameters to not be applied")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("got %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+// Unsupported filters are decoded by the unknown filter handler
+func TestUnknownFilterHandler(t *testing.T) {
+	content := "BT /F1 12 Tf 72 712 Td (Hello) Tj ET"
+	reverse := func(data []byte) []byte {
+		reversed := make([]byte, len(data))
+		for i, b := range data {
+			reversed[len(data)-1-i] = b
+		}
+		return reversed
+	}
+
+	tests := []struct {
+		name    string
+		filter  string
+		data    []byte
+		handler func(name string, data []byte) ([]byte, error)
+		want    string // The error, or empty if the content is decoded
+	}{
+		{"no handler", "/ReverseDecode", reverse([]byte(content)), nil, "Unspported filter: /ReverseDecode"},
+		{"handler", "/ReverseDecode", reverse([]byte(content)), func(name string, data []byte) ([]byte, error) {
+			return reverse(data), nil
+		}, ""},
+		{"handler in a filter chain", "[/ReverseDecode /FlateDecode]", reverse(deflate([]byte(content))), func(name string, data []byte) ([]byte, error) {
+			return reverse(data), nil
+		}, ""},
+		{"handler error", "/ReverseDecode", reverse([]byte(content)), func(name string, data []byte) ([]byte, error) {
+			return nil, errors.New("Corrupt data")
+		}, "Failed to decode /ReverseDecode: Corrupt data"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("")
+			objs[11] = pdfStream("/Filter "+test.filter, string(test.data))
+
+			// The handler is only called for unsupported filters
+			var names []string
+			importer := newTestImporter(t, buildPdf(objs))
+			if test.handler != nil {
+				importer.SetUnknownFilterHandler(func(name string, data []byte) ([]byte, error) {
+					names = append(names, name)
+					return test.handler(name, data)
+				})
+			}
+
+			got, err := importer.GetPageContentStream(1)
+			if test.want != "" {
+				if err == nil || !strings.Contains(err.Error(), test.want) {
+					t.Errorf("got error %v, want %s", err, test.want)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if string(got) != content {
+				t.Errorf("got content %q, want %q", got, content)
+			}
+
+			if test.handler != nil && (len(names) != 1 || names[0] != "/ReverseDecode") {
+				t.Errorf("handler was called for %v, want /ReverseDecode", names)
+			}
+		})
+	}
+}
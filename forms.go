@@ -0,0 +1,329 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Get the interactive form dictionary (/AcroForm) of the catalog, or nil if there is none
+func (this *PdfReader) getAcroForm() (*PdfValue, error) {
+	if this.catalog == nil || this.catalog.Value == nil {
+		return nil, nil
+	}
+
+	acroForm, ok := this.catalog.Value.Dictionary["/AcroForm"]
+	if !ok {
+		return nil, nil
+	}
+
+	acroForm, err := this.resolveValue(acroForm)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve /AcroForm")
+	}
+	if acroForm.Type != PDF_TYPE_DICTIONARY {
+		return nil, nil
+	}
+
+	return acroForm, nil
+}
+
+// Count the form fields of the /AcroForm, including the kids of fields.  Kids without a name (/T)
+// are the widget annotations of their parent rather than fields, and are not counted.
+func (this *PdfReader) getFormFieldCount() (int, error) {
+	acroForm, err := this.getAcroForm()
+	if err != nil || acroForm == nil {
+		return 0, err
+	}
+
+	fields, ok := acroForm.Dictionary["/Fields"]
+	if !ok {
+		return 0, nil
+	}
+
+	return this.countFormFields(fields, make(map[int]bool, 0), 0)
+}
+
+// Count the fields of an array of fields and their kids.  seen has the ids of the fields that have
+// been counted, to guard against circular references.
+func (this *PdfReader) countFormFields(fields *PdfValue, seen map[int]bool, depth int) (int, error) {
+	if depth > 32 {
+		return 0, errors.New("Form field tree is too deep")
+	}
+
+	fields, err := this.resolveValue(fields)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to resolve form fields")
+	}
+
+	count := 0
+	for _, ref := range fields.Array {
+		if ref.Type == PDF_TYPE_OBJREF {
+			if seen[ref.Id] {
+				continue
+			}
+			seen[ref.Id] = true
+		}
+
+		field, err := this.resolveValue(ref)
+		if err != nil {
+			return 0, errors.Wrap(err, "Failed to resolve form field")
+		}
+		if field.Type != PDF_TYPE_DICTIONARY {
+			continue
+		}
+
+		// Top level fields are counted even without a name
+		if _, ok := field.Dictionary["/T"]; ok || depth == 0 {
+			count++
+		}
+
+		if kids, ok := field.Dictionary["/Kids"]; ok {
+			n, err := this.countFormFields(kids, seen, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			count += n
+		}
+	}
+
+	return count, nil
+}
+
+// Check if the current source document has an interactive form (/AcroForm) in its catalog
+func (this *Importer) HasAcroForm() (bool, error) {
+	acroForm, err := this.GetReader().getAcroForm()
+	if err != nil {
+		return false, err
+	}
+
+	return acroForm != nil, nil
+}
+
+// Get the number of form fields of the current source document, or 0 if it has no interactive form.
+// Fields are counted without importing any page.
+func (this *Importer) GetFormFieldCount() (int, error) {
+	return this.GetReader().getFormFieldCount()
+}
+
+// The appearance of a form field widget, to be drawn at the widget's /Rect when flattening
+type formAppearance struct {
+	Annot  *PdfValue  // Reference to the widget annotation
+	Stream *PdfValue  // Reference to the appearance stream of the widget's state
+	Matrix [6]float64 // Maps the appearance stream's /BBox to the widget's /Rect
+}
+
+// Get the appearances of the form field widgets of a page, as shown by a viewer.  Check boxes and
+// radio buttons have an appearance for each state in /AP /N, which is selected by /AS.  Hidden
+// widgets, and widgets without an appearance for their state, are left out.
+func (this *PdfReader) getPageFormAppearances(pageno int) ([]formAppearance, error) {
+	appearances := make([]formAppearance, 0)
+
+	annots, err := this.getPageAnnots(pageno)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range annots {
+		annot, err := this.resolveValue(ref)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to resolve annotation")
+		}
+		if subtype, ok := annot.Dictionary["/Subtype"]; !ok || subtype.Token != "/Widget" {
+			continue
+		}
+
+		// Hidden (2) and NoView (32) flags
+		if decodeParm(annot, "/F", 0)&(2|32) != 0 {
+			continue
+		}
+
+		ap, ok := annot.Dictionary["/AP"]
+		if !ok {
+			continue
+		}
+		ap, err = this.resolveValue(ap)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to resolve appearance dictionary")
+		}
+
+		stream, ok := ap.Dictionary["/N"]
+		if !ok {
+			continue
+		}
+		n, err := this.resolveValue(stream)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to resolve normal appearance")
+		}
+
+		// A dictionary has an appearance stream for each state (e.g. /Off and /Yes)
+		if n.Type == PDF_TYPE_DICTIONARY {
+			state, ok := annot.Dictionary["/AS"]
+			if !ok {
+				continue
+			}
+			if stream, ok = n.Dictionary[state.Token]; !ok || stream.Type != PDF_TYPE_OBJREF {
+				continue
+			}
+			if n, err = this.resolveValue(stream); err != nil {
+				return nil, errors.Wrap(err, "Failed to resolve appearance of state "+state.Token)
+			}
+		}
+		if n.Type != PDF_TYPE_STREAM || stream.Type != PDF_TYPE_OBJREF {
+			continue
+		}
+
+		rect, err := this.getNumbers(annot.Dictionary["/Rect"], 4)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid widget /Rect")
+		}
+		bbox, err := this.getNumbers(n.Value.Dictionary["/BBox"], 4)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid appearance /BBox")
+		}
+		matrix := [6]float64{1, 0, 0, 1, 0, 0}
+		if _, ok := n.Value.Dictionary["/Matrix"]; ok {
+			m, err := this.getNumbers(n.Value.Dictionary["/Matrix"], 6)
+			if err != nil {
+				return nil, errors.Wrap(err, "Invalid appearance /Matrix")
+			}
+			copy(matrix[:], m)
+		}
+
+		appearances = append(appearances, formAppearance{Annot: ref, Stream: stream, Matrix: appearanceMatrix(rect, bbox, matrix)})
+	}
+
+	return appearances, nil
+}
+
+// Get the matrix that maps the /BBox of an appearance stream, transformed by its /Matrix, to the
+// /Rect of its annotation (see "Appearance streams" in the pdf spec)
+func appearanceMatrix(rect []float64, bbox []float64, matrix [6]float64) [6]float64 {
+	// Transform the corners of the box and take their bounding box
+	llx, lly := math.Inf(1), math.Inf(1)
+	urx, ury := math.Inf(-1), math.Inf(-1)
+	for _, corner := range [][2]float64{{bbox[0], bbox[1]}, {bbox[0], bbox[3]}, {bbox[2], bbox[1]}, {bbox[2], bbox[3]}} {
+		x := matrix[0]*corner[0] + matrix[2]*corner[1] + matrix[4]
+		y := matrix[1]*corner[0] + matrix[3]*corner[1] + matrix[5]
+		llx, lly = math.Min(llx, x), math.Min(lly, y)
+		urx, ury = math.Max(urx, x), math.Max(ury, y)
+	}
+
+	sx, sy := 1.0, 1.0
+	if urx > llx {
+		sx = math.Abs(rect[2]-rect[0]) / (urx - llx)
+	}
+	if ury > lly {
+		sy = math.Abs(rect[3]-rect[1]) / (ury - lly)
+	}
+
+	return [6]float64{sx, 0, 0, sy, math.Min(rect[0], rect[2]) - llx*sx, math.Min(rect[1], rect[3]) - lly*sy}
+}
+
+// Get an array of n numbers
+func (this *PdfReader) getNumbers(value *PdfValue, n int) ([]float64, error) {
+	if value == nil {
+		return nil, errors.New("Missing array")
+	}
+
+	value, err := this.resolveValue(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve array")
+	}
+	if value.Type != PDF_TYPE_ARRAY || len(value.Array) < n {
+		return nil, errors.New(fmt.Sprintf("Expected an array of %d numbers", n))
+	}
+
+	result := make([]float64, n)
+	for i := 0; i < n; i++ {
+		v, err := this.resolveValue(value.Array[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to resolve array value")
+		}
+
+		switch v.Type {
+		case PDF_TYPE_NUMERIC:
+			result[i] = float64(v.Int)
+		case PDF_TYPE_REAL:
+			result[i] = v.Real
+		default:
+			return nil, errors.New("Array has a value that is not a number")
+		}
+	}
+
+	return result, nil
+}
+
+// Draw the appearances of the form field widgets of a page into the template content, so that the
+// fields are part of the page and can no longer be edited.  The widgets are not imported as
+// annotations.
+func (this *PdfWriter) flattenForms(reader *PdfReader, tpl *PdfTemplate, pageno int) error {
+	appearances, err := reader.getPageFormAppearances(pageno)
+	if err != nil || len(appearances) == 0 {
+		return err
+	}
+
+	if acroForm, err := reader.getAcroForm(); err == nil && acroForm != nil {
+		if v, ok := acroForm.Dictionary["/NeedAppearances"]; ok && v.Type == PDF_TYPE_BOOLEAN && v.Bool {
+			tpl.Warnings = append(tpl.Warnings, "Form sets /NeedAppearances; flattened fields may not show their current values")
+		}
+	}
+
+	// Copy the resources and their /XObject dictionary, which may be shared with other pages
+	resources := &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, len(tpl.Resources.Dictionary)+1)}
+	for k, v := range tpl.Resources.Dictionary {
+		resources.Dictionary[k] = v
+	}
+	xobjects := &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, 0)}
+	if v, ok := resources.Dictionary["/XObject"]; ok {
+		v, err = reader.resolveValue(v)
+		if err != nil {
+			return errors.Wrap(err, "Failed to resolve /XObject resources")
+		}
+		for k, x := range v.Dictionary {
+			xobjects.Dictionary[k] = x
+		}
+	}
+	resources.Dictionary["/XObject"] = xobjects
+
+	// Draw the appearances after the page content, in the order of the annotations
+	var content bytes.Buffer
+	content.WriteString("q\n")
+	content.WriteString(tpl.Buffer)
+	content.WriteString("\nQ\n")
+
+	flattened := make(map[int]bool, len(appearances))
+	for i, appearance := range appearances {
+		name := fmt.Sprintf("/GOFPDIFORM%d", i)
+		for n := 0; ; n++ {
+			if _, ok := xobjects.Dictionary[name]; !ok {
+				break
+			}
+			name = fmt.Sprintf("/GOFPDIFORM%d_%d", i, n)
+		}
+		xobjects.Dictionary[name] = appearance.Stream
+
+		m := appearance.Matrix
+		content.WriteString(fmt.Sprintf("q %.5F %.5F %.5F %.5F %.5F %.5F cm %s Do Q\n", m[0], m[1], m[2], m[3], m[4], m[5], name))
+
+		if appearance.Annot.Type == PDF_TYPE_OBJREF {
+			flattened[appearance.Annot.Id] = true
+		}
+	}
+
+	tpl.Resources = resources
+	tpl.Buffer = content.String()
+
+	// Leave the flattened widgets out of the imported annotations
+	annots := make([]*PdfValue, 0, len(tpl.Annots))
+	for _, annot := range tpl.Annots {
+		if annot.Type != PDF_TYPE_OBJREF || !flattened[annot.Id] {
+			annots = append(annots, annot)
+		}
+	}
+	tpl.Annots = annots
+
+	return nil
+}
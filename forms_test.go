@@ -0,0 +1,155 @@
+package gofpdi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Objects of a one page pdf with a form with a text field filled with value and a check box in state
+// (/Yes or /Off).  The widgets of both fields are annotations of the page.
+func formPdf(value string, state string) map[int]string {
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+	objs[1] = "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [20 0 R 21 0 R] /DA (/Helv 0 Tf 0 g) >> >>"
+	objs[10] = strings.Replace(objs[10], "/Contents", "/Annots [20 0 R 21 0 R] /Contents", 1)
+	objs[20] = fmt.Sprintf("<< /Type /Annot /Subtype /Widget /FT /Tx /T (name) /V (%s) /Rect [100 700 300 720] /P 10 0 R /AP << /N 22 0 R >> >>", value)
+	objs[21] = fmt.Sprintf("<< /Type /Annot /Subtype /Widget /FT /Btn /T (agree) /V %s /AS %s /Rect [100 650 120 670] /P 10 0 R /AP << /N << /Yes 23 0 R /Off 24 0 R >> >> >>", state, state)
+	objs[22] = pdfStream("/Type /XObject /Subtype /Form /BBox [0 0 200 20] /Resources << /Font << /Helv 3 0 R >> >>", fmt.Sprintf("/Tx BMC BT /Helv 12 Tf 2 5 Td (%s) Tj ET EMC", value))
+	objs[23] = pdfStream("/Type /XObject /Subtype /Form /BBox [0 0 20 20]", "0 g 2 2 16 16 re f % checked")
+	objs[24] = pdfStream("/Type /XObject /Subtype /Form /BBox [0 0 20 20]", "% unchecked")
+	return objs
+}
+
+func TestFormFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		objs    func() map[int]string
+		hasForm bool
+		fields  int
+	}{
+		{"no form", func() map[int]string {
+			return pagesPdf("BT ET")
+		}, false, 0},
+		{"form", func() map[int]string {
+			return formPdf("Jane Doe", "/Yes")
+		}, true, 2},
+		{"no fields", func() map[int]string {
+			objs := pagesPdf("BT ET")
+			objs[1] = "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] >> >>"
+			return objs
+		}, true, 0},
+		{"indirect form", func() map[int]string {
+			objs := formPdf("Jane Doe", "/Yes")
+			objs[1] = "<< /Type /Catalog /Pages 2 0 R /AcroForm 25 0 R >>"
+			objs[25] = "<< /Fields 26 0 R >>"
+			objs[26] = "[20 0 R 21 0 R]"
+			return objs
+		}, true, 2},
+		{"field hierarchy", func() map[int]string {
+			// Kids without a name are widgets, and the circular reference to the address is not followed
+			objs := pagesPdf("BT ET")
+			objs[1] = "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [30 0 R] >> >>"
+			objs[30] = "<< /T (address) /Kids [31 0 R 32 0 R] >>"
+			objs[31] = "<< /T (street) /FT /Tx /Parent 30 0 R >>"
+			objs[32] = "<< /T (country) /FT /Ch /Parent 30 0 R /Kids [33 0 R 34 0 R 30 0 R] >>"
+			objs[33] = "<< /Type /Annot /Subtype /Widget /Parent 32 0 R /Rect [0 0 10 10] >>"
+			objs[34] = "<< /Type /Annot /Subtype /Widget /Parent 32 0 R /Rect [0 20 10 30] >>"
+			return objs
+		}, true, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := newTestImporter(t, buildPdf(test.objs()))
+
+			hasForm, err := importer.HasAcroForm()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hasForm != test.hasForm {
+				t.Errorf("got HasAcroForm %v, want %v", hasForm, test.hasForm)
+			}
+
+			fields, err := importer.GetFormFieldCount()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fields != test.fields {
+				t.Errorf("got %d fields, want %d", fields, test.fields)
+			}
+		})
+	}
+}
+
+// Flattening draws the appearances of the filled in fields into the page content
+func TestFlattenForms(t *testing.T) {
+	refRegexp := regexp.MustCompile(`(/GOFPDIFORM\d+) (\d+) 0 R`)
+
+	tests := []struct {
+		state string
+		want  string // The appearance of the check box
+	}{
+		{"/Yes", "% checked"},
+		{"/Off", "% unchecked"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.state, func(t *testing.T) {
+			importer := newTestImporter(t, buildPdf(formPdf("Jane Doe", test.state)))
+			importer.SetImportAnnotations(true)
+			importer.SetFlattenForms(true)
+			tplid := importer.ImportPage(1, "/MediaBox")
+
+			_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The widgets are no longer annotations
+			annots, err := importer.GetTemplateAnnotations(tplid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(annots) != 0 {
+				t.Errorf("got %d annotations, want none", len(annots))
+			}
+
+			// The page content draws the appearance of each field at the /Rect of its widget
+			_, form := findObject(t, objects, "/GOFPDIFORM")
+			content := string(inflate(t, form))
+			if !strings.Contains(content, "BT /F1 12 Tf (one) Tj ET") {
+				t.Errorf("got content %q without the page content", content)
+			}
+
+			appearances := make(map[string]string)
+			for _, m := range refRegexp.FindAllSubmatch(form, -1) {
+				id, _ := strconv.Atoi(string(m[2]))
+				appearances[string(m[1])] = string(objects[id])
+			}
+			if len(appearances) != 2 {
+				t.Fatalf("got appearances %v, want 2", appearances)
+			}
+
+			for name, appearance := range appearances {
+				var want string
+				switch {
+				case strings.Contains(appearance, "(Jane Doe) Tj"):
+					want = "1.00000 0.00000 0.00000 1.00000 100.00000 700.00000 cm " + name + " Do"
+				case strings.Contains(appearance, test.want):
+					want = "1.00000 0.00000 0.00000 1.00000 100.00000 650.00000 cm " + name + " Do"
+				default:
+					t.Errorf("got appearance %s %q, want the filled in text field or %s", name, appearance, test.want)
+					continue
+				}
+				if !strings.Contains(content, want) {
+					t.Errorf("got content %q, want %s", content, want)
+				}
+			}
+
+			// The font of the text field is imported with its appearance
+			findObject(t, objects, "/BaseFont /Helvetica")
+		})
+	}
+}
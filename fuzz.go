@@ -0,0 +1,56 @@
+//go:build gofuzz
+// +build gofuzz
+
+package gofpdi
+
+import (
+	"bufio"
+	"bytes"
+)
+
+// Fuzz target for go-fuzz (github.com/dvyukov/go-fuzz).  The seed corpus is in fuzz/corpus.
+//
+//	go-fuzz-build github.com/phpdave11/gofpdi
+//	go-fuzz -bin gofpdi-fuzz.zip -workdir fuzz
+//
+// Malformed input must return an error, never panic or crash.  The readers use the default
+// resource limits, so that crashes that callers would hit with the defaults are found.
+func Fuzz(data []byte) int {
+	result := 0
+
+	// Parse the data as a sequence of values
+	parser, err := newPdfReaderFromStream("fuzz", bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	r := bufio.NewReader(bytes.NewReader(data))
+	for i := 0; i < 1000; i++ {
+		token, err := parser.readToken(r)
+		if err != nil || token == "" {
+			break
+		}
+		if _, err = parser.readValue(r, token); err != nil {
+			break
+		}
+		result = 1
+	}
+
+	// Parse the data as a pdf and import its first page
+	reader, err := newPdfReaderFromStream("fuzz", bytes.NewReader(data))
+	if err != nil {
+		return result
+	}
+	if err = reader.read(); err != nil {
+		return result
+	}
+
+	writer, _ := NewPdfWriter("")
+	if _, err = writer.ImportPage(reader, 1, "/MediaBox"); err != nil {
+		return result
+	}
+	if _, err = writer.PutFormXobjects(reader); err != nil {
+		return result
+	}
+
+	return 1
+}
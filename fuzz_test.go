@@ -0,0 +1,42 @@
+//go:build gofuzz
+// +build gofuzz
+
+package gofpdi
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run the fuzz target on the seed corpus and on inputs that crashed it before, so that it can be
+// checked without go-fuzz:
+//
+//	go test -tags gofuzz -run TestFuzz
+func TestFuzz(t *testing.T) {
+	inputs := map[string][]byte{
+		"nested arrays": []byte(strings.Repeat("[", 10*1024*1024)),
+		"nested catalog": buildPdf(map[int]string{
+			1: "<< /Type /Catalog /Pages " + strings.Repeat("[", 10*1024*1024) + " >>",
+		}),
+	}
+
+	files, err := filepath.Glob("fuzz/corpus/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs[file] = data
+	}
+
+	for name, data := range inputs {
+		t.Run(name, func(t *testing.T) {
+			Fuzz(data)
+		})
+	}
+}
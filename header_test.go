@@ -0,0 +1,93 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Read a pdf from data and check that it has the page of pagesPdf, and a warning about bytes before
+// the header if the header is used as the origin of offsets
+func checkHeaderOffset(t *testing.T, data []byte, warning string) {
+	importer := newTestImporter(t, data)
+	content, err := importer.GetPageContentStream(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "BT /F1 12 Tf (one) Tj ET" {
+		t.Errorf("got content %q", content)
+	}
+
+	warnings := strings.Join(importer.GetWarnings(), "\n")
+	if (warning == "" && strings.Contains(warnings, "before the %PDF header")) || !strings.Contains(warnings, warning) {
+		t.Errorf("got warnings %q, want %q", warnings, warning)
+	}
+
+	// Counting pages and validating use the same origin
+	if n, err := CountPagesFromStream(bytes.NewReader(data)); err != nil || n != 1 {
+		t.Errorf("CountPagesFromStream: got %d pages (%v), want 1", n, err)
+	}
+	if err := ValidateStream(bytes.NewReader(data)); err != nil {
+		t.Errorf("ValidateStream: %v", err)
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	data := buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET"))
+
+	// A byte order mark added to the file, which shifts the offsets
+	t.Run("added", func(t *testing.T) {
+		checkHeaderOffset(t, append([]byte("\xEF\xBB\xBF"), data...), "The file has 3 bytes before the %PDF header, which is used as the origin of offsets")
+	})
+
+	// A byte order mark written with the file, which the offsets include
+	t.Run("written", func(t *testing.T) {
+		checkHeaderOffset(t, bytes.Replace(data, []byte("%PDF-1.4\n"), []byte("\xEF\xBB\xBF%PDF-\n"), 1), "")
+	})
+}
+
+func TestJunkBeforeHeader(t *testing.T) {
+	offsetRegexp := regexp.MustCompile(`\d{10} 00000 n`)
+	data := buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET"))
+
+	tests := []struct {
+		name string
+		junk string
+	}{
+		{"100 bytes", strings.Repeat("junk\x00\xff\r\n\t ", 10)},
+		{"1000 bytes", strings.Repeat("x", 999) + "\n"},
+		{"mail headers", "From: someone@example.com\r\nContent-Type: application/pdf\r\n\r\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkHeaderOffset(t, append([]byte(test.junk), data...), fmt.Sprintf("The file has %d bytes before the %%PDF header, which is used as the origin of offsets", len(test.junk)))
+		})
+	}
+
+	// Acrobat also accepts a PostScript header that names the pdf version
+	t.Run("postscript header", func(t *testing.T) {
+		// The longer header moves the objects and the xref
+		header := "%!PS-Adobe-3.0 PDF-1.4\n"
+		shift := len(header) - len("%PDF-1.4\n")
+		ps := []byte(header + string(data[len("%PDF-1.4\n"):]))
+		ps = offsetRegexp.ReplaceAllFunc(ps, func(m []byte) []byte {
+			n, _ := strconv.Atoi(string(m[:10]))
+			return []byte(fmt.Sprintf("%010d%s", n+shift, m[10:]))
+		})
+		i := bytes.LastIndex(ps, []byte("startxref\n"))
+		var xref int
+		fmt.Sscanf(string(ps[i:]), "startxref\n%d", &xref)
+		ps = append(ps[:i], fmt.Sprintf("startxref\n%d\n%%%%EOF\n", xref+shift)...)
+
+		checkHeaderOffset(t, append([]byte(strings.Repeat("x", 100)+"\n"), ps...), "The file has 101 bytes before the %PDF header, which is used as the origin of offsets")
+	})
+
+	// Headers after the first 1024 bytes are not found
+	if _, err := NewPdfReaderFromStream("test", bytes.NewReader(append([]byte(strings.Repeat("x", 1100)), data...))); err == nil {
+		t.Error("expected an error for a header after 1024 bytes")
+	}
+}
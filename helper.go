@@ -1,7 +1,9 @@
 package gofpdi
 
 import (
+	"encoding/hex"
 	"strings"
+	"unicode/utf16"
 )
 
 // Determine if a value is numeric
@@ -13,11 +15,11 @@ func is_numeric(val interface{}) bool {
 		return true
 	case string:
 		str := val.(string)
+		// Trim any whitespace
+		str = strings.TrimSpace(str)
 		if str == "" {
 			return false
 		}
-		// Trim any whitespace
-		str = strings.TrimSpace(str)
 		//fmt.Println(str)
 		if str[0] == '-' || str[0] == '+' {
 			if len(str) == 1 {
@@ -57,6 +59,28 @@ func is_numeric(val interface{}) bool {
 	return false
 }
 
+// Determine if a token is a non-negative integer, as used for object numbers and generations
+func is_object_number(str string) bool {
+	if str == "" {
+		return false
+	}
+	for _, c := range str {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Read a big-endian unsigned integer of any size up to 8 bytes
+func readBigEndian(b []byte) int {
+	n := 0
+	for _, c := range b {
+		n = n<<8 | int(c)
+	}
+	return n
+}
+
 func in_array(needle interface{}, hystack interface{}) bool {
 	switch key := needle.(type) {
 	case string:
@@ -127,3 +151,138 @@ func filterPaeth(cdat, pdat []byte, bytesPerPixel int) {
 		}
 	}
 }
+
+// Decode a string value (literal or hex) to text.  Strings starting with a UTF-16BE byte order
+// mark are converted to UTF-8.
+func decode_pdf_string(value *PdfValue) string {
+	return decode_pdf_text(pdf_string_bytes(value))
+}
+
+// Get the bytes of a string value (literal or hex)
+func pdf_string_bytes(value *PdfValue) []byte {
+	var b []byte
+
+	if value.Type == PDF_TYPE_HEX {
+		h := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(" \t\r\n\f", r) {
+				return -1
+			}
+			return r
+		}, value.String)
+		if len(h)%2 == 1 {
+			h += "0"
+		}
+		b, _ = hex.DecodeString(h)
+	} else {
+		b = unescape_pdf_string(value.String)
+	}
+
+	return b
+}
+
+// Decode the bytes of a text string to UTF-8.  Text strings are UTF-16BE if they start with a
+// byte order mark, UTF-8 if they start with a UTF-8 byte order mark (PDF 2.0), and PDFDocEncoding
+// otherwise.
+func decode_pdf_text(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+
+	if len(b) >= 3 && b[0] == 0xef && b[1] == 0xbb && b[2] == 0xbf {
+		return string(b[3:])
+	}
+
+	r := make([]rune, len(b))
+	for i, c := range b {
+		if m, ok := pdfDocEncoding[c]; ok {
+			r[i] = m
+		} else {
+			// The other characters are the same as in ISO Latin-1
+			r[i] = rune(c)
+		}
+	}
+
+	return string(r)
+}
+
+// Characters of PDFDocEncoding that differ from ISO Latin-1
+var pdfDocEncoding = map[byte]rune{
+	0x18: '\u02d8', 0x19: '\u02c7', 0x1a: '\u02c6', 0x1b: '\u02d9', 0x1c: '\u02dd', 0x1d: '\u02db', 0x1e: '\u02da', 0x1f: '\u02dc',
+	0x80: '\u2022', 0x81: '\u2020', 0x82: '\u2021', 0x83: '\u2026', 0x84: '\u2014', 0x85: '\u2013', 0x86: '\u0192', 0x87: '\u2044',
+	0x88: '\u2039', 0x89: '\u203a', 0x8a: '\u2212', 0x8b: '\u2030', 0x8c: '\u201e', 0x8d: '\u201c', 0x8e: '\u201d', 0x8f: '\u2018',
+	0x90: '\u2019', 0x91: '\u201a', 0x92: '\u2122', 0x93: '\ufb01', 0x94: '\ufb02', 0x95: '\u0141', 0x96: '\u0152', 0x97: '\u0160',
+	0x98: '\u0178', 0x99: '\u017d', 0x9a: '\u0131', 0x9b: '\u0142', 0x9c: '\u0153', 0x9d: '\u0161', 0x9e: '\u017e', 0xa0: '\u20ac',
+}
+
+// Replace the escape sequences of a literal string (e.g. \n, \( or \053) with the bytes they represent
+func unescape_pdf_string(str string) []byte {
+	out := make([]byte, 0, len(str))
+
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c != '\\' || i+1 == len(str) {
+			out = append(out, c)
+			continue
+		}
+
+		i++
+		c = str[i]
+		switch c {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case '\r':
+			// Line continuation
+			if i+1 < len(str) && str[i+1] == '\n' {
+				i++
+			}
+		case '\n':
+			// Line continuation
+		default:
+			if c >= '0' && c <= '7' {
+				// Octal character code with up to 3 digits
+				n := 0
+				j := 0
+				for ; j < 3 && i+j < len(str) && str[i+j] >= '0' && str[i+j] <= '7'; j++ {
+					n = n*8 + int(str[i+j]-'0')
+				}
+				i += j - 1
+				out = append(out, byte(n))
+			} else {
+				out = append(out, c)
+			}
+		}
+	}
+
+	return out
+}
+
+// Decode a name token (e.g. /text#2Fxml) to text without the leading slash (e.g. text/xml)
+func decode_pdf_name(token string) string {
+	token = strings.TrimPrefix(token, "/")
+
+	out := make([]byte, 0, len(token))
+	for i := 0; i < len(token); i++ {
+		if token[i] == '#' && i+2 < len(token) {
+			if b, err := hex.DecodeString(token[i+1 : i+3]); err == nil {
+				out = append(out, b[0])
+				i += 2
+				continue
+			}
+		}
+		out = append(out, token[i])
+	}
+
+	return string(out)
+}
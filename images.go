@@ -0,0 +1,86 @@
+package gofpdi
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// An image used by a page
+type PageImage struct {
+	Name             string // Resource name (e.g. /Im1)
+	Width            int
+	Height           int
+	BitsPerComponent int
+	ColorSpace       string // Color space name (e.g. /DeviceRGB), or empty if it is not a name
+	Filter           string // Image filter that was not decoded (e.g. /DCTDecode), or empty if Data is raw samples
+	Data             []byte // Image data.  For /DCTDecode this is a JPEG file, for /JPXDecode a JPEG 2000 file.
+}
+
+// Get the images in the /XObject resources of a page.  Images inside form xobjects are not included.
+func (this *PdfReader) getPageImages(pageno int) ([]PageImage, error) {
+	images := make([]PageImage, 0)
+
+	resources, err := this.getPageResources(pageno)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get page resources")
+	}
+
+	xobjects, ok := resources.Dictionary["/XObject"]
+	if !ok {
+		return images, nil
+	}
+
+	xobjects, err = this.resolveValue(xobjects)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve xobject resources")
+	}
+
+	// Return images in the same order every time
+	names := make([]string, 0, len(xobjects.Dictionary))
+	for name := range xobjects.Dictionary {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		xobject, err := this.resolveValue(xobjects.Dictionary[name])
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to resolve xobject "+name)
+		}
+
+		if xobject.Type != PDF_TYPE_STREAM {
+			continue
+		}
+		if subtype, ok := xobject.Value.Dictionary["/Subtype"]; !ok || subtype.Token != "/Image" {
+			continue
+		}
+
+		if this.encryptErr != nil {
+			return nil, this.encryptErr
+		}
+
+		filters, parms, err := this.getStreamFilters(xobject.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to get stream filters of image "+name)
+		}
+
+		data, filter, err := this.decodeStreamToImage(xobject.Stream.Bytes, filters, parms)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Failed to decode image %s", name))
+		}
+
+		image := PageImage{Name: name, Filter: filter, Data: data}
+		image.Width = decodeParm(xobject.Value, "/Width", 0)
+		image.Height = decodeParm(xobject.Value, "/Height", 0)
+		image.BitsPerComponent = decodeParm(xobject.Value, "/BitsPerComponent", 0)
+		if cs, ok := xobject.Value.Dictionary["/ColorSpace"]; ok && cs.Type == PDF_TYPE_TOKEN {
+			image.ColorSpace = cs.Token
+		}
+
+		images = append(images, image)
+	}
+
+	return images, nil
+}
@@ -0,0 +1,158 @@
+package gofpdi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+// Image streams with filters that gofpdi does not decode are imported byte for byte
+func TestImportImagePassthrough(t *testing.T) {
+	// Every byte value, so that no byte is changed by the import
+	data := make([]byte, 0, 512)
+	for i := 0; i < 512; i++ {
+		data = append(data, byte(i*7))
+	}
+
+	tests := []struct {
+		name   string
+		filter string
+		extra  map[int]string
+	}{
+		{"CCITTFaxDecode", "/Filter /CCITTFaxDecode /DecodeParms << /K -1 /Columns 64 /Rows 64 /BlackIs1 true >>", nil},
+		{"JBIG2Decode", "/Filter /JBIG2Decode /DecodeParms << /JBIG2Globals 5 0 R >>", map[int]string{5: pdfStream("", "\x00\x01\x02globals\xff")}},
+		{"DCTDecode", "/Filter /DCTDecode", nil},
+		{"JPXDecode", "/Filter /JPXDecode", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("q 64 0 0 64 0 0 cm /Im1 Do Q")
+			objs[10] = strings.Replace(objs[10], "/Font <<", "/XObject << /Im1 4 0 R >> /Font <<", 1)
+			objs[4] = fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width 64 /Height 64 /BitsPerComponent 1 /ColorSpace /DeviceGray %s /Length %d >>\nstream\n%s\nendstream", test.filter, len(data), data)
+			for id, obj := range test.extra {
+				objs[id] = obj
+			}
+
+			importer := newTestImporter(t, buildPdf(objs))
+			importer.ImportPage(1, "/MediaBox")
+			_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, image := findObject(t, objects, "/Subtype /Image")
+			dict, got := splitStream(t, image)
+			if !bytes.Equal(got, data) {
+				t.Errorf("image data changed: got %d bytes, want %d", len(got), len(data))
+			}
+			if !strings.Contains(dict, "/Filter /"+test.name) {
+				t.Errorf("image dictionary %q has lost its filter", dict)
+			}
+
+			// The globals of a JBIG2 image are imported too
+			if test.extra != nil {
+				_, globals := findObject(t, objects, "globals")
+				if _, got := splitStream(t, globals); string(got) != "\x00\x01\x02globals\xff" {
+					t.Errorf("got JBIG2 globals %q", got)
+				}
+			}
+		})
+	}
+}
+
+// The /SMask of an image is imported, also if its object id is large, and the image references it
+func TestImportImageSMask(t *testing.T) {
+	tests := []struct {
+		name    string
+		smaskId int
+	}{
+		{"small id", 5},
+		{"large id", 12000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("q 2 0 0 2 0 0 cm /Im1 Do Q")
+			objs[10] = strings.Replace(objs[10], "/Font <<", "/XObject << /Im1 4 0 R >> /Font <<", 1)
+			objs[4] = pdfStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width 2 /Height 2 /BitsPerComponent 8 /ColorSpace /DeviceRGB /SMask %d 0 R", test.smaskId), "rgbrgbrgbrgb")
+			objs[test.smaskId] = pdfStream("/Type /XObject /Subtype /Image /Width 2 /Height 2 /BitsPerComponent 8 /ColorSpace /DeviceGray", "alph")
+
+			importer := newTestImporter(t, buildPdf(objs))
+			importer.ImportPage(1, "/MediaBox")
+			_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, image := findObject(t, objects, "/ColorSpace /DeviceRGB")
+			smaskId, smask := findObject(t, objects, "/ColorSpace /DeviceGray")
+			if _, data := splitStream(t, smask); string(data) != "alph" {
+				t.Errorf("got soft mask data %q", data)
+			}
+			if ref := fmt.Sprintf("/SMask %d 0 R", smaskId); !bytes.Contains(image, []byte(ref)) {
+				t.Errorf("image %q does not reference the soft mask with %s", image, ref)
+			}
+		})
+	}
+}
+
+// GetPageImages returns the JPEG file of a /DCTDecode image, after decoding the filters before it
+func TestGetPageImages(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 16, 8))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 2)
+	}
+	var jpegData bytes.Buffer
+	if err := jpeg.Encode(&jpegData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter string
+		data   []byte
+		want   []byte
+		result string // The filter that was not decoded
+	}{
+		{"DCTDecode", "/Filter /DCTDecode", jpegData.Bytes(), jpegData.Bytes(), "/DCTDecode"},
+		{"ASCIIHexDecode and DCTDecode", "/Filter [/ASCIIHexDecode /DCTDecode]", []byte(hex.EncodeToString(jpegData.Bytes()) + ">"), jpegData.Bytes(), "/DCTDecode"},
+		{"FlateDecode", "/Filter /FlateDecode", deflate(img.Pix), img.Pix, ""},
+		{"raw samples", "", img.Pix, img.Pix, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("q 16 0 0 8 0 0 cm /Im1 Do Q")
+			objs[10] = strings.Replace(objs[10], "/Font <<", "/XObject << /Im1 4 0 R >> /Font <<", 1)
+			objs[4] = fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width 16 /Height 8 /BitsPerComponent 8 /ColorSpace /DeviceGray %s /Length %d >>\nstream\n%s\nendstream", test.filter, len(test.data), test.data)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			images, err := importer.GetPageImages(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(images) != 1 {
+				t.Fatalf("got %d images, want 1", len(images))
+			}
+			got := images[0]
+			if got.Name != "/Im1" || got.Width != 16 || got.Height != 8 || got.BitsPerComponent != 8 || got.ColorSpace != "/DeviceGray" || got.Filter != test.result {
+				t.Errorf("got image %s %d x %d, %d bits %s, filter %q", got.Name, got.Width, got.Height, got.BitsPerComponent, got.ColorSpace, got.Filter)
+			}
+			if !bytes.Equal(got.Data, test.want) {
+				t.Errorf("got %d bytes of image data, want %d", len(got.Data), len(test.want))
+			}
+
+			// The data of a /DCTDecode image is a JPEG file
+			if test.result == "/DCTDecode" {
+				if _, err := jpeg.Decode(bytes.NewReader(got.Data)); err != nil {
+					t.Errorf("the image data is not a JPEG file: %v", err)
+				}
+			}
+		})
+	}
+}
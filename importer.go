@@ -3,6 +3,11 @@ package gofpdi
 import (
 	"fmt"
 	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // The Importer class to be used by a pdf generation library
@@ -14,6 +19,22 @@ type Importer struct {
 	tplN          int
 	writer        *PdfWriter
 	importedPages map[string]int
+	lazy          bool
+	tplPrefix     string
+	allocObjId    func() int
+	importAnnots  bool
+	boxes         []string
+	trace         func(event string, args ...interface{})
+	limits        ResourceLimits
+	bestEffort    bool
+	importStruct  bool
+	unknownFilter func(name string, data []byte) ([]byte, error)
+	flattenForms  bool
+	maxPageSize   float64
+	progress      func(done int, total int)
+	rewriter      func(pageno int, content []byte) ([]byte, error)
+	// Guards the maps and template counter for ImportPageFromFile
+	mu sync.Mutex
 }
 
 type TplInfo struct {
@@ -22,6 +43,12 @@ type TplInfo struct {
 	TemplateId int
 }
 
+// An imported object and its id, see GetImportedObjectsOrdered
+type ImportedObject struct {
+	ID   int
+	Data []byte
+}
+
 func (this *Importer) GetReader() *PdfReader {
 	return this.GetReaderForFile(this.sourceFile)
 }
@@ -61,55 +88,247 @@ func (this *Importer) init() {
 	this.importedPages = make(map[string]int, 0)
 }
 
+// Reset the importer to the state of a new importer, so that it can be reused without keeping the
+// templates and objects of earlier imports.  Options such as lazy mode are kept.  The files of
+// source files are closed.
+func (this *Importer) Reset() {
+	this.reset(false)
+}
+
+// Like Reset, but keep the parsed source files and streams, so that they are not parsed again
+// when they are set as source again
+func (this *Importer) ResetKeepReaders() {
+	this.reset(true)
+}
+
+func (this *Importer) reset(keepReaders bool) {
+	readers := this.readers
+	if !keepReaders {
+		for _, reader := range readers {
+			reader.Close()
+		}
+	}
+
+	this.sourceFile = ""
+	this.tplN = 0
+	this.init()
+
+	if keepReaders {
+		this.readers = readers
+	}
+}
+
+// In lazy mode, pages are only resolved when they are imported, and template content is released
+// after PutFormXobjects.  This keeps memory usage low for documents with many pages.
+// Must be called before setting the source file or stream.
+func (this *Importer) SetLazyMode(b bool) {
+	this.lazy = b
+}
+
+// Set the prefix of template names (default GOFPDITPL) for all writers of this importer, so that
+// templates from several importers can be used in the same output without name clashes
+func (this *Importer) SetTemplateNamePrefix(prefix string) {
+	this.tplPrefix = prefix
+	for _, writer := range this.writers {
+		writer.SetTemplateNamePrefix(prefix)
+	}
+}
+
+// Use fn to allocate object ids for all writers of this importer (see PdfWriter.SetObjectIdAllocator)
+func (this *Importer) SetObjectIdAllocator(fn func() int) {
+	this.allocObjId = fn
+	for _, writer := range this.writers {
+		writer.SetObjectIdAllocator(fn)
+	}
+}
+
+// Import the annotations of pages along with their appearance streams (see PdfWriter.SetImportAnnotations)
+func (this *Importer) SetImportAnnotations(b bool) {
+	this.importAnnots = b
+	for _, writer := range this.writers {
+		writer.SetImportAnnotations(b)
+	}
+}
+
+// Import the structure elements of tagged pages for all writers of this importer (see
+// PdfWriter.SetImportStructure).  The top elements of a template are returned by GetTemplateStructure.
+func (this *Importer) SetImportStructure(b bool) {
+	this.importStruct = b
+	for _, writer := range this.writers {
+		writer.SetImportStructure(b)
+	}
+}
+
+// Flatten the form fields of imported pages for all writers of this importer (see
+// PdfWriter.SetFlattenForms).  Must be set before importing pages.
+func (this *Importer) SetFlattenForms(b bool) {
+	this.flattenForms = b
+	for _, writer := range this.writers {
+		writer.SetFlattenForms(b)
+	}
+}
+
+// Set a function that rewrites the decoded content of imported pages for all writers of this
+// importer (see PdfWriter.SetContentRewriter).  Must be set before importing pages.
+func (this *Importer) SetContentRewriter(fn func(pageno int, content []byte) ([]byte, error)) {
+	this.rewriter = fn
+	for _, writer := range this.writers {
+		writer.SetContentRewriter(fn)
+	}
+}
+
+// Set the size above which imported pages get a template warning for all writers of this importer
+// (see PdfWriter.SetMaxPageSize)
+func (this *Importer) SetMaxPageSize(size float64) {
+	this.maxPageSize = size
+	for _, writer := range this.writers {
+		writer.SetMaxPageSize(size)
+	}
+}
+
+// Set a function that is called after each page that ImportPages and ImportAllPages import, with
+// the number of pages imported so far and the number of pages to import, e.g. to show progress
+// of long imports.  Pass nil to disable it.
+func (this *Importer) SetProgressFunc(fn func(done int, total int)) {
+	this.progress = fn
+}
+
+// Record recoverable problems as warnings instead of failing the import, for all writers of this
+// importer (see PdfWriter.SetBestEffort).  The warnings are returned by GetWarnings.  Problems
+// that prevent reading the document, such as a missing root or page tree, are still errors.
+func (this *Importer) SetBestEffort(b bool) {
+	this.bestEffort = b
+	for _, writer := range this.writers {
+		writer.SetBestEffort(b)
+	}
+}
+
+// Set the page boxes that are resolved for each page for all readers of this importer
+// (see PdfReader.SetAvailableBoxes)
+func (this *Importer) SetAvailableBoxes(boxes []string) {
+	this.boxes = boxes
+	for _, reader := range this.readers {
+		reader.SetAvailableBoxes(boxes)
+	}
+}
+
+// Trace parse events of all readers of this importer (see PdfReader.SetTraceFunc).
+// Must be called before setting the source file or stream to trace reading the xref and pages.
+func (this *Importer) SetTraceFunc(fn func(event string, args ...interface{})) {
+	this.trace = fn
+	for _, reader := range this.readers {
+		reader.SetTraceFunc(fn)
+	}
+}
+
+// Decode unsupported stream filters of all readers of this importer with fn
+// (see PdfReader.SetUnknownFilterHandler)
+func (this *Importer) SetUnknownFilterHandler(fn func(name string, data []byte) ([]byte, error)) {
+	this.unknownFilter = fn
+	for _, reader := range this.readers {
+		reader.SetUnknownFilterHandler(fn)
+	}
+}
+
+// Set the resource limits of readers created after this call (see PdfReader.SetResourceLimits)
+func (this *Importer) SetResourceLimits(limits ResourceLimits) {
+	this.limits = limits
+}
+
+// Apply importer options to a new reader and read the pdf
+func (this *Importer) readPdf(reader *PdfReader) error {
+	reader.SetLazyMode(this.lazy)
+	reader.SetResourceLimits(this.limits)
+	reader.SetTraceFunc(this.trace)
+	reader.SetUnknownFilterHandler(this.unknownFilter)
+	if this.boxes != nil {
+		reader.SetAvailableBoxes(this.boxes)
+	}
+
+	return reader.read()
+}
+
 func (this *Importer) SetSourceFile(f string) {
+	if err := this.setSourceFile(f); err != nil {
+		panic(err)
+	}
+}
+
+// Set the source file, creating a reader and writer for it if needed
+func (this *Importer) setSourceFile(f string) error {
 	this.sourceFile = f
 
 	// If reader hasn't been instantiated, do that now
 	if _, ok := this.readers[this.sourceFile]; !ok {
-		reader, err := NewPdfReader(this.sourceFile)
+		reader, err := newPdfReader(this.sourceFile)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if err = this.readPdf(reader); err != nil {
+			reader.Close()
+			return err
 		}
 		this.readers[this.sourceFile] = reader
 	}
 
-	// If writer hasn't been instantiated, do that now
-	if _, ok := this.writers[this.sourceFile]; !ok {
-		writer, err := NewPdfWriter("")
-		if err != nil {
-			panic(err)
-		}
+	return this.addWriter()
+}
 
-		// Make the next writer start template numbers at this.tplN
-		writer.SetTplIdOffset(this.tplN)
-		this.writers[this.sourceFile] = writer
+func (this *Importer) SetSourceStream(rs *io.ReadSeeker) {
+	if err := this.setSourceStream(fmt.Sprintf("%v", rs), *rs); err != nil {
+		panic(err)
 	}
 }
 
-func (this *Importer) SetSourceStream(rs *io.ReadSeeker) {
-	this.sourceFile = fmt.Sprintf("%v", rs)
+// Set the source stream, creating a reader and writer for it if needed.  name identifies the stream.
+func (this *Importer) setSourceStream(name string, rs io.ReadSeeker) error {
+	this.sourceFile = name
 
 	if _, ok := this.readers[this.sourceFile]; !ok {
-		reader, err := NewPdfReaderFromStream(this.sourceFile, *rs)
+		reader, err := newPdfReaderFromStream(this.sourceFile, rs)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if err = this.readPdf(reader); err != nil {
+			return err
 		}
 		this.readers[this.sourceFile] = reader
 	}
 
-	// If writer hasn't been instantiated, do that now
+	return this.addWriter()
+}
+
+// If writer hasn't been instantiated for the source file, do that now
+func (this *Importer) addWriter() error {
 	if _, ok := this.writers[this.sourceFile]; !ok {
 		writer, err := NewPdfWriter("")
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Make the next writer start template numbers at this.tplN
 		writer.SetTplIdOffset(this.tplN)
+		if this.tplPrefix != "" {
+			writer.SetTemplateNamePrefix(this.tplPrefix)
+		}
+		if this.allocObjId != nil {
+			writer.SetObjectIdAllocator(this.allocObjId)
+		}
+		writer.SetImportAnnotations(this.importAnnots)
+		writer.SetBestEffort(this.bestEffort)
+		writer.SetImportStructure(this.importStruct)
+		writer.SetFlattenForms(this.flattenForms)
+		writer.SetMaxPageSize(this.maxPageSize)
+		writer.SetContentRewriter(this.rewriter)
 		this.writers[this.sourceFile] = writer
 	}
+
+	return nil
 }
 
+// Get the number of pages of the current source.  In the default mode, the whole page tree is read
+// when the source is set.  In lazy mode (see SetLazyMode), only the /Count of the page tree root is
+// read, so this is fast for large documents.  CountPages gets the count without setting a source.
 func (this *Importer) GetNumPages() int {
 	result, err := this.GetReader().getNumPages()
 
@@ -130,31 +349,295 @@ func (this *Importer) GetPageSizes() map[int]map[string]map[string]float64 {
 	return result
 }
 
-func (this *Importer) ImportPage(pageno int, box string) int {
-	// If page has already been imported, return existing tplN
-	pageNameNumber := fmt.Sprintf("%s-%04d", this.sourceFile, pageno)
-	if _, ok := this.importedPages[pageNameNumber]; ok {
-		return this.importedPages[pageNameNumber]
+// Get the boxes that are defined for a page (directly or inherited from the page tree), without
+// substituting boxes that are not defined.  Unlike GetPageSizes, this tells a missing /CropBox apart
+// from a /CropBox that equals the /MediaBox.
+func (this *Importer) GetPageBoxesRaw(pageno int) (map[string]map[string]float64, error) {
+	boxes, err := this.GetReader().getPageBoxes(pageno, 1.0)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, box := range boxes {
+		if len(box) == 0 {
+			delete(boxes, name)
+		}
+	}
+
+	return boxes, nil
+}
+
+// Get the effective rotation of a page in degrees (0, 90, 180 or 270), including rotation
+// inherited from the page tree
+func (this *Importer) GetPageRotation(pageno int) (int, error) {
+	return this.GetReader().getNormalizedPageRotation(pageno)
+}
+
+// Get the content stream of a page with all filters decoded.  If the page has several content
+// streams, they are joined with newlines.
+func (this *Importer) GetPageContentStream(pageno int) ([]byte, error) {
+	content, err := this.GetReader().getContent(pageno)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(content), nil
+}
+
+// List all objects of the document with their id, type and location, for debugging malformed files
+func (this *Importer) ListObjects() ([]ObjectSummary, error) {
+	return this.GetReader().listObjects()
+}
+
+// Get an object of the current source document, serialized with its references kept as they are
+// (see PdfWriter.GetRawObject)
+func (this *Importer) GetRawObject(id int, gen int) ([]byte, error) {
+	return this.GetWriter().GetRawObject(this.GetReader(), id, gen)
+}
+
+// Get the ids of the objects in the source document that a page depends on (content, resources,
+// fonts, images and annotations), i.e. the objects that importing the page may copy
+func (this *Importer) GetPageDependencies(pageno int) ([]int, error) {
+	return this.GetReader().getPageDependencies(pageno)
+}
+
+// Plan the import of a page without importing it: count the objects it would write and their size,
+// e.g. to estimate the output size and memory before importing.  The structure tree and form
+// appearances (if imported or flattened) are not counted.
+func (this *Importer) PlanImport(pageno int, box string) (ImportPlan, error) {
+	reader := this.GetReader()
+
+	pageBoxes, err := reader.getPageBoxes(pageno, 1)
+	if err != nil {
+		return ImportPlan{}, errors.Wrap(err, "Failed to get page boxes")
+	}
+	if name, _ := resolveBoxWithFallback(pageBoxes, box); name == "" {
+		return ImportPlan{}, errors.New("Box not found: " + box)
 	}
 
-	res, err := this.GetWriter().ImportPage(this.GetReader(), pageno, box)
+	return reader.planImport(pageno, this.importAnnots && !this.flattenForms)
+}
+
+// Get the images used by a page, with JPEG and other image file data returned undecoded
+func (this *Importer) GetPageImages(pageno int) ([]PageImage, error) {
+	return this.GetReader().getPageImages(pageno)
+}
+
+func (this *Importer) ImportPage(pageno int, box string) int {
+	tplN, err := this.importPage(pageno, box, "")
 	if err != nil {
 		panic(err)
 	}
 
-	// Get current template id
-	tplN := this.tplN
+	return tplN
+}
 
-	// Set tpl info
-	this.tplMap[tplN] = &TplInfo{SourceFile: this.sourceFile, TemplateId: res, Writer: this.GetWriter()}
+// Import several pages of the current source document.  Returns the template ids in the order of
+// the page numbers.
+func (this *Importer) ImportPages(pagenos []int, box string) ([]int, error) {
+	tplids := make([]int, 0, len(pagenos))
 
-	// Increment template id
+	for i, pageno := range pagenos {
+		tplid, err := this.importPage(pageno, box, "")
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Failed to import page %d", pageno))
+		}
+		tplids = append(tplids, tplid)
+
+		if this.progress != nil {
+			this.progress(i+1, len(pagenos))
+		}
+	}
+
+	return tplids, nil
+}
+
+// Import all pages of the current source document.  Returns the template ids in page order.
+func (this *Importer) ImportAllPages(box string) ([]int, error) {
+	n, err := this.GetReader().getNumPages()
+	if err != nil {
+		return nil, err
+	}
+
+	pagenos := make([]int, n)
+	for i := range pagenos {
+		pagenos[i] = i + 1
+	}
+
+	return this.ImportPages(pagenos, box)
+}
+
+// Import a page sized and placed by box (e.g. /MediaBox), but clipped to clipBox (e.g. /TrimBox), so
+// that the /BBox of the template is clipBox.  If clipBox is not defined for the page, the box it
+// defaults to is used.
+func (this *Importer) ImportPageWithClipBox(pageno int, box string, clipBox string) (int, error) {
+	return this.importPage(pageno, box, clipBox)
+}
+
+// Import a region (llx, lly, urx, ury in the coordinates of the page) of a page, limited to box,
+// e.g. to crop a figure out of the page (see PdfWriter.ImportPageRegion)
+func (this *Importer) ImportPageRegion(pageno int, region [4]float64, box string) (int, error) {
+	reader, writer := this.GetReader(), this.GetWriter()
+	key := fmt.Sprintf("%s-%04d%s[%F %F %F %F]", this.sourceFile, pageno, box, region[0], region[1], region[2], region[3])
+
+	return this.importTemplate(key, this.sourceFile, writer, func() (int, error) {
+		return writer.ImportPageRegion(reader, pageno, region, box)
+	})
+}
+
+// Import the page with a page label (e.g. "iv" or "A-12"), see GetPageLabels.  Returns an error
+// if no page or more than one page has the label.
+func (this *Importer) ImportPageByLabel(label string, box string) (int, error) {
+	pageno, err := this.GetReader().getPageByLabel(label)
+	if err != nil {
+		return -1, err
+	}
+
+	return this.importPage(pageno, box, "")
+}
+
+// Get the label of each page of the current source document, indexed by page number - 1.
+// Pages without a label are labeled with their page number.
+func (this *Importer) GetPageLabels() ([]string, error) {
+	return this.GetReader().getPageLabels()
+}
+
+// Set the source file and import a page from it.  Templates imported from different files
+// are numbered sequentially, so they can be placed in the same output without name clashes.
+// Pages can be imported concurrently.  Imports from different files run in parallel, imports from
+// the same file one after the other.
+func (this *Importer) ImportPageFromFile(file string, pageno int, box string) (int, error) {
+	reader, writer, err := this.getReaderWriter(file)
+	if err != nil {
+		return -1, err
+	}
+
+	return this.importPageFrom(file, reader, writer, pageno, box, "")
+}
+
+// Set the source file and get its reader and writer.  The file is read without holding the lock,
+// so that different files can be read concurrently.
+func (this *Importer) getReaderWriter(file string) (*PdfReader, *PdfWriter, error) {
+	this.mu.Lock()
+	reader, ok := this.readers[file]
+	this.mu.Unlock()
+
+	if !ok {
+		var err error
+		reader, err = newPdfReader(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = this.readPdf(reader); err != nil {
+			reader.Close()
+			return nil, nil, err
+		}
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	// Another goroutine may have read the same file in the meantime
+	if existing, ok := this.readers[file]; ok {
+		reader = existing
+	} else {
+		this.readers[file] = reader
+	}
+
+	this.sourceFile = file
+	if err := this.addWriter(); err != nil {
+		return nil, nil, err
+	}
+
+	return reader, this.writers[file], nil
+}
+
+// Import a page from the current source and return its template id
+func (this *Importer) importPage(pageno int, box string, clipBox string) (int, error) {
+	return this.importPageFrom(this.sourceFile, this.GetReader(), this.GetWriter(), pageno, box, clipBox)
+}
+
+// Import a page with the reader and writer of a source and return its template id
+func (this *Importer) importPageFrom(source string, reader *PdfReader, writer *PdfWriter, pageno int, box string, clipBox string) (int, error) {
+	// If page has already been imported, return existing tplN.  A page that is clipped to another
+	// box is a different template.
+	pageNameNumber := fmt.Sprintf("%s-%04d", source, pageno)
+	if clipBox != "" && clipBox != box {
+		pageNameNumber += clipBox
+	}
+
+	return this.importTemplate(pageNameNumber, source, writer, func() (int, error) {
+		return writer.ImportPageWithClipBox(reader, pageno, box, clipBox)
+	})
+}
+
+// Import a template with a writer and return its template id.  The template is cached with key.
+func (this *Importer) importTemplate(pageNameNumber string, source string, writer *PdfWriter, importFn func() (int, error)) (int, error) {
+	this.mu.Lock()
+	if tplN, ok := this.importedPages[pageNameNumber]; ok {
+		this.mu.Unlock()
+		return tplN, nil
+	}
+	this.mu.Unlock()
+
+	// Imports with the same writer (and reader) are serialized, because the writer numbers its
+	// templates by its number of templates, and the reader reads from one file position.  Imports
+	// with different writers run concurrently.  The writer lock is always taken before the lock
+	// of the importer.
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	this.mu.Lock()
+
+	// Another goroutine may have imported the same page while waiting for the writer
+	if tplN, ok := this.importedPages[pageNameNumber]; ok {
+		this.mu.Unlock()
+		return tplN, nil
+	}
+
+	// Reserve the template id, so that a concurrent import from another source gets the next one
+	tplN := this.tplN
 	this.tplN++
 
+	// Make the writer name the new template after tplN.  Otherwise a writer that was created
+	// earlier could reuse a template name that another writer has already used.
+	writer.SetTplIdOffset(tplN - len(writer.tpls))
+	this.mu.Unlock()
+
+	res, err := importFn()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if err != nil {
+		// Give the template id back, unless another import has reserved one after it
+		if this.tplN == tplN+1 {
+			this.tplN--
+		}
+		return -1, err
+	}
+
+	// Set tpl info
+	this.tplMap[tplN] = &TplInfo{SourceFile: source, TemplateId: res, Writer: writer}
+
 	// Cache imported page tplN
 	this.importedPages[pageNameNumber] = tplN
 
-	return tplN
+	return tplN, nil
+}
+
+// Get the info of a template id (returned from ImportPage), or an error if the template does not
+// exist.  Templates can be imported concurrently (see ImportPageFromFile), so the template map is
+// only read with the lock held.
+func (this *Importer) getTplInfo(tplid int) (*TplInfo, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	tplInfo, ok := this.tplMap[tplid]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Template %d not found", tplid))
+	}
+	return tplInfo, nil
 }
 
 func (this *Importer) SetNextObjectID(objId int) {
@@ -171,6 +654,9 @@ func (this *Importer) PutFormXobjects() map[string]int {
 	for tplName, pdfObjId := range tplNamesIds {
 		res[tplName] = pdfObjId.id
 	}
+	if this.lazy {
+		this.GetWriter().releaseTemplates()
+	}
 	return res
 }
 
@@ -185,9 +671,156 @@ func (this *Importer) PutFormXobjectsUnordered() map[string]string {
 	for tplName, pdfObjId := range tplNamesIds {
 		res[tplName] = pdfObjId.hash
 	}
+	if this.lazy {
+		this.GetWriter().releaseTemplates()
+	}
 	return res
 }
 
+// Put form xobjects with object ids from alloc (e.g. the object counter of the pdf generation library),
+// so that the objects reference each other by their final ids and no hashes need to be replaced.
+// Returns the template names (e.g. /GOFPDITPL1) and their object ids, and the contents of the imported
+// objects by object id.  Each object can be appended to the output as "<id> 0 obj\n" and its contents.
+func (this *Importer) PutFormXobjectsWithIds(alloc func() int) (map[string]int, map[int][]byte, error) {
+	templates := make(map[string]int, 0)
+	objects := make(map[int][]byte, 0)
+
+	if err := this.putFormXobjectsWithIds(this.GetWriter(), this.GetReader(), alloc, templates, objects); err != nil {
+		return nil, nil, err
+	}
+
+	return templates, objects, nil
+}
+
+// Like PutFormXobjectsWithIds, for the templates of all sources instead of only the current source,
+// e.g. after ImportPagesFromZip, which sets each pdf in the archive as a source.  The sources are
+// written in the order of their names.
+func (this *Importer) PutAllFormXobjectsWithIds(alloc func() int) (map[string]int, map[int][]byte, error) {
+	templates := make(map[string]int, 0)
+	objects := make(map[int][]byte, 0)
+
+	sources := make([]string, 0, len(this.writers))
+	for source := range this.writers {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		if err := this.putFormXobjectsWithIds(this.writers[source], this.readers[source], alloc, templates, objects); err != nil {
+			return nil, nil, errors.Wrap(err, "Failed to put form xobjects of "+source)
+		}
+	}
+
+	return templates, objects, nil
+}
+
+// Put the form xobjects of a writer with object ids from alloc, and add the template names and
+// object ids to templates and the contents of the imported objects to objects
+func (this *Importer) putFormXobjectsWithIds(writer *PdfWriter, reader *PdfReader, alloc func() int, templates map[string]int, objects map[int][]byte) error {
+	writer.SetUseHash(false)
+	writer.SetObjectIdAllocator(alloc)
+	defer writer.SetObjectIdAllocator(this.allocObjId)
+
+	tplNamesIds, err := writer.PutFormXobjects(reader)
+	if err != nil {
+		return err
+	}
+	if this.lazy {
+		writer.releaseTemplates()
+	}
+
+	for tplName, pdfObjId := range tplNamesIds {
+		templates[tplName] = pdfObjId.id
+	}
+
+	// The objects are returned here, so they are not returned again by later calls
+	for pdfObjId, bytes := range writer.GetImportedObjects() {
+		objects[pdfObjId.id] = bytes
+	}
+	writer.ClearImportedObjects()
+
+	return nil
+}
+
+// Merge the resources of templates (returned from ImportPage) from the same source, to inline their
+// content (see GetTemplateContent) in one page.  Resources with the same name but different objects
+// are renamed, e.g. /F1 of the second template becomes /F1_1.  For each template, the renamed
+// resources are returned by category (e.g. "/Font": {"/F1": "/F1_1"}), and must be renamed in its
+// content.  The objects the resources depend on get ids from alloc, like with GetTemplateContent.
+func (this *Importer) MergeTemplateResources(tplids []int, alloc func() int) ([]byte, []map[string]map[string]string, map[int][]byte, error) {
+	if len(tplids) == 0 {
+		return nil, nil, nil, errors.New("No templates to merge")
+	}
+
+	var writer *PdfWriter
+	var source string
+	writerIds := make([]int, len(tplids))
+	for i, tplid := range tplids {
+		tplInfo, err := this.getTplInfo(tplid)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if writer != nil && tplInfo.Writer != writer {
+			return nil, nil, nil, errors.New("Templates must be imported from the same source to merge their resources")
+		}
+		writer = tplInfo.Writer
+		source = tplInfo.SourceFile
+		writerIds[i] = tplInfo.TemplateId
+	}
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	writer.SetUseHash(false)
+	writer.SetObjectIdAllocator(alloc)
+	defer writer.SetObjectIdAllocator(this.allocObjId)
+
+	resources, renamed, err := writer.MergeTemplateResources(this.GetReaderForFile(source), writerIds)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	objects := make(map[int][]byte, 0)
+	for pdfObjId, bytes := range writer.GetImportedObjects() {
+		objects[pdfObjId.id] = bytes
+	}
+	writer.ClearImportedObjects()
+
+	return resources, renamed, objects, nil
+}
+
+// For a given template id (returned from ImportPage), get the page content as operators to inline in a
+// page content stream instead of placing a form xobject, and the resources dictionary the operators use.
+// The caller merges the resources into the resources of its page (the names may clash with its own) and
+// sets the position and scale with a "cm" before the content.  The objects the resources depend on get
+// ids from alloc, and their contents are returned by object id, like with PutFormXobjectsWithIds.
+func (this *Importer) GetTemplateContent(tplid int, alloc func() int) ([]byte, []byte, map[int][]byte, error) {
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
+
+	writer := tplInfo.Writer
+	writer.SetUseHash(false)
+	writer.SetObjectIdAllocator(alloc)
+	defer writer.SetObjectIdAllocator(this.allocObjId)
+
+	content, resources, err := writer.GetTemplateContent(this.GetReaderForFile(tplInfo.SourceFile), tplInfo.TemplateId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	objects := make(map[int][]byte, 0)
+	for pdfObjId, bytes := range writer.GetImportedObjects() {
+		objects[pdfObjId.id] = bytes
+	}
+	writer.ClearImportedObjects()
+
+	return content, resources, objects, nil
+}
+
 // Get object ids (int) and their contents (string)
 func (this *Importer) GetImportedObjects() map[int]string {
 	res := make(map[int]string, 0)
@@ -198,6 +831,18 @@ func (this *Importer) GetImportedObjects() map[int]string {
 	return res
 }
 
+// Like GetImportedObjects, as a slice sorted by object id, so that the objects can be written in
+// a deterministic order
+func (this *Importer) GetImportedObjectsOrdered() []ImportedObject {
+	pdfObjIdBytes := this.GetWriter().GetImportedObjects()
+	res := make([]ImportedObject, 0, len(pdfObjIdBytes))
+	for pdfObjId, bytes := range pdfObjIdBytes {
+		res = append(res, ImportedObject{ID: pdfObjId.id, Data: bytes})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
 // Get object ids (sha1 hash) and their contents ([]byte)
 // The contents may have references to other object hashes which will need to be replaced by the pdf generator library
 // The positions of the hashes (sha1 - 40 characters) can be obtained by calling GetImportedObjHashPos()
@@ -221,10 +866,169 @@ func (this *Importer) GetImportedObjHashPos() map[string]map[int]string {
 	return res
 }
 
+// Get the document information of the current source document (e.g. Title, Author), with text
+// strings decoded to UTF-8
+func (this *Importer) GetInfo() (map[string]string, error) {
+	return this.GetReader().getInfo()
+}
+
+// Get the creation date of the current source document from its document information
+func (this *Importer) GetCreationDate() (time.Time, error) {
+	return this.GetReader().getInfoDate("CreationDate")
+}
+
+// Get the modification date of the current source document from its document information
+func (this *Importer) GetModDate() (time.Time, error) {
+	return this.GetReader().getInfoDate("ModDate")
+}
+
+// Get the natural language of the current source document (/Lang, e.g. en-US), or an empty string
+// if it has none
+func (this *Importer) GetLanguage() (string, error) {
+	lang, _, err := this.GetReader().getLanguage()
+	return lang, err
+}
+
+// Get the XMP metadata of the current source document, or nil if it has none.  The metadata can also
+// be read from documents that are encrypted with /EncryptMetadata false.
+func (this *Importer) GetMetadata() ([]byte, error) {
+	return this.GetReader().getMetadata()
+}
+
+// Get the files embedded in the current source document
+func (this *Importer) GetAttachments() ([]Attachment, error) {
+	return this.GetReader().getAttachments()
+}
+
+// For a given template id (returned from ImportPage), get the object ids of its imported annotations.
+// Only available after PutFormXobjects, if annotations are imported.
+func (this *Importer) GetTemplateAnnotations(tplid int) ([]int, error) {
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		return nil, err
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
+	res := make([]int, 0)
+	for _, pdfObjId := range tplInfo.Writer.tpls[tplInfo.TemplateId].AnnotObjIds {
+		res = append(res, pdfObjId.id)
+	}
+	return res, nil
+}
+
+// For a given template id (returned from ImportPage), get the object ids of the top structure elements
+// of its imported structure, to be added to the /K of the output's /StructTreeRoot.  The top elements
+// are written without /P.  Only available after PutFormXobjects, if the structure is imported.
+func (this *Importer) GetTemplateStructure(tplid int) ([]int, error) {
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		return nil, err
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
+	res := make([]int, 0)
+	for _, pdfObjId := range tplInfo.Writer.tpls[tplInfo.TemplateId].StructObjIds {
+		res = append(res, pdfObjId.id)
+	}
+	return res, nil
+}
+
+// For a given template id (returned from ImportPage), get the object ids (sha1 hash) of its imported
+// annotations.  Only available after PutFormXobjectsUnordered, if annotations are imported.
+func (this *Importer) GetTemplateAnnotationsUnordered(tplid int) ([]string, error) {
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		return nil, err
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
+	res := make([]string, 0)
+	for _, pdfObjId := range tplInfo.Writer.tpls[tplInfo.TemplateId].AnnotObjIds {
+		res = append(res, pdfObjId.hash)
+	}
+	return res, nil
+}
+
+// For a given template id (returned from ImportPage), set an extra transformation matrix
+// (see PdfTemplate.SetMatrix).  Must be called before PutFormXobjects.
+func (this *Importer) SetTemplateMatrix(tplid int, m [6]float64) error {
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		return err
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
+	tplInfo.Writer.tpls[tplInfo.TemplateId].SetMatrix(m)
+	return nil
+}
+
+// For a given template id (returned from ImportPage), set the transformation matrix it is drawn with
+// on the output page (see PdfTemplate.SetPlacement), so that its imported annotations are placed
+// on the template.  Must be called before PutFormXobjects.
+func (this *Importer) SetTemplatePlacement(tplid int, m [6]float64) error {
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		return err
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
+	tplInfo.Writer.tpls[tplInfo.TemplateId].SetPlacement(m)
+	return nil
+}
+
+// Get warnings about problems in the current source document that were recovered from
+// (e.g. a stream with a wrong /Length)
+func (this *Importer) GetWarnings() []string {
+	return this.GetReader().warnings
+}
+
+// For a given template id (returned from ImportPage), get warnings about features of the source page
+// that cannot be fully reproduced (e.g. JavaScript actions, annotations, non-standard filters)
+func (this *Importer) GetTemplateWarnings(tplid int) ([]string, error) {
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		return nil, err
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
+	return tplInfo.Writer.tpls[tplInfo.TemplateId].Warnings, nil
+}
+
 // For a given template id (returned from ImportPage), get the template name (e.g. /GOFPDITPL1) and
 // the 4 float64 values necessary to draw the template a x,y for a given width and height.
 func (this *Importer) UseTemplate(tplid int, _x float64, _y float64, _w float64, _h float64) (string, float64, float64, float64, float64) {
 	// Look up template id in importer tpl map
-	tplInfo := this.tplMap[tplid]
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		panic(err)
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
 	return tplInfo.Writer.UseTemplate(tplInfo.TemplateId, _x, _y, _w, _h)
 }
+
+// Like UseTemplate, but draw the template with opacity alpha, e.g. for a watermark.  The caller must
+// add the returned graphics state to the /ExtGState resources of the page, see
+// PdfWriter.UseTemplateWithOpacity.
+func (this *Importer) UseTemplateWithOpacity(tplid int, x float64, y float64, w float64, h float64, alpha float64) (OpacityPlacement, error) {
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		return OpacityPlacement{}, err
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
+	return tplInfo.Writer.UseTemplateWithOpacity(tplInfo.TemplateId, x, y, w, h, alpha), nil
+}
+
+// Like UseTemplate, but fit the template into a box (x, y, w, h) with mode (FIT_CONTAIN, FIT_COVER
+// or FIT_STRETCH), see PdfWriter.UseTemplateFit
+func (this *Importer) UseTemplateFit(tplid int, box [4]float64, mode FitMode) (string, float64, float64, float64, float64, error) {
+	tplInfo, err := this.getTplInfo(tplid)
+	if err != nil {
+		return "", 0, 0, 0, 0, err
+	}
+	tplInfo.Writer.mu.Lock()
+	defer tplInfo.Writer.mu.Unlock()
+	name, scaleX, scaleY, tx, ty := tplInfo.Writer.UseTemplateFit(tplInfo.TemplateId, box, mode)
+	return name, scaleX, scaleY, tx, ty, nil
+}
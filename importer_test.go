@@ -0,0 +1,493 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Import pages concurrently, from different files and from the same file, while reading the
+// templates that were imported.  Run with -race to check the locking of the importer.
+func TestConcurrentImport(t *testing.T) {
+	const nFiles = 8
+	const nPages = 20
+
+	files := make([]string, nFiles)
+	for i := range files {
+		contents := make([]string, nPages)
+		for j := range contents {
+			contents[j] = fmt.Sprintf("BT /F1 12 Tf (file %d page %d) Tj ET", i, j+1)
+		}
+		files[i] = writeTempPdf(t, buildPdf(pagesPdf(contents...)))
+		defer os.Remove(files[i])
+	}
+
+	tests := []struct {
+		name string
+		file func(goroutine int) int // The file that a goroutine imports from
+	}{
+		{"different files", func(goroutine int) int { return goroutine }},
+		{"same file", func(goroutine int) int { return 0 }},
+		{"two files", func(goroutine int) int { return goroutine % 2 }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := NewImporter()
+			defer importer.Reset()
+
+			// The goroutines start importing at the same time
+			start := make(chan bool)
+			tplids := make([][]int, nFiles)
+			var wg sync.WaitGroup
+			for i := 0; i < nFiles; i++ {
+				wg.Add(1)
+				go func(i int, file string) {
+					defer wg.Done()
+					<-start
+					for pageno := 1; pageno <= nPages; pageno++ {
+						tplid, err := importer.ImportPageFromFile(file, pageno, "/MediaBox")
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						tplids[i] = append(tplids[i], tplid)
+
+						// Read the templates imported so far, while other goroutines import
+						for _, id := range tplids[i] {
+							if _, err := importer.GetTemplateWarnings(id); err != nil {
+								t.Error(err)
+							}
+							importer.UseTemplate(id, 0, 0, 100, 0)
+						}
+					}
+				}(i, files[test.file(i)])
+			}
+			close(start)
+			wg.Wait()
+
+			// Each template has the page it was imported from.  Pages imported from the same file
+			// by several goroutines are the same template.
+			names := make(map[string]int, 0)
+			for i := range tplids {
+				if len(tplids[i]) != nPages {
+					t.Fatalf("goroutine %d: got %d templates, want %d", i, len(tplids[i]), nPages)
+				}
+				for j, tplid := range tplids[i] {
+					want := fmt.Sprintf("(file %d page %d)", test.file(i), j+1)
+					if content := templateContent(t, importer, tplid); !strings.Contains(content, want) {
+						t.Errorf("template %d has content %q, want %s", tplid, content, want)
+					}
+
+					name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 100, 0)
+					if id, ok := names[name]; ok && id != tplid {
+						t.Errorf("template name %s is used by templates %d and %d", name, id, tplid)
+					}
+					names[name] = tplid
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownTemplate(t *testing.T) {
+	importer := NewImporter()
+	var rs io.ReadSeeker = bytes.NewReader(buildPdf(pagesPdf("BT ET")))
+	importer.SetSourceStream(&rs)
+	tplid := importer.ImportPage(1, "/MediaBox")
+
+	tests := []struct {
+		name string
+		call func(tplid int) error
+	}{
+		{"SetTemplateMatrix", func(tplid int) error {
+			return importer.SetTemplateMatrix(tplid, [6]float64{1, 0, 0, 1, 0, 0})
+		}},
+		{"SetTemplatePlacement", func(tplid int) error {
+			return importer.SetTemplatePlacement(tplid, [6]float64{1, 0, 0, 1, 0, 0})
+		}},
+		{"GetTemplateWarnings", func(tplid int) error {
+			_, err := importer.GetTemplateWarnings(tplid)
+			return err
+		}},
+		{"GetTemplateAnnotations", func(tplid int) error {
+			_, err := importer.GetTemplateAnnotations(tplid)
+			return err
+		}},
+		{"GetTemplateAnnotationsUnordered", func(tplid int) error {
+			_, err := importer.GetTemplateAnnotationsUnordered(tplid)
+			return err
+		}},
+		{"GetTemplateStructure", func(tplid int) error {
+			_, err := importer.GetTemplateStructure(tplid)
+			return err
+		}},
+		{"UseTemplateWithOpacity", func(tplid int) error {
+			_, err := importer.UseTemplateWithOpacity(tplid, 0, 0, 100, 100, 0.5)
+			return err
+		}},
+		{"UseTemplateFit", func(tplid int) error {
+			_, _, _, _, _, err := importer.UseTemplateFit(tplid, [4]float64{0, 0, 100, 100}, FIT_CONTAIN)
+			return err
+		}},
+		{"GetTemplateContent", func(tplid int) error {
+			_, _, _, err := importer.GetTemplateContent(tplid, func() int { return 100 })
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(tplid); err != nil {
+				t.Errorf("template %d: %v", tplid, err)
+			}
+			if err := test.call(tplid + 1); err == nil {
+				t.Errorf("template %d: expected an error", tplid+1)
+			}
+		})
+	}
+}
+
+// The objects of PutFormXobjectsWithIds reference each other by the allocated ids, so no hashes
+// need to be replaced
+func TestPutFormXobjectsWithIds(t *testing.T) {
+	hashRegexp := regexp.MustCompile(`[0-9a-f]{40}`)
+	refRegexp := regexp.MustCompile(`(\d+) 0 R`)
+
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET", "BT /F1 12 Tf (three) Tj ET")
+	objs[4] = "<< /Type /Annot /Subtype /Link /Rect [10 10 100 100] /Border [0 0 0] /A << /S /URI /URI (https://example.com) >> >>"
+	objs[10] = strings.Replace(objs[10], "/Contents", "/Annots [4 0 R] /Contents", 1)
+	data := buildPdf(objs)
+
+	tests := []struct {
+		name  string
+		setup func(importer *Importer)
+	}{
+		{"default", func(importer *Importer) {}},
+		{"annotations", func(importer *Importer) { importer.SetImportAnnotations(true) }},
+		{"lazy", func(importer *Importer) { importer.SetLazyMode(true) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := NewImporter()
+			test.setup(importer)
+			if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+
+			// The first call puts two pages, the second call the page imported after it
+			alloc := idCounter(100)
+			objects := make(map[int][]byte, 0)
+			templates := make(map[string]int, 0)
+			for _, pagenos := range [][]int{{1, 2}, {3}} {
+				for _, pageno := range pagenos {
+					importer.ImportPage(pageno, "/MediaBox")
+				}
+				tpls, objs, err := importer.PutFormXobjectsWithIds(alloc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for name, id := range tpls {
+					templates[name] = id
+				}
+				for id, object := range objs {
+					if _, ok := objects[id]; ok {
+						t.Errorf("object %d is returned twice", id)
+					}
+					objects[id] = object
+				}
+			}
+
+			if len(templates) != 3 {
+				t.Errorf("got %d templates, want 3", len(templates))
+			}
+			for name, id := range templates {
+				if _, ok := objects[id]; !ok {
+					t.Errorf("template %s has no object %d", name, id)
+				}
+			}
+
+			for id, object := range objects {
+				if id < 100 {
+					t.Errorf("object %d was not allocated", id)
+				}
+				if hash := hashRegexp.Find(object); hash != nil {
+					t.Errorf("object %d contains the hash %s", id, hash)
+				}
+				for _, ref := range refRegexp.FindAllSubmatch(object, -1) {
+					refId, _ := strconv.Atoi(string(ref[1]))
+					if _, ok := objects[refId]; !ok {
+						t.Errorf("object %d references object %d, which was not returned", id, refId)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Pages imported from two files can be placed in the same output
+func TestImportPageFromFile(t *testing.T) {
+	fileA := writeTempPdf(t, buildPdf(pagesPdf("BT /F1 12 Tf (file A) Tj ET")))
+	defer os.Remove(fileA)
+	fileB := writeTempPdf(t, buildPdf(pagesPdf("BT /F1 12 Tf (file B page 1) Tj ET", "BT /F1 12 Tf (file B page 2) Tj ET")))
+	defer os.Remove(fileB)
+
+	importer := NewImporter()
+	defer importer.Reset()
+
+	tests := []struct {
+		file    string
+		pageno  int
+		content string
+	}{
+		{fileA, 1, "(file A)"},
+		{fileB, 2, "(file B page 2)"},
+		{fileB, 1, "(file B page 1)"},
+	}
+
+	tplids := make([]int, len(tests))
+	names := make(map[string]bool, 0)
+	for i, test := range tests {
+		tplid, err := importer.ImportPageFromFile(test.file, test.pageno, "/MediaBox")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tplids[i] = tplid
+
+		name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 100, 0)
+		if names[name] {
+			t.Errorf("template name %s is used twice", name)
+		}
+		names[name] = true
+	}
+
+	// Importing a page again gives the same template
+	if tplid, err := importer.ImportPageFromFile(fileA, 1, "/MediaBox"); err != nil || tplid != tplids[0] {
+		t.Errorf("got template %d (%v) for a page imported before as template %d", tplid, err, tplids[0])
+	}
+
+	// The templates of both files are put with ids that do not clash, and each has its page
+	templates, objects, err := importer.PutAllFormXobjectsWithIds(idCounter(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != len(tests) {
+		t.Fatalf("got %d templates, want %d", len(templates), len(tests))
+	}
+	for i, test := range tests {
+		name, _, _, _, _ := importer.UseTemplate(tplids[i], 0, 0, 100, 0)
+		id, ok := templates[name]
+		if !ok {
+			t.Fatalf("template %s was not put", name)
+		}
+		if content := string(inflate(t, objects[id])); !strings.Contains(content, test.content) {
+			t.Errorf("template %s has content %q, want %s", name, content, test.content)
+		}
+	}
+}
+
+// With an object id allocator, the imported objects have the allocated ids and reference each
+// other by them, without hashes
+func TestObjectIdAllocator(t *testing.T) {
+	hashRegexp := regexp.MustCompile(`[0-9a-f]{40}`)
+	refRegexp := regexp.MustCompile(`(\d+) 0 R`)
+
+	importer := newTestImporter(t, buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET")))
+
+	// Allocate every tenth id from 500, as a pdf generation library with its own objects would
+	allocated := make(map[int]bool, 0)
+	n := 490
+	importer.SetObjectIdAllocator(func() int {
+		n += 10
+		allocated[n] = true
+		return n
+	})
+
+	importer.ImportPage(1, "/MediaBox")
+	importer.ImportPage(2, "/MediaBox")
+	templates := importer.PutFormXobjects()
+	objects := importer.GetImportedObjects()
+
+	if len(templates) != 2 {
+		t.Errorf("got %d templates, want 2", len(templates))
+	}
+	for name, id := range templates {
+		if _, ok := objects[id]; !ok {
+			t.Errorf("template %s has no object %d", name, id)
+		}
+	}
+
+	for id, object := range objects {
+		if !allocated[id] {
+			t.Errorf("object %d was not allocated", id)
+		}
+		if hash := hashRegexp.FindString(object); hash != "" {
+			t.Errorf("object %d contains the hash %s", id, hash)
+		}
+		for _, ref := range refRegexp.FindAllStringSubmatch(object, -1) {
+			refId, _ := strconv.Atoi(ref[1])
+			if _, ok := objects[refId]; !ok {
+				t.Errorf("object %d references object %d, which was not imported", id, refId)
+			}
+		}
+	}
+	if len(objects) != len(allocated) {
+		t.Errorf("got %d objects for %d allocated ids", len(objects), len(allocated))
+	}
+}
+
+// After Reset, an importer imports like a new importer, and template ids and names start again
+func TestReset(t *testing.T) {
+	fileA := writeTempPdf(t, buildPdf(pagesPdf("BT /F1 12 Tf (file A page 1) Tj ET", "BT /F1 12 Tf (file A page 2) Tj ET")))
+	defer os.Remove(fileA)
+	fileB := writeTempPdf(t, buildPdf(pagesPdf("BT /F1 12 Tf (file B) Tj ET")))
+	defer os.Remove(fileB)
+
+	before := countOpenFiles(t)
+
+	importer := NewImporter()
+	importer.SetSourceFile(fileA)
+	first := importer.ImportPage(1, "/MediaBox")
+	firstName, _, _, _, _ := importer.UseTemplate(first, 0, 0, 100, 0)
+	if second := importer.ImportPage(2, "/MediaBox"); second != first+1 {
+		t.Errorf("got template %d, want %d", second, first+1)
+	}
+
+	// Reset closes the source file and forgets its templates
+	importer.Reset()
+	if after := countOpenFiles(t); after != before {
+		t.Errorf("%d files were left open", after-before)
+	}
+	if importer.GetReaderForFile(fileA) != nil {
+		t.Error("the reader of the source file was kept")
+	}
+	if _, err := importer.GetTemplateWarnings(first + 1); err == nil {
+		t.Error("the templates were kept")
+	}
+
+	importer.SetSourceFile(fileB)
+	tplid := importer.ImportPage(1, "/MediaBox")
+	if tplid != first {
+		t.Errorf("got template %d after Reset, want %d", tplid, first)
+	}
+	if name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 100, 0); name != firstName {
+		t.Errorf("got template name %s after Reset, want %s", name, firstName)
+	}
+	if content := templateContent(t, importer, tplid); !strings.Contains(content, "(file B)") {
+		t.Errorf("got template content %q, want file B", content)
+	}
+	templates, _, err := importer.PutFormXobjectsWithIds(idCounter(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 {
+		t.Errorf("got %d templates, want 1", len(templates))
+	}
+
+	// ResetKeepReaders keeps the parsed source file, and a page of it can be imported again
+	reader := importer.GetReader()
+	importer.ResetKeepReaders()
+	importer.SetSourceFile(fileB)
+	if importer.GetReader() != reader {
+		t.Error("the reader of the source file was not kept")
+	}
+	if tplid = importer.ImportPage(1, "/MediaBox"); tplid != first {
+		t.Errorf("got template %d after ResetKeepReaders, want %d", tplid, first)
+	}
+	if content := templateContent(t, importer, tplid); !strings.Contains(content, "(file B)") {
+		t.Errorf("got template content %q, want file B", content)
+	}
+
+	importer.Reset()
+	if after := countOpenFiles(t); after != before {
+		t.Errorf("%d files were left open", after-before)
+	}
+}
+
+// The ordered imported objects are the imported objects in ascending id order
+func TestGetImportedObjectsOrdered(t *testing.T) {
+	importer := newTestImporter(t, buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET", "BT /F1 12 Tf (three) Tj ET")))
+
+	// Allocate ids counting down, so that the order of allocation is not the order of the ids
+	n := 1000
+	importer.SetObjectIdAllocator(func() int {
+		n--
+		return n
+	})
+
+	for pageno := 1; pageno <= 3; pageno++ {
+		importer.ImportPage(pageno, "/MediaBox")
+	}
+	importer.PutFormXobjects()
+
+	objects := importer.GetImportedObjects()
+	ordered := importer.GetImportedObjectsOrdered()
+	if len(ordered) != len(objects) || len(ordered) < 4 {
+		t.Fatalf("got %d ordered objects, want %d", len(ordered), len(objects))
+	}
+	for i, object := range ordered {
+		if i > 0 && object.ID <= ordered[i-1].ID {
+			t.Errorf("object %d follows object %d", object.ID, ordered[i-1].ID)
+		}
+		if string(object.Data) != objects[object.ID] {
+			t.Errorf("object %d is %q, want %q", object.ID, object.Data, objects[object.ID])
+		}
+	}
+}
+
+// The progress function is called once after each imported page
+func TestProgressFunc(t *testing.T) {
+	data := buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET", "BT /F1 12 Tf (three) Tj ET"))
+
+	tests := []struct {
+		name    string
+		pagenos []int // The pages to import, or nil for all
+		want    string
+		fails   bool
+	}{
+		{"all pages", nil, "1/3 2/3 3/3", false},
+		{"some pages", []int{3, 1}, "1/2 2/2", false},
+		{"missing page", []int{1, 4, 2}, "1/3", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := newTestImporter(t, data)
+			calls := make([]string, 0)
+			importer.SetProgressFunc(func(done int, total int) {
+				calls = append(calls, fmt.Sprintf("%d/%d", done, total))
+			})
+
+			var tplids []int
+			var err error
+			if test.pagenos == nil {
+				tplids, err = importer.ImportAllPages("/MediaBox")
+			} else {
+				tplids, err = importer.ImportPages(test.pagenos, "/MediaBox")
+			}
+			if test.fails != (err != nil) {
+				t.Fatalf("unexpected error result: %v", err)
+			}
+			if got := strings.Join(calls, " "); got != test.want {
+				t.Errorf("got progress %s, want %s", got, test.want)
+			}
+			if !test.fails && len(tplids) != len(calls) {
+				t.Errorf("got %d templates for %d progress calls", len(tplids), len(calls))
+			}
+		})
+	}
+
+	// Without a progress function, pages are imported as usual
+	importer := newTestImporter(t, data)
+	importer.SetProgressFunc(nil)
+	if tplids, err := importer.ImportAllPages("/MediaBox"); err != nil || len(tplids) != 3 {
+		t.Errorf("got templates %v (%v), want 3", tplids, err)
+	}
+}
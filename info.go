@@ -0,0 +1,174 @@
+package gofpdi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Get the entries of the document information dictionary (/Info in the trailer), e.g. Title,
+// Author or CreationDate.  Keys are without the leading slash, and text strings are decoded to UTF-8.
+func (this *PdfReader) getInfo() (map[string]string, error) {
+	result := make(map[string]string, 0)
+
+	if this.trailer == nil {
+		return result, nil
+	}
+
+	info, ok := this.trailer.Dictionary["/Info"]
+	if !ok {
+		return result, nil
+	}
+
+	info, err := this.resolveValue(info)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve info dictionary")
+	}
+
+	for key, value := range info.Dictionary {
+		value, err = this.resolveValue(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to resolve info entry "+key)
+		}
+
+		switch value.Type {
+		case PDF_TYPE_STRING, PDF_TYPE_HEX:
+			result[decode_pdf_name(key)] = decode_pdf_string(value)
+		case PDF_TYPE_TOKEN:
+			// e.g. /Trapped /True
+			result[decode_pdf_name(key)] = decode_pdf_name(value.Token)
+		}
+	}
+
+	return result, nil
+}
+
+// Get a date entry (e.g. CreationDate) of the document information dictionary
+func (this *PdfReader) getInfoDate(key string) (time.Time, error) {
+	info, err := this.getInfo()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	date, ok := info[key]
+	if !ok {
+		return time.Time{}, errors.New("Document information has no " + key)
+	}
+
+	return parse_pdf_date(date)
+}
+
+// Parse a pdf date string (D:YYYYMMDDHHmmSSOHH'mm').  All parts after the year are optional, and
+// O is +, - or Z.  Dates without a time zone are taken to be UTC.
+func parse_pdf_date(date string) (time.Time, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(date), "D:")
+
+	// Year, month, day, hour, minute and second, with their lengths and defaults
+	lengths := []int{4, 2, 2, 2, 2, 2}
+	values := []int{0, 1, 1, 0, 0, 0}
+
+	pos := 0
+	for i, length := range lengths {
+		if pos+length > len(s) || !is_object_number(s[pos:pos+length]) {
+			if i == 0 {
+				return time.Time{}, errors.New(fmt.Sprintf("Invalid date: %s", date))
+			}
+			break
+		}
+		values[i], _ = strconv.Atoi(s[pos : pos+length])
+		pos += length
+	}
+
+	loc := time.UTC
+	if pos < len(s) {
+		switch s[pos] {
+		case 'Z':
+		case '+', '-':
+			// Offset hours and minutes, with apostrophes after each (the last one is often left out)
+			parts := strings.Split(strings.TrimRight(s[pos+1:], "'"), "'")
+			hours, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return time.Time{}, errors.New(fmt.Sprintf("Invalid time zone in date: %s", date))
+			}
+			minutes := 0
+			if len(parts) > 1 && parts[1] != "" {
+				if minutes, err = strconv.Atoi(parts[1]); err != nil {
+					return time.Time{}, errors.New(fmt.Sprintf("Invalid time zone in date: %s", date))
+				}
+			}
+			offset := hours*3600 + minutes*60
+			if s[pos] == '-' {
+				offset = -offset
+			}
+			loc = time.FixedZone("", offset)
+		default:
+			return time.Time{}, errors.New(fmt.Sprintf("Invalid date: %s", date))
+		}
+	}
+
+	return time.Date(values[0], time.Month(values[1]), values[2], values[3], values[4], values[5], 0, loc), nil
+}
+
+// Get the natural language of the document (/Lang in the catalog, e.g. en-US) decoded to UTF-8,
+// and the /Lang value as it was read.  Both are empty if the document has no /Lang.
+func (this *PdfReader) getLanguage() (string, *PdfValue, error) {
+	if this.catalog == nil || this.catalog.Value == nil {
+		return "", nil, nil
+	}
+
+	lang, ok := this.catalog.Value.Dictionary["/Lang"]
+	if !ok {
+		return "", nil, nil
+	}
+
+	lang, err := this.resolveValue(lang)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Failed to resolve /Lang")
+	}
+	if lang.Type != PDF_TYPE_STRING && lang.Type != PDF_TYPE_HEX {
+		return "", nil, errors.New("/Lang is not a string")
+	}
+
+	return decode_pdf_string(lang), lang, nil
+}
+
+// Get the XMP metadata stream of the document catalog (/Metadata), or nil if there is none.
+// The metadata of a document encrypted with /EncryptMetadata false is not encrypted, so it can be
+// read even though the rest of the document cannot.
+func (this *PdfReader) getMetadata() ([]byte, error) {
+	if this.catalog == nil || this.catalog.Value == nil {
+		return nil, nil
+	}
+
+	metadata, ok := this.catalog.Value.Dictionary["/Metadata"]
+	if !ok {
+		return nil, nil
+	}
+
+	if this.encryptErr != nil && this.encryptsMetadata() {
+		return nil, this.encryptErr
+	}
+
+	metadata, err := this.resolveObject(metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve metadata stream")
+	}
+	if metadata.Type != PDF_TYPE_STREAM {
+		return nil, errors.New("Metadata is not a stream")
+	}
+
+	filters, parms, err := this.getStreamFilters(metadata.Value)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get metadata stream filters")
+	}
+
+	data, err := this.decodeStream(metadata.Stream.Bytes, filters, parms)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode metadata stream")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,162 @@
+package gofpdi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// A one page pdf whose document information dictionary is info
+func infoPdf(info string) []byte {
+	objs := pagesPdf("BT ET")
+	objs[7] = info
+	return bytes.Replace(buildPdf(objs), []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Info 7 0 R"), 1)
+}
+
+// Encode text as a UTF-16BE hex string with a byte order mark
+func utf16Hex(text string) string {
+	b := []byte{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(text)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return "<" + hex.EncodeToString(b) + ">"
+}
+
+func TestGetInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"utf-16 hex", utf16Hex("Grüße aus Köln, 日本 😀"), "Grüße aus Köln, 日本 😀"},
+		{"utf-16 literal", `(\376\377\000A\000\344\000\(\000\))`, "Aä()"},
+		{"utf-8", "(\xef\xbb\xbfGr\xc3\xbc\xc3\x9fe)", "Grüße"},
+		{"pdfdocencoding", `(\200 Bullet\222 \240)`, "• Bullet™ €"},
+		{"latin-1", `(caf\351)`, "café"},
+		{"hex", "<48656C6C6F>", "Hello"},
+		{"name", "/True", "True"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := newTestImporter(t, infoPdf("<< /Title "+test.value+" >>"))
+
+			info, err := importer.GetInfo()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info["Title"] != test.want {
+				t.Errorf("got title %q, want %q", info["Title"], test.want)
+			}
+		})
+	}
+}
+
+func TestGetCreationDate(t *testing.T) {
+	tests := []struct {
+		date  string
+		want  time.Time
+		fails bool
+	}{
+		{"D:20230415103000+02'00'", time.Date(2023, 4, 15, 10, 30, 0, 0, time.FixedZone("", 2*3600)), false},
+		{"D:20230415103000-05'30'", time.Date(2023, 4, 15, 10, 30, 0, 0, time.FixedZone("", -5*3600-30*60)), false},
+		{"D:20230415103000+02'00", time.Date(2023, 4, 15, 10, 30, 0, 0, time.FixedZone("", 2*3600)), false},
+		{"D:20230415103000+02", time.Date(2023, 4, 15, 10, 30, 0, 0, time.FixedZone("", 2*3600)), false},
+		{"D:20230415103000Z", time.Date(2023, 4, 15, 10, 30, 0, 0, time.UTC), false},
+		{"D:20230415103000Z00'00'", time.Date(2023, 4, 15, 10, 30, 0, 0, time.UTC), false},
+		{"D:20230415103000", time.Date(2023, 4, 15, 10, 30, 0, 0, time.UTC), false},
+		{"20230415103000", time.Date(2023, 4, 15, 10, 30, 0, 0, time.UTC), false},
+		{"D:202304151030", time.Date(2023, 4, 15, 10, 30, 0, 0, time.UTC), false},
+		{"D:20230415", time.Date(2023, 4, 15, 0, 0, 0, 0, time.UTC), false},
+		{"D:202304", time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), false},
+		{"D:2023", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"D:", time.Time{}, true},
+		{"April 15, 2023", time.Time{}, true},
+		{"D:20230415103000+xx'00'", time.Time{}, true},
+		{"D:20230415103000 CET", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.date, func(t *testing.T) {
+			importer := newTestImporter(t, infoPdf("<< /CreationDate ("+test.date+") /ModDate ("+test.date+") >>"))
+
+			for name, get := range map[string]func() (time.Time, error){"GetCreationDate": importer.GetCreationDate, "GetModDate": importer.GetModDate} {
+				got, err := get()
+				if test.fails {
+					if err == nil {
+						t.Errorf("%s: expected an error, got %v", name, got)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if !got.Equal(test.want) {
+					t.Errorf("%s: got %v, want %v", name, got, test.want)
+				}
+				_, gotOffset := got.Zone()
+				_, wantOffset := test.want.Zone()
+				if gotOffset != wantOffset {
+					t.Errorf("%s: got time zone offset %d, want %d", name, gotOffset, wantOffset)
+				}
+			}
+		})
+	}
+
+	// A document without dates
+	importer := newTestImporter(t, infoPdf("<< /Title (No dates) >>"))
+	if _, err := importer.GetCreationDate(); err == nil {
+		t.Error("no /CreationDate: expected an error")
+	}
+}
+
+// The /Lang of the catalog is read, and kept by StampPages
+func TestGetLanguage(t *testing.T) {
+	tests := []struct {
+		name  string
+		lang  string
+		want  string
+		fails bool
+	}{
+		{"literal", "/Lang (en-US)", "en-US", false},
+		{"hex", "/Lang <64652D4445>", "de-DE", false},
+		{"utf-16", "/Lang " + utf16Hex("fr-CA"), "fr-CA", false},
+		{"indirect", "/Lang 7 0 R", "nl-BE", false},
+		{"none", "", "", false},
+		{"not a string", "/Lang 42", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[1] = "<< /Type /Catalog /Pages 2 0 R " + test.lang + " >>"
+			objs[7] = "(nl-BE)"
+			data := buildPdf(objs)
+
+			got, err := newTestImporter(t, data).GetLanguage()
+			if test.fails {
+				if err == nil {
+					t.Errorf("expected an error, got %q", got)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if got != test.want {
+				t.Errorf("got language %q, want %q", got, test.want)
+			}
+
+			// The output of StampPages has the language of the source, or none if it is not valid
+			src := writeTempPdf(t, data)
+			defer os.Remove(src)
+			var out bytes.Buffer
+			if err := StampPagesTo(&out, src, []StampSpec{{PageNo: 1}}); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := newTestImporter(t, out.Bytes()).GetLanguage(); err != nil || got != test.want {
+				t.Errorf("got language %q (%v) of the stamped pages, want %q", got, err, test.want)
+			}
+		})
+	}
+}
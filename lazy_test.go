@@ -0,0 +1,236 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+// Objects of a pdf with n pages in a page tree whose nodes have at most fanout kids
+func pageTreePdf(n int, fanout int) map[int]string {
+	objs := map[int]string{
+		3: pdfStream("", "BT ET"),
+	}
+	nextId := 10
+
+	// Build the tree from the pages up.  Each level is a list of object ids and page counts.
+	ids := make([]int, n)
+	counts := make([]int, n)
+	for i := range ids {
+		ids[i] = nextId
+		counts[i] = 1
+		objs[nextId] = "<< /Type /Page /MediaBox [0 0 612 792] /Contents 3 0 R >>"
+		nextId++
+	}
+
+	// The root is always a /Pages node, also for a single page
+	for level := 0; level == 0 || len(ids) > 1; level++ {
+		parentIds := make([]int, 0)
+		parentCounts := make([]int, 0)
+		for i := 0; i < len(ids); i += fanout {
+			end := i + fanout
+			if end > len(ids) {
+				end = len(ids)
+			}
+			kids := ""
+			count := 0
+			for j := i; j < end; j++ {
+				kids += fmt.Sprintf("%d 0 R ", ids[j])
+				count += counts[j]
+			}
+			objs[nextId] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, count)
+			parentIds = append(parentIds, nextId)
+			parentCounts = append(parentCounts, count)
+			nextId++
+		}
+		ids, counts = parentIds, parentCounts
+	}
+
+	objs[1] = fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", ids[0])
+
+	return objs
+}
+
+func TestLazyFindPage(t *testing.T) {
+	tests := []struct {
+		name   string
+		pages  int
+		fanout int
+	}{
+		{"flat", 300, 300},
+		{"balanced", 300, 10},
+		{"single", 1, 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := buildPdf(pageTreePdf(test.pages, test.fanout))
+
+			reader, err := newPdfReaderFromStream("test", bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader.SetLazyMode(true)
+			if err = reader.read(); err != nil {
+				t.Fatal(err)
+			}
+
+			resolved := 0
+			reader.SetTraceFunc(func(event string, args ...interface{}) {
+				if event == "object" {
+					resolved++
+				}
+			})
+
+			seen := make(map[int]bool, 0)
+			for pageno := 1; pageno <= test.pages; pageno++ {
+				ref, err := reader.getPageRef(pageno)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if seen[ref.Id] {
+					t.Fatalf("page %d is object %d, which is also an earlier page", pageno, ref.Id)
+				}
+				seen[ref.Id] = true
+			}
+
+			// Every node and page is resolved once, instead of the kids of a node for each page
+			if limit := 2 * test.pages; resolved > limit {
+				t.Errorf("resolved %d objects to find %d pages, want at most %d", resolved, test.pages, limit)
+			}
+		})
+	}
+}
+
+// Read a 1000 page document with a balanced page tree and find a page, in the default mode, which
+// resolves the whole page tree when it is read, and in lazy mode, which resolves the nodes on the
+// path to the page.  Finding every page in lazy mode resolves each node once.
+func BenchmarkLazyFindPage(b *testing.B) {
+	data := buildPdf(pageTreePdf(1000, 10))
+
+	tests := []struct {
+		name    string
+		lazy    bool
+		pagenos []int
+	}{
+		{"default", false, []int{500}},
+		{"lazy", true, []int{500}},
+		{"lazy all pages", true, nil},
+	}
+
+	for _, test := range tests {
+		pagenos := test.pagenos
+		if pagenos == nil {
+			for pageno := 1; pageno <= 1000; pageno++ {
+				pagenos = append(pagenos, pageno)
+			}
+		}
+
+		b.Run(test.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				reader, err := newPdfReaderFromStream("test", bytes.NewReader(data))
+				if err != nil {
+					b.Fatal(err)
+				}
+				reader.SetLazyMode(test.lazy)
+				if err = reader.read(); err != nil {
+					b.Fatal(err)
+				}
+				for _, pageno := range pagenos {
+					if _, err = reader.getPageRef(pageno); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLazyMode(t *testing.T) {
+	data := buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET", "BT /F1 12 Tf (three) Tj ET"))
+
+	// Import each page in the default mode and in lazy mode, which must give the same objects
+	for pageno := 1; pageno <= 3; pageno++ {
+		// Dictionary keys are written in map order, so compare the sizes of the objects
+		sizes := make(map[bool][]int, 0)
+
+		for _, lazy := range []bool{false, true} {
+			importer := NewImporter()
+			importer.SetLazyMode(lazy)
+			var rs io.ReadSeeker = bytes.NewReader(data)
+			importer.SetSourceStream(&rs)
+
+			if n := importer.GetNumPages(); n != 3 {
+				t.Fatalf("lazy %v: got %d pages, want 3", lazy, n)
+			}
+
+			importer.ImportPage(pageno, "/MediaBox")
+			importer.PutFormXobjects()
+			for _, object := range importer.GetImportedObjects() {
+				sizes[lazy] = append(sizes[lazy], len(object))
+			}
+			sort.Ints(sizes[lazy])
+
+			// In lazy mode, the template is released once it is written
+			released := importer.GetWriter().tpls[0].released
+			if released != lazy {
+				t.Errorf("page %d, lazy %v: template released is %v", pageno, lazy, released)
+			}
+		}
+
+		if !reflect.DeepEqual(sizes[false], sizes[true]) {
+			t.Errorf("page %d: lazy mode imported objects of sizes %v, want %v", pageno, sizes[true], sizes[false])
+		}
+	}
+}
+
+// Import one page of a 500 page document in the default mode, which reads the whole page tree,
+// and in lazy mode.  Compare the B/op and the retained heap that is logged.
+func BenchmarkImportOnePage(b *testing.B) {
+	contents := make([]string, 500)
+	for i := range contents {
+		contents[i] = fmt.Sprintf("BT /F1 12 Tf (page %d) Tj ET", i+1)
+	}
+	data := buildPdf(pagesPdf(contents...))
+
+	for _, lazy := range []bool{false, true} {
+		name := "default"
+		if lazy {
+			name = "lazy"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			var retained uint64
+			for i := 0; i < b.N; i++ {
+				before := heapAlloc()
+
+				importer := NewImporter()
+				importer.SetLazyMode(lazy)
+				var rs io.ReadSeeker = bytes.NewReader(data)
+				importer.SetSourceStream(&rs)
+				importer.ImportPage(250, "/MediaBox")
+				importer.PutFormXobjects()
+
+				if after := heapAlloc(); after > before {
+					retained = after - before
+				}
+				runtime.KeepAlive(importer)
+			}
+			b.Logf("retained heap: %d bytes", retained)
+		})
+	}
+}
+
+// Get the size of the live heap after a garbage collection
+func heapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
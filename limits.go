@@ -0,0 +1,78 @@
+package gofpdi
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Returned when a pdf exceeds a limit set with SetResourceLimits.  Use errors.Cause(err) to compare.
+var ErrResourceLimit = errors.New("Resource limit exceeded")
+
+// Limits on the resources used to read a pdf, to guard against decompression bombs and other
+// malicious files.  Zero means no limit, except for MaxDepth and MaxTokenLength.
+type ResourceLimits struct {
+	MaxStreamSize int // Maximum size of a stream in bytes, before and after decoding
+	MaxObjects    int // Maximum number of objects in the xref table and xref streams
+	// Maximum nesting depth of arrays and dictionaries.  Zero means the default of 512 levels,
+	// because every level uses stack space and deeper nesting would crash the process with a stack
+	// overflow.  A negative value means no limit, for trusted input only.
+	MaxDepth int
+	// Maximum length of a token (e.g. a name, number or keyword) in bytes.  Zero means the default
+	// of 64 KB, because no valid token comes close and longer runs of bytes are garbage.
+	MaxTokenLength int
+}
+
+// Default for ResourceLimits.MaxTokenLength
+const defaultMaxTokenLength = 64 * 1024
+
+// Default for ResourceLimits.MaxDepth
+const defaultMaxDepth = 512
+
+// Set the resource limits of the reader.  Must be called before reading the pdf.
+func (this *PdfReader) SetResourceLimits(limits ResourceLimits) {
+	this.limits = limits
+}
+
+// Return ErrResourceLimit if a stream of size bytes exceeds the maximum stream size
+func (this *PdfReader) checkStreamSize(size int) error {
+	if this.limits.MaxStreamSize > 0 && size > this.limits.MaxStreamSize {
+		return errors.Wrap(ErrResourceLimit, fmt.Sprintf("Stream is larger than %d bytes", this.limits.MaxStreamSize))
+	}
+	return nil
+}
+
+// Return ErrResourceLimit if the xref has more than the maximum number of objects
+func (this *PdfReader) checkObjectCount() error {
+	if this.limits.MaxObjects > 0 && len(this.xref)+len(this.xrefStream) > this.limits.MaxObjects {
+		return errors.Wrap(ErrResourceLimit, fmt.Sprintf("Pdf has more than %d objects", this.limits.MaxObjects))
+	}
+	return nil
+}
+
+// Return ErrResourceLimit if arrays and dictionaries are nested deeper than the maximum depth
+func (this *PdfReader) checkDepth() error {
+	max := this.limits.MaxDepth
+	if max < 0 {
+		return nil
+	}
+	if max == 0 {
+		max = defaultMaxDepth
+	}
+	if this.depth > max {
+		return errors.Wrap(ErrResourceLimit, fmt.Sprintf("Objects are nested deeper than %d levels", max))
+	}
+	return nil
+}
+
+// Return ErrResourceLimit if a token of length bytes exceeds the maximum token length
+func (this *PdfReader) checkTokenLength(length int) error {
+	max := this.limits.MaxTokenLength
+	if max <= 0 {
+		max = defaultMaxTokenLength
+	}
+	if length > max {
+		return errors.Wrap(ErrResourceLimit, fmt.Sprintf("Token is longer than %d bytes", max))
+	}
+	return nil
+}
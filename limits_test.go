@@ -0,0 +1,162 @@
+package gofpdi
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMaxDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		nesting int
+		limits  ResourceLimits
+		limited bool
+	}{
+		{"default allows normal nesting", 100, ResourceLimits{}, false},
+		{"default stops deep nesting", 10 * 1024 * 1024, ResourceLimits{}, true},
+		{"explicit limit", 100, ResourceLimits{MaxDepth: 50}, true},
+		{"unlimited", 2000, ResourceLimits{MaxDepth: -1}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[1] = "<< /Type /Catalog /Pages 2 0 R /Deep " + strings.Repeat("[", test.nesting) + strings.Repeat("]", test.nesting) + " >>"
+
+			reader, err := newPdfReaderFromStream("test", bytes.NewReader(buildPdf(objs)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader.SetResourceLimits(test.limits)
+			err = reader.read()
+
+			if test.limited && errors.Cause(err) != ErrResourceLimit {
+				t.Errorf("expected ErrResourceLimit, got %v", err)
+			}
+			if !test.limited && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// A ReadSeeker that counts the bytes read
+type countingReader struct {
+	*bytes.Reader
+	n int
+}
+
+func (this *countingReader) Read(p []byte) (int, error) {
+	n, err := this.Reader.Read(p)
+	this.n += n
+	return n, err
+}
+
+func TestMaxStreamSize(t *testing.T) {
+	var bomb bytes.Buffer
+	w := zlib.NewWriter(&bomb)
+	w.Write(make([]byte, 10*1024*1024))
+	w.Close()
+
+	// A stream with a wrong /Length and no endstream, followed by 8 MB of data
+	junk := "<< /Length 5 >>\nstream\n" + strings.Repeat("x", 8*1024*1024)
+
+	tests := []struct {
+		name     string
+		content  string
+		limits   ResourceLimits
+		limited  bool
+		fails    bool
+		maxBytes int
+	}{
+		{"zlib bomb", fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", bomb.Len(), bomb.String()), ResourceLimits{MaxStreamSize: 1024 * 1024}, true, true, 0},
+		{"zlib bomb without limit", fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", bomb.Len(), bomb.String()), ResourceLimits{}, false, false, 0},
+		{"stream larger than limit", pdfStream("", strings.Repeat("x", 2048)), ResourceLimits{MaxStreamSize: 1024}, true, true, 0},
+		{"stream within limit", pdfStream("", strings.Repeat("x", 1024)), ResourceLimits{MaxStreamSize: 1024}, false, false, 0},
+		{"no endstream", junk, ResourceLimits{MaxStreamSize: 1024 * 1024}, true, true, 2 * 1024 * 1024},
+		{"no endstream without limit", junk, ResourceLimits{}, false, true, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[11] = test.content
+
+			rs := &countingReader{Reader: bytes.NewReader(buildPdf(objs))}
+			reader, err := newPdfReaderFromStream("test", rs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader.SetResourceLimits(test.limits)
+			if err = reader.read(); err != nil {
+				t.Fatal(err)
+			}
+
+			rs.n = 0
+			_, err = reader.getContent(1)
+			if test.limited && errors.Cause(err) != ErrResourceLimit {
+				t.Errorf("expected ErrResourceLimit, got %v", err)
+			}
+			if !test.limited && errors.Cause(err) == ErrResourceLimit {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.fails && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			// The stream is not read further than needed to exceed the limit
+			if test.maxBytes > 0 && rs.n > test.maxBytes {
+				t.Errorf("read %d bytes, want at most %d", rs.n, test.maxBytes)
+			}
+		})
+	}
+}
+
+func TestMaxTokenLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  int
+		limits  ResourceLimits
+		limited bool
+	}{
+		{"default stops a 10 MB token", 10 * 1024 * 1024, ResourceLimits{}, true},
+		{"default allows long tokens", 60 * 1024, ResourceLimits{}, false},
+		{"explicit limit", 100, ResourceLimits{MaxTokenLength: 50}, true},
+		{"explicit limit above the default", 100 * 1024, ResourceLimits{MaxTokenLength: 1024 * 1024}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[1] = "<< /Type /Catalog /Pages 2 0 R /Junk " + strings.Repeat("x", test.length) + " >>"
+
+			rs := &countingReader{Reader: bytes.NewReader(buildPdf(objs))}
+			reader, err := newPdfReaderFromStream("test", rs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader.SetResourceLimits(test.limits)
+			err = reader.read()
+
+			if !test.limited {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if errors.Cause(err) != ErrResourceLimit {
+				t.Errorf("expected ErrResourceLimit, got %v", err)
+			}
+
+			// The token is not read further than the limit
+			if rs.n > 1024*1024 {
+				t.Errorf("read %d bytes, want at most 1 MB", rs.n)
+			}
+		})
+	}
+}
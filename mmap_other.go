@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package gofpdi
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Memory mapping is not supported on this platform, so NewPdfReaderMmap reads the file like NewPdfReader
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errors.New("Memory mapping is not supported on this platform")
+}
@@ -0,0 +1,150 @@
+package gofpdi
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestNewPdfReaderMmap(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		pages int
+		fails bool
+	}{
+		{"pages", buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET")), 2, false},
+		{"bytes before header", append([]byte("garbage\n"), buildPdf(pagesPdf("BT ET"))...), 1, false},
+		{"empty file", []byte{}, 0, true},
+		{"not a pdf", []byte("not a pdf"), 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := writeTempPdf(t, test.data)
+			defer os.Remove(file)
+
+			before := countOpenFiles(t)
+
+			mapped, err := NewPdfReaderMmap(file)
+			if test.fails {
+				if err == nil {
+					mapped.Close()
+					t.Error("expected an error")
+				}
+				if after := countOpenFiles(t); after != before {
+					t.Errorf("%d files were left open", after-before)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if runtime.GOOS == "linux" && (mapped.unmap == nil || mapped.file != nil) {
+				t.Error("the file was not mapped")
+			}
+
+			reader, err := NewPdfReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			n, err := mapped.getNumPages()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != test.pages {
+				t.Errorf("got %d pages, want %d", n, test.pages)
+			}
+
+			// Each page has the same content as when the file is read
+			for pageno := 1; pageno <= n; pageno++ {
+				got, err := mapped.getContent(pageno)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, err := reader.getContent(pageno)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("page %d: got content %q, want %q", pageno, got, want)
+				}
+			}
+
+			// The file is closed once it is mapped, and Close unmaps it
+			if err = mapped.Close(); err != nil {
+				t.Error(err)
+			}
+			if mapped.unmap != nil {
+				t.Error("the file was not unmapped")
+			}
+			if err = mapped.Close(); err != nil {
+				t.Error("second Close:", err)
+			}
+			reader.Close()
+			if after := countOpenFiles(t); after != before {
+				t.Errorf("%d files were left open", after-before)
+			}
+		})
+	}
+}
+
+// Read every page of a large file, from the memory-mapped file and from the file
+func BenchmarkNewPdfReaderMmap(b *testing.B) {
+	contents := make([]string, 2000)
+	for i := range contents {
+		contents[i] = fmt.Sprintf("BT /F1 12 Tf (page %d) Tj ET", i+1)
+	}
+	file := writeTempPdf(b, buildPdf(pagesPdf(contents...)))
+	defer os.Remove(file)
+
+	readers := []struct {
+		name string
+		open func(string) (*PdfReader, error)
+	}{
+		{"file", NewPdfReader},
+		{"mmap", NewPdfReaderMmap},
+	}
+
+	for _, r := range readers {
+		b.Run(r.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				reader, err := r.open(file)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for pageno := 1; pageno <= len(contents); pageno++ {
+					if _, err = reader.getContent(pageno); err != nil {
+						b.Fatal(err)
+					}
+				}
+				reader.Close()
+			}
+		})
+	}
+}
+
+// A file that is too large for a slice is read instead of mapped
+func TestMmapFileTooLarge(t *testing.T) {
+	if strconv.IntSize == 64 {
+		t.Skip("Every file size fits in an int")
+	}
+
+	file := writeTempPdf(t, buildPdf(pagesPdf("BT ET")))
+	defer os.Remove(file)
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, _, err = mmapFile(f, 1<<32+1); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gofpdi
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Map a file into memory read-only.  Returns the mapping and a function that unmaps it.
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	// A file of 2 GB or more cannot be mapped where int is 32 bits
+	if int64(int(size)) != size {
+		return nil, nil, errors.New("File is too large to map into memory")
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,261 @@
+package gofpdi
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Estimate of what importing a page writes, see Importer.PlanImport
+type ImportPlan struct {
+	Objects       int // Number of objects, including the form xobject of the page
+	StreamObjects int // Number of those objects that are streams
+	StreamBytes   int // Size of the stream data of the objects (except the form xobject) as stored in the source
+	ContentBytes  int // Size of the decoded page content, which is the data of the form xobject
+}
+
+// Summary of an object in the document, for diagnosing malformed files
+type ObjectSummary struct {
+	Id       int
+	Gen      int
+	Type     string // /Type of the dictionary or stream (e.g. /Page, /Font, /XObject), or empty if it has none
+	Kind     string // stream, dictionary, array, numeric, string, name, boolean, null or reference
+	Offset   int    // Byte offset of the object, or -1 if it is stored in an object stream
+	ObjStmId int    // Id of the object stream that holds the object, or 0
+	Error    string // Error resolving the object, if any.  The other fields are then only partially set.
+}
+
+// Names of value types for ObjectSummary.Kind
+var objectKinds = map[int]string{
+	PDF_TYPE_NULL:       "null",
+	PDF_TYPE_NUMERIC:    "numeric",
+	PDF_TYPE_REAL:       "numeric",
+	PDF_TYPE_TOKEN:      "name",
+	PDF_TYPE_HEX:        "string",
+	PDF_TYPE_STRING:     "string",
+	PDF_TYPE_DICTIONARY: "dictionary",
+	PDF_TYPE_ARRAY:      "array",
+	PDF_TYPE_OBJREF:     "reference",
+	PDF_TYPE_BOOLEAN:    "boolean",
+}
+
+// List the objects in the xref table and xref streams, sorted by id.  Objects that fail to resolve
+// are still listed, with the error.
+func (this *PdfReader) listObjects() ([]ObjectSummary, error) {
+	summaries := make([]ObjectSummary, 0, len(this.xref)+len(this.xrefStream))
+
+	for id, gens := range this.xref {
+		for gen, offset := range gens {
+			// Skip the head of the free list and other free entries
+			if id == 0 || offset == 0 || gen == 65535 {
+				continue
+			}
+			summaries = append(summaries, this.summarizeObject(ObjectSummary{Id: id, Gen: gen, Offset: offset}))
+		}
+	}
+
+	for id, loc := range this.xrefStream {
+		// Objects in the xref table take precedence, as in resolveObject
+		if _, ok := this.xref[id]; ok {
+			continue
+		}
+		summaries = append(summaries, this.summarizeObject(ObjectSummary{Id: id, Offset: -1, ObjStmId: loc[0]}))
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Id != summaries[j].Id {
+			return summaries[i].Id < summaries[j].Id
+		}
+		return summaries[i].Gen < summaries[j].Gen
+	})
+
+	return summaries, nil
+}
+
+// Resolve an object and fill in its type and kind
+func (this *PdfReader) summarizeObject(summary ObjectSummary) ObjectSummary {
+	obj, err := this.resolveObject(&PdfValue{Type: PDF_TYPE_OBJREF, Id: summary.Id, Gen: summary.Gen})
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+
+	value := obj.Value
+	if obj.Type == PDF_TYPE_STREAM {
+		summary.Kind = "stream"
+	} else if value != nil {
+		summary.Kind = objectKinds[value.Type]
+	}
+
+	if value != nil && value.Type == PDF_TYPE_DICTIONARY {
+		if t, ok := value.Dictionary["/Type"]; ok && t.Type == PDF_TYPE_TOKEN {
+			summary.Type = t.Token
+		}
+	}
+
+	return summary
+}
+
+// Get the ids of the objects that a page depends on: its content streams, resources (including
+// inherited resources, fonts and images), annotations, and all objects they reference.
+// The page tree (/Parent) and the page itself are not included.
+func (this *PdfReader) getPageDependencies(pageno int) ([]int, error) {
+	pageRef, err := this.getPageRef(pageno)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := this.resolveValue(pageRef)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve page object")
+	}
+
+	seen := make(map[int]bool, 0)
+
+	if contents, ok := page.Dictionary["/Contents"]; ok {
+		if err = this.collectDependencies(contents, seen, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	resources, err := this.getPageResources(pageno)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get page resources")
+	}
+	if err = this.collectDependencies(resources, seen, nil); err != nil {
+		return nil, err
+	}
+
+	if err = this.collectAnnotDependencies(pageno, seen); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+// Add the ids of the annotations of a page and the objects they reference to seen
+func (this *PdfReader) collectAnnotDependencies(pageno int, seen map[int]bool) error {
+	annots, err := this.getPageAnnots(pageno)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get page annotations")
+	}
+
+	// Annotations and their popups are imported without their references back to the page
+	// (see PdfWriter.queueAnnots), so these references are not followed here either
+	annotIds := make(map[int]bool, 0)
+	for _, annot := range annots {
+		if annot.Type != PDF_TYPE_OBJREF {
+			continue
+		}
+		annotIds[annot.Id] = true
+
+		dict, err := this.resolveValue(annot)
+		if err != nil {
+			return errors.Wrap(err, "Failed to resolve annotation")
+		}
+		if popup, ok := dict.Dictionary["/Popup"]; ok && popup.Type == PDF_TYPE_OBJREF {
+			annotIds[popup.Id] = true
+		}
+	}
+	for _, annot := range annots {
+		if annot.Type != PDF_TYPE_OBJREF {
+			continue
+		}
+		if err = this.collectDependencies(annot, seen, annotIds); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Add the ids of the objects referenced by a value, directly or indirectly, to seen.
+// Objects in annotIds are annotations, whose references to the page are not followed.
+func (this *PdfReader) collectDependencies(value *PdfValue, seen map[int]bool, annotIds map[int]bool) error {
+	switch value.Type {
+	case PDF_TYPE_OBJREF:
+		if seen[value.Id] {
+			return nil
+		}
+		seen[value.Id] = true
+
+		obj, err := this.resolveObject(value)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Failed to resolve object %d", value.Id))
+		}
+
+		// For streams, this is the stream dictionary
+		if annotIds[value.Id] {
+			return this.collectDependencies(stripAnnot(obj.Value), seen, annotIds)
+		}
+		return this.collectDependencies(obj.Value, seen, annotIds)
+
+	case PDF_TYPE_DICTIONARY:
+		for _, v := range value.Dictionary {
+			if err := this.collectDependencies(v, seen, annotIds); err != nil {
+				return err
+			}
+		}
+
+	case PDF_TYPE_ARRAY:
+		for _, v := range value.Array {
+			if err := this.collectDependencies(v, seen, annotIds); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Plan the import of a page: resolve its content, resources and (if annots is set) annotations and
+// all objects they reference, and count them without writing them
+func (this *PdfReader) planImport(pageno int, annots bool) (ImportPlan, error) {
+	plan := ImportPlan{Objects: 1, StreamObjects: 1}
+
+	content, err := this.getContent(pageno)
+	if err != nil {
+		return plan, errors.Wrap(err, "Failed to get page content")
+	}
+	plan.ContentBytes = len(content)
+
+	seen := make(map[int]bool, 0)
+
+	resources, err := this.getPageResources(pageno)
+	if err != nil {
+		return plan, errors.Wrap(err, "Failed to get page resources")
+	}
+	if err = this.collectDependencies(resources, seen, nil); err != nil {
+		return plan, err
+	}
+
+	if annots {
+		if err = this.collectAnnotDependencies(pageno, seen); err != nil {
+			return plan, err
+		}
+	}
+
+	for id := range seen {
+		obj, err := this.resolveObject(&PdfValue{Type: PDF_TYPE_OBJREF, Id: id})
+		if err != nil {
+			return plan, errors.Wrap(err, fmt.Sprintf("Failed to resolve object %d", id))
+		}
+
+		plan.Objects++
+		if obj.Type == PDF_TYPE_STREAM {
+			plan.StreamObjects++
+			if obj.Stream != nil {
+				plan.StreamBytes += len(obj.Stream.Bytes)
+			}
+		}
+	}
+
+	return plan, nil
+}
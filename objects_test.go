@@ -0,0 +1,210 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestListObjects(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+	objs[4] = "42"
+	objs[5] = "[1 2 3]"
+	data := buildPdf(objs)
+
+	importer := newTestImporter(t, data)
+	summaries, err := importer.ListObjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset := func(id int) int {
+		return bytes.Index(data, []byte(fmt.Sprintf("\n%d 0 obj", id))) + 1
+	}
+	want := []ObjectSummary{
+		{Id: 1, Type: "/Catalog", Kind: "dictionary", Offset: offset(1)},
+		{Id: 2, Type: "/Pages", Kind: "dictionary", Offset: offset(2)},
+		{Id: 3, Type: "/Font", Kind: "dictionary", Offset: offset(3)},
+		{Id: 4, Kind: "numeric", Offset: offset(4)},
+		{Id: 5, Kind: "array", Offset: offset(5)},
+		{Id: 10, Type: "/Page", Kind: "dictionary", Offset: offset(10)},
+		{Id: 11, Kind: "stream", Offset: offset(11)},
+	}
+	if len(summaries) != len(want) {
+		t.Fatalf("got %d objects %v, want %d", len(summaries), summaries, len(want))
+	}
+	for i := range want {
+		if summaries[i] != want[i] {
+			t.Errorf("got %+v, want %+v", summaries[i], want[i])
+		}
+	}
+}
+
+// Objects in an object stream have the id of the object stream instead of an offset
+func TestListObjectsObjectStream(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+	compressed := map[int]string{2: objs[2], 3: objs[3], 10: objs[10]}
+	for id := range compressed {
+		delete(objs, id)
+	}
+	data := buildObjStmPdf(objs, compressed, "", nil)
+
+	importer := newTestImporter(t, data)
+	summaries, err := importer.ListObjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The object stream is object 12, and the xref stream object 13
+	got := make(map[int]ObjectSummary, len(summaries))
+	for _, summary := range summaries {
+		got[summary.Id] = summary
+	}
+	want := map[int]ObjectSummary{
+		2:  {Id: 2, Type: "/Pages", Kind: "dictionary", Offset: -1, ObjStmId: 12},
+		3:  {Id: 3, Type: "/Font", Kind: "dictionary", Offset: -1, ObjStmId: 12},
+		10: {Id: 10, Type: "/Page", Kind: "dictionary", Offset: -1, ObjStmId: 12},
+		12: {Id: 12, Type: "/ObjStm", Kind: "stream", Offset: bytes.Index(data, []byte("\n12 0 obj")) + 1},
+	}
+	for id, summary := range want {
+		if got[id] != summary {
+			t.Errorf("got %+v, want %+v", got[id], summary)
+		}
+	}
+}
+
+// The dependencies of a page include the objects it shares with other pages, and not the page tree
+func TestGetPageDependencies(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj /Im1 Do ET", "BT /F1 12 Tf (two) Tj ET")
+	objs[10] = strings.Replace(objs[10], "/Font <<", "/XObject << /Im1 4 0 R >> /Font <<", 1)
+	objs[10] = strings.Replace(objs[10], "/Contents", "/Annots [20 0 R] /Contents", 1)
+	objs[4] = pdfStream("/Type /XObject /Subtype /Image /Width 1 /Height 1 /BitsPerComponent 8 /ColorSpace /DeviceGray /SMask 5 0 R", "\x80")
+	objs[5] = pdfStream("/Type /XObject /Subtype /Image /Width 1 /Height 1 /BitsPerComponent 8 /ColorSpace /DeviceGray", "\xff")
+	objs[20] = "<< /Type /Annot /Subtype /Text /Rect [0 0 10 10] /P 10 0 R /Popup 21 0 R >>"
+	objs[21] = "<< /Type /Annot /Subtype /Popup /Rect [0 0 100 100] /Parent 20 0 R >>"
+
+	// The font (3) is shared by both pages
+	tests := []struct {
+		pageno int
+		want   []int
+	}{
+		{1, []int{3, 4, 5, 11, 20, 21}},
+		{2, []int{3, 13}},
+	}
+
+	importer := newTestImporter(t, buildPdf(objs))
+	for _, test := range tests {
+		got, err := importer.GetPageDependencies(test.pageno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("page %d: got dependencies %v, want %v", test.pageno, got, test.want)
+		}
+	}
+}
+
+// The plan of a page import counts the objects that the import writes
+func TestPlanImport(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj /Im1 Do ET", "BT /F1 12 Tf (two) Tj ET")
+	objs[10] = strings.Replace(objs[10], "/Font <<", "/XObject << /Im1 4 0 R >> /Font <<", 1)
+	objs[10] = strings.Replace(objs[10], "/Contents", "/Annots [20 0 R] /Contents", 1)
+	objs[4] = pdfStream("/Type /XObject /Subtype /Image /Width 1 /Height 1 /BitsPerComponent 8 /ColorSpace /DeviceGray /SMask 5 0 R", "\x80")
+	objs[5] = pdfStream("/Type /XObject /Subtype /Image /Width 1 /Height 1 /BitsPerComponent 8 /ColorSpace /DeviceGray", "\xff")
+	objs[20] = "<< /Type /Annot /Subtype /Text /Rect [0 0 10 10] /P 10 0 R /Popup 21 0 R >>"
+	objs[21] = "<< /Type /Annot /Subtype /Popup /Rect [0 0 100 100] /Parent 20 0 R >>"
+	data := buildPdf(objs)
+
+	tests := []struct {
+		name   string
+		pageno int
+		annots bool
+		want   ImportPlan
+	}{
+		{"images", 1, false, ImportPlan{Objects: 4, StreamObjects: 3, StreamBytes: 2, ContentBytes: 32}},
+		{"annotations", 1, true, ImportPlan{Objects: 6, StreamObjects: 3, StreamBytes: 2, ContentBytes: 32}},
+		{"font", 2, false, ImportPlan{Objects: 2, StreamObjects: 1, StreamBytes: 0, ContentBytes: 24}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := newTestImporter(t, data)
+			importer.SetImportAnnotations(test.annots)
+
+			plan, err := importer.PlanImport(test.pageno, "/MediaBox")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan != test.want {
+				t.Errorf("got plan %+v, want %+v", plan, test.want)
+			}
+
+			// Planning writes nothing
+			if n := len(importer.GetImportedObjects()); n != 0 {
+				t.Errorf("planning wrote %d objects", n)
+			}
+
+			// The import writes the planned objects
+			importer.ImportPage(test.pageno, "/MediaBox")
+			_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			streams := 0
+			for _, object := range objects {
+				if bytes.Contains(object, []byte("endstream")) {
+					streams++
+				}
+			}
+			if len(objects) != plan.Objects || streams != plan.StreamObjects {
+				t.Errorf("import wrote %d objects and %d streams, planned %d and %d", len(objects), streams, plan.Objects, plan.StreamObjects)
+			}
+		})
+	}
+
+	if _, err := newTestImporter(t, data).PlanImport(1, "/Foo"); err == nil {
+		t.Error("expected an error for a box that does not exist")
+	}
+}
+
+// A raw object is serialized with its references kept as they are
+func TestGetRawObject(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+	objs[4] = "<< /Fonts [3 0 R << /Name /F1 >>] >>"
+	objs[5] = "[1 2.5 (text) /Name true null]"
+	objs[6] = "42"
+
+	tests := []struct {
+		name string
+		id   int
+		want string
+	}{
+		{"dictionary", 4, "<</Fonts [3 0 R <</Name /F1 >>]\n>>"},
+		{"array", 5, "[1 2.500000 (text)/Name true null ]"},
+		{"number", 6, "42"},
+		{"stream", 11, "<</Length 24 >>stream\nBT /F1 12 Tf (one) Tj ET\nendstream"},
+	}
+
+	importer := newTestImporter(t, buildPdf(objs))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := importer.GetRawObject(test.id, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	// Nothing is imported
+	if n := len(importer.GetImportedObjects()); n != 0 {
+		t.Errorf("got %d imported objects", n)
+	}
+
+	if _, err := importer.GetRawObject(99, 0); err == nil {
+		t.Error("expected an error for an object that does not exist")
+	}
+}
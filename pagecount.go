@@ -0,0 +1,79 @@
+package gofpdi
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Get the number of pages of a pdf file from the /Count of its page tree, without reading the pages
+func CountPages(path string) (int, error) {
+	reader, err := newPdfReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	return reader.countPages()
+}
+
+// Get the number of pages of a pdf stream from the /Count of its page tree, without reading the pages
+func CountPagesFromStream(rs io.ReadSeeker) (int, error) {
+	reader, err := newPdfReaderFromStream("", rs)
+	if err != nil {
+		return 0, err
+	}
+
+	return reader.countPages()
+}
+
+// Read the xref and catalog, and get the /Count of the root of the page tree
+func (this *PdfReader) countPages() (int, error) {
+	var err error
+
+	if err = this.findXref(); err != nil {
+		return 0, errors.Wrap(err, "Failed to find xref position")
+	}
+
+	if err = this.readXref(); err != nil {
+		return 0, errors.Wrap(err, "Failed to read xref table")
+	}
+
+	if this.trailer == nil {
+		return 0, errors.New("Trailer with /Root not found")
+	}
+
+	if err = this.readRoot(); err != nil {
+		return 0, errors.Wrap(err, "Failed to read root")
+	}
+
+	pagesRef, ok := this.catalog.Value.Dictionary["/Pages"]
+	if !ok {
+		return 0, errors.New("Root object has no /Pages")
+	}
+
+	pages, err := this.resolveValue(pagesRef)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to resolve pages object")
+	}
+
+	if isSinglePage(pages) {
+		return 1, nil
+	}
+
+	countRef, ok := pages.Dictionary["/Count"]
+	if !ok {
+		return 0, errors.New("Page tree has no /Count")
+	}
+
+	count, err := this.resolveValue(countRef)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get page count")
+	}
+
+	if count.Type != PDF_TYPE_NUMERIC || count.Int < 0 {
+		return 0, errors.New("Page tree has no valid /Count")
+	}
+
+	return count.Int, nil
+}
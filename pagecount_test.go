@@ -0,0 +1,131 @@
+package gofpdi
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestCountPages(t *testing.T) {
+	tests := []struct {
+		name   string
+		count  string
+		prefix string
+		want   int
+		fails  bool
+	}{
+		{"count", "2", "", 2, false},
+		{"zero", "0", "", 0, false},
+		{"negative", "-1", "", 0, true},
+		{"real", "2.5", "", 0, true},
+		{"name", "/Two", "", 0, true},
+		{"bytes before header", "2", "garbage\n", 2, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET", "BT ET")
+			objs[2] = "<< /Type /Pages /Kids [10 0 R 12 0 R] /Count " + test.count + " >>"
+			data := append([]byte(test.prefix), buildPdf(objs)...)
+
+			file := writeTempPdf(t, data)
+			defer os.Remove(file)
+
+			before := countOpenFiles(t)
+			counts := map[string]func() (int, error){
+				"file":   func() (int, error) { return CountPages(file) },
+				"stream": func() (int, error) { return CountPagesFromStream(bytes.NewReader(data)) },
+			}
+			for source, count := range counts {
+				got, err := count()
+				if test.fails {
+					if err == nil {
+						t.Errorf("%s: expected an error, got %d", source, got)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%s: %v", source, err)
+				} else if got != test.want {
+					t.Errorf("%s: got %d pages, want %d", source, got, test.want)
+				}
+			}
+
+			// ValidateFile closes the file like CountPages, also if the file has bytes before the header
+			ValidateFile(file)
+			if after := countOpenFiles(t); after != before {
+				t.Errorf("%d files were left open", after-before)
+			}
+		})
+	}
+}
+
+// In lazy mode, GetNumPages reads the /Count of the page tree root without resolving its kids
+func TestGetNumPagesLazy(t *testing.T) {
+	data := buildPdf(pageTreePdf(100, 10))
+
+	for _, lazy := range []bool{false, true} {
+		resolved := 0
+		importer := NewImporter()
+		importer.SetLazyMode(lazy)
+		importer.SetTraceFunc(func(event string, args ...interface{}) {
+			if event == "object" {
+				resolved++
+			}
+		})
+		if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := importer.GetNumPages(); n != 100 {
+			t.Errorf("lazy %v: got %d pages, want 100", lazy, n)
+		}
+		if lazy && resolved > 2 {
+			t.Errorf("lazy mode resolved %d objects, want only the catalog and the page tree root", resolved)
+		}
+		if !lazy && resolved < 100 {
+			t.Errorf("default mode resolved %d objects, want every page", resolved)
+		}
+	}
+}
+
+// Count the pages of a 1000 page pdf with CountPagesFromStream and with the importer in lazy mode,
+// which read only the page tree root, and with the importer in the default mode, which reads the
+// whole page tree
+func BenchmarkCountPages(b *testing.B) {
+	contents := make([]string, 1000)
+	for i := range contents {
+		contents[i] = "BT /F1 12 Tf (page) Tj ET"
+	}
+	data := buildPdf(pagesPdf(contents...))
+
+	b.Run("CountPagesFromStream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := CountPagesFromStream(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, lazy := range []bool{false, true} {
+		name := "GetNumPages"
+		if lazy {
+			name = "GetNumPages lazy"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				importer := NewImporter()
+				importer.SetLazyMode(lazy)
+				if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+				if n := importer.GetNumPages(); n != len(contents) {
+					b.Fatalf("got %d pages, want %d", n, len(contents))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package gofpdi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Get the label of each page (e.g. "iv" or "A-12") from the /PageLabels of the catalog.
+// Pages without a label range, or all pages if the document has no /PageLabels, are labeled
+// with their page number.
+func (this *PdfReader) getPageLabels() ([]string, error) {
+	n, err := this.getNumPages()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get number of pages")
+	}
+
+	labels := make([]string, n)
+	for i := range labels {
+		labels[i] = strconv.Itoa(i + 1)
+	}
+
+	if this.catalog == nil || this.catalog.Value == nil {
+		return labels, nil
+	}
+
+	tree, ok := this.catalog.Value.Dictionary["/PageLabels"]
+	if !ok {
+		return labels, nil
+	}
+
+	entries := make([]*PdfValue, 0)
+	if err = this.readNumberTree(tree, &entries, 0); err != nil {
+		return nil, errors.Wrap(err, "Failed to read page labels number tree")
+	}
+
+	// The number tree has the index of the first page of a range followed by the label
+	// dictionary of the range.  The ranges are in order of their first page.
+	for i := 0; i+1 < len(entries); i += 2 {
+		start, err := this.resolveValue(entries[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to resolve page label index")
+		}
+
+		end := n
+		if i+3 < len(entries) {
+			next, err := this.resolveValue(entries[i+2])
+			if err != nil {
+				return nil, errors.Wrap(err, "Failed to resolve page label index")
+			}
+			end = next.Int
+		}
+
+		dict, err := this.resolveValue(entries[i+1])
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to resolve page label dictionary")
+		}
+
+		style := ""
+		if s, ok := dict.Dictionary["/S"]; ok {
+			style = s.Token
+		}
+
+		prefix := ""
+		if p, ok := dict.Dictionary["/P"]; ok {
+			prefix = decode_pdf_string(p)
+		}
+
+		first := decodeParm(dict, "/St", 1)
+
+		for page := start.Int; page < end && page < n; page++ {
+			if page < 0 {
+				continue
+			}
+			labels[page] = prefix + formatPageLabel(style, first+page-start.Int)
+		}
+	}
+
+	return labels, nil
+}
+
+// Format a page label number in a page label style (/D, /R, /r, /A or /a).  Without a style,
+// the label only consists of the prefix.
+func formatPageLabel(style string, n int) string {
+	switch style {
+	case "/D":
+		return strconv.Itoa(n)
+	case "/R":
+		return toRoman(n)
+	case "/r":
+		return strings.ToLower(toRoman(n))
+	case "/A":
+		return toLetters(n)
+	case "/a":
+		return strings.ToLower(toLetters(n))
+	}
+
+	return ""
+}
+
+// The largest numbers that are formatted as roman numerals and as letters.  The /St of a page label
+// range is not limited, and the length of the label grows with the number, so larger numbers are
+// formatted as decimal numbers.
+const (
+	maxRomanLabel  = 4999
+	maxLetterLabel = 26 * 256
+)
+
+// Convert a number to upper case roman numerals, e.g. 4 becomes IV
+func toRoman(n int) string {
+	if n <= 0 || n > maxRomanLabel {
+		return strconv.Itoa(n)
+	}
+
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	numerals := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+
+	var b strings.Builder
+	for i, v := range values {
+		for n >= v {
+			b.WriteString(numerals[i])
+			n -= v
+		}
+	}
+
+	return b.String()
+}
+
+// Convert a number to upper case letters as used for page labels: A to Z, then AA to ZZ, AAA...
+func toLetters(n int) string {
+	if n <= 0 || n > maxLetterLabel {
+		return strconv.Itoa(n)
+	}
+
+	letter := string(rune('A' + (n-1)%26))
+	return strings.Repeat(letter, (n-1)/26+1)
+}
+
+// Get the page number (starting at 1) of the page with a label
+func (this *PdfReader) getPageByLabel(label string) (int, error) {
+	labels, err := this.getPageLabels()
+	if err != nil {
+		return 0, err
+	}
+
+	pageno := 0
+	for i, l := range labels {
+		if l != label {
+			continue
+		}
+		if pageno != 0 {
+			return 0, errors.New(fmt.Sprintf("Page label %q is ambiguous: used by pages %d and %d", label, pageno, i+1))
+		}
+		pageno = i + 1
+	}
+
+	if pageno == 0 {
+		return 0, errors.New(fmt.Sprintf("Page label %q not found", label))
+	}
+
+	return pageno, nil
+}
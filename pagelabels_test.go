@@ -0,0 +1,100 @@
+package gofpdi
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFormatPageLabel(t *testing.T) {
+	tests := []struct {
+		style string
+		n     int
+		want  string
+	}{
+		{"/D", 12, "12"},
+		{"/R", 4, "IV"},
+		{"/R", 1994, "MCMXCIV"},
+		{"/r", 9, "ix"},
+		{"/R", 0, "0"},
+		{"/R", 4999, "MMMMCMXCIX"},
+		{"/A", 1, "A"},
+		{"/A", 27, "AA"},
+		{"/a", 54, "bbb"},
+		{"/A", 0, "0"},
+		{"", 3, ""},
+
+		// A large /St is formatted as a decimal number instead of a very long label
+		{"/R", 5000, "5000"},
+		{"/r", 2000000000, "2000000000"},
+		{"/A", 26*256 + 1, strconv.Itoa(26*256 + 1)},
+		{"/a", 2000000000, "2000000000"},
+	}
+
+	for _, test := range tests {
+		if got := formatPageLabel(test.style, test.n); got != test.want {
+			t.Errorf("formatPageLabel(%q, %d) = %q, want %q", test.style, test.n, got, test.want)
+		}
+	}
+
+	if got := formatPageLabel("/A", 26*256); got != strings.Repeat("Z", 256) {
+		t.Errorf("formatPageLabel(/A, %d) = %q", 26*256, got)
+	}
+}
+
+func TestImportPageByLabel(t *testing.T) {
+	// Pages i to iii, then A-12 and A-13, then a range with a huge start
+	objs := pagesPdf("BT (page 1) Tj ET", "BT (page 2) Tj ET", "BT (page 3) Tj ET", "BT (page 4) Tj ET", "BT (page 5) Tj ET", "BT (page 6) Tj ET")
+	objs[1] = "<< /Type /Catalog /Pages 2 0 R /PageLabels << /Nums [0 << /S /r >> 3 << /S /D /P (A-) /St 12 >> 5 << /S /R /St 2000000000 >>] >> >>"
+	importer := newTestImporter(t, buildPdf(objs))
+
+	labels, err := importer.GetPageLabels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"i", "ii", "iii", "A-12", "A-13", "2000000000"}
+	if strings.Join(labels, ",") != strings.Join(want, ",") {
+		t.Errorf("got labels %q, want %q", labels, want)
+	}
+
+	tests := []struct {
+		label   string
+		content string
+		fails   bool
+	}{
+		{"iii", "(page 3)", false},
+		{"i", "(page 1)", false},
+		{"A-13", "(page 5)", false},
+		{"2000000000", "(page 6)", false},
+		{"iv", "", true},
+		{"3", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			tplid, err := importer.ImportPageByLabel(test.label, "/MediaBox")
+			if test.fails {
+				if err == nil {
+					t.Errorf("expected an error, got template %d", tplid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content := templateContent(t, importer, tplid); !strings.Contains(content, test.content) {
+				t.Errorf("template content %q does not contain %s", content, test.content)
+			}
+		})
+	}
+}
+
+func TestImportPageByLabelAmbiguous(t *testing.T) {
+	objs := pagesPdf("BT ET", "BT ET", "BT ET")
+	objs[1] = "<< /Type /Catalog /Pages 2 0 R /PageLabels << /Nums [0 << /S /D >> 2 << /S /D /St 2 >>] >> >>"
+	importer := newTestImporter(t, buildPdf(objs))
+
+	if _, err := importer.ImportPageByLabel("2", "/MediaBox"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("expected an ambiguous label error, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package gofpdi
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Information about a page, to decide which pages to import
+type PageInfo struct {
+	Number int // Page number, starting at 1
+	// Width and height of the page as displayed: the /CropBox (or the box it defaults to), with
+	// width and height swapped for pages rotated by 90 or 270 degrees
+	Width  float64
+	Height float64
+	// Effective rotation in degrees (0, 90, 180 or 270)
+	Rotation int
+	// The boxes of the page, with boxes that are not defined replaced by the box they default to
+	Boxes map[string]map[string]float64
+	// Names of the resources of the page by category, e.g. "/Font": ["/F1", "/F2"]
+	Resources map[string][]string
+}
+
+// Get information about a page
+func (this *PdfReader) getPageInfo(pageno int) (PageInfo, error) {
+	info := PageInfo{Number: pageno, Resources: make(map[string][]string, 0)}
+
+	boxes, err := this.getPageBoxes(pageno, 1.0)
+	if err != nil {
+		return info, errors.Wrap(err, "Failed to get page boxes")
+	}
+	for boxName, box := range boxes {
+		if len(box) == 0 {
+			_, boxes[boxName] = resolveBoxWithFallback(boxes, boxName)
+		}
+	}
+	info.Boxes = boxes
+
+	info.Rotation, err = this.getNormalizedPageRotation(pageno)
+	if err != nil {
+		return info, errors.Wrap(err, "Failed to get page rotation")
+	}
+
+	_, box := resolveBoxWithFallback(boxes, "/CropBox")
+	info.Width, info.Height = box["w"], box["h"]
+	if info.Rotation%180 != 0 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+
+	resources, err := this.getPageResources(pageno)
+	if err != nil {
+		return info, errors.Wrap(err, "Failed to get page resources")
+	}
+
+	for category, entries := range resources.Dictionary {
+		entries, err = this.resolveValue(entries)
+		if err != nil {
+			return info, errors.Wrap(err, "Failed to resolve resource object")
+		}
+		if entries.Type != PDF_TYPE_DICTIONARY {
+			continue
+		}
+
+		names := make([]string, 0, len(entries.Dictionary))
+		for name := range entries.Dictionary {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		info.Resources[category] = names
+	}
+
+	return info, nil
+}
+
+// Get information about all pages of the current source document, in page order
+func (this *Importer) GetPages() ([]PageInfo, error) {
+	reader := this.GetReader()
+
+	n, err := reader.getNumPages()
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]PageInfo, n)
+	for i := range pages {
+		pages[i], err = reader.getPageInfo(i + 1)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to get information about page "+strconv.Itoa(i+1))
+		}
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,178 @@
+package gofpdi
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// A catalog whose /Pages is a page is a document with one page
+func TestCatalogPagesIsPage(t *testing.T) {
+	objs := map[int]string{
+		1:  "<< /Type /Catalog /Pages 10 0 R >>",
+		3:  "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		10: "<< /Type /Page /MediaBox [0 0 300 400] /Resources << /Font << /F1 3 0 R >> >> /Contents 11 0 R >>",
+		11: pdfStream("", "BT /F1 12 Tf (single page) Tj ET"),
+	}
+	data := buildPdf(objs)
+
+	for _, lazy := range []bool{false, true} {
+		importer := NewImporter()
+		importer.SetLazyMode(lazy)
+		if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := importer.GetNumPages(); n != 1 {
+			t.Errorf("lazy %v: got %d pages, want 1", lazy, n)
+		}
+		tplids, err := importer.ImportPages([]int{1}, "/MediaBox")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w, h := templateSize(t, importer, tplids[0]); w != 300 || h != 400 {
+			t.Errorf("lazy %v: got template %.0f x %.0f, want 300 x 400", lazy, w, h)
+		}
+		if content := templateContent(t, importer, tplids[0]); !strings.Contains(content, "(single page)") {
+			t.Errorf("lazy %v: got content %q", lazy, content)
+		}
+		if _, err := importer.ImportPages([]int{2}, "/MediaBox"); err == nil {
+			t.Errorf("lazy %v: page 2: expected an error", lazy)
+		}
+	}
+}
+
+// Kids of the page tree that are missing, freed or null are skipped with a warning
+func TestNullKids(t *testing.T) {
+	tests := []struct {
+		name string
+		kid  string
+	}{
+		{"dangling reference", "99 0 R"},
+		{"freed object", "5 0 R"},
+		{"null", "null"},
+		{"reference to null", "6 0 R"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET")
+			objs[2] = "<< /Type /Pages /Kids [10 0 R " + test.kid + " 12 0 R] /Count 3 >>"
+			objs[6] = "null"
+			data := buildPdf(objs)
+
+			for _, lazy := range []bool{false, true} {
+				importer := NewImporter()
+				importer.SetLazyMode(lazy)
+				if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+					t.Fatal(err)
+				}
+
+				if !lazy {
+					if n := importer.GetNumPages(); n != 2 {
+						t.Errorf("got %d pages, want 2", n)
+					}
+					if warnings := importer.GetWarnings(); !in_array("Page tree has 2 pages, but /Count is 3", warnings) {
+						t.Errorf("got warnings %q", warnings)
+					}
+				}
+
+				// The kid after the skipped kid is page 2
+				tplids, err := importer.ImportPages([]int{1, 2}, "/MediaBox")
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i, want := range []string{"(one)", "(two)"} {
+					if content := templateContent(t, importer, tplids[i]); !strings.Contains(content, want) {
+						t.Errorf("lazy %v: page %d has content %q, want %s", lazy, i+1, content, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGetPages(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj /Im1 Do ET", "0 0 m 100 100 l S")
+	objs[12] = strings.Replace(objs[12], "/MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >>", "/MediaBox [0 0 612 792] /CropBox [0 0 300 400] /Rotate 90 /Resources << /Font << /F1 3 0 R /F2 3 0 R >> /XObject << /Im1 20 0 R >> >>", 1)
+	objs[14] = strings.Replace(objs[14], "/MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >>", "/MediaBox [0 0 200 100] /Resources << >>", 1)
+	objs[20] = pdfStream("/Type /XObject /Subtype /Image /Width 1 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8", "\x00")
+
+	tests := []struct {
+		width, height float64
+		rotation      int
+		trimBox       [4]float64 // llx, lly, urx, ury
+		resources     string     // The names of the resources by category
+	}{
+		{612, 792, 0, [4]float64{0, 0, 612, 792}, "/Font /F1"},
+		{400, 300, 90, [4]float64{0, 0, 300, 400}, "/Font /F1 /F2; /XObject /Im1"},
+		{200, 100, 0, [4]float64{0, 0, 200, 100}, ""},
+	}
+
+	pages, err := newTestImporter(t, buildPdf(objs)).GetPages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != len(tests) {
+		t.Fatalf("got %d pages, want %d", len(pages), len(tests))
+	}
+
+	for i, test := range tests {
+		page := pages[i]
+		if page.Number != i+1 {
+			t.Errorf("page %d: got number %d", i+1, page.Number)
+		}
+		if page.Width != test.width || page.Height != test.height || page.Rotation != test.rotation {
+			t.Errorf("page %d: got %.0f x %.0f rotated %d, want %.0f x %.0f rotated %d", i+1, page.Width, page.Height, page.Rotation, test.width, test.height, test.rotation)
+		}
+
+		// The trim box defaults to the crop box, which defaults to the media box
+		box := page.Boxes["/TrimBox"]
+		if got := [4]float64{box["llx"], box["lly"], box["urx"], box["ury"]}; got != test.trimBox {
+			t.Errorf("page %d: got /TrimBox %v, want %v", i+1, got, test.trimBox)
+		}
+
+		categories := make([]string, 0, len(page.Resources))
+		for category, names := range page.Resources {
+			categories = append(categories, category+" "+strings.Join(names, " "))
+		}
+		sort.Strings(categories)
+		if got := strings.Join(categories, "; "); got != test.resources {
+			t.Errorf("page %d: got resources %q, want %q", i+1, got, test.resources)
+		}
+	}
+}
+
+// Every node of the page tree, and the /Kids arrays, may be in object streams
+func TestCompressedPageTree(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET", "BT /F1 12 Tf (three) Tj ET")
+	objs[2] = "<< /Type /Pages /Kids 4 0 R /Count 3 >>"
+	objs[4] = "[5 0 R 14 0 R]"
+	objs[5] = "<< /Type /Pages /Parent 2 0 R /Count 2 /Kids [10 0 R 12 0 R] >>"
+	objs[10] = strings.Replace(objs[10], "/Parent 2 0 R", "/Parent 5 0 R", 1)
+	objs[12] = strings.Replace(objs[12], "/Parent 2 0 R", "/Parent 5 0 R", 1)
+
+	// Only the content streams are not compressed
+	compressed := make(map[int]string)
+	for id, obj := range objs {
+		if !strings.Contains(obj, "stream") {
+			compressed[id] = obj
+			delete(objs, id)
+		}
+	}
+
+	for _, filter := range []string{"", "/FlateDecode"} {
+		importer := newTestImporter(t, buildObjStmPdf(objs, compressed, filter, deflate))
+		if n := importer.GetNumPages(); n != 3 {
+			t.Fatalf("%s: got %d pages, want 3", filter, n)
+		}
+
+		for pageno, want := range []string{"(one)", "(two)", "(three)"} {
+			tplid := importer.ImportPage(pageno+1, "/MediaBox")
+			if content := templateContent(t, importer, tplid); !strings.Contains(content, want) {
+				t.Errorf("%s: got content %q of page %d, want %s", filter, content, pageno+1, want)
+			}
+		}
+	}
+}
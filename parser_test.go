@@ -0,0 +1,155 @@
+package gofpdi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Integers are only read as an object reference if they are followed by R
+func TestReadValueReferences(t *testing.T) {
+	reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildPdf(pagesPdf("BT ET"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"[12 0 34]", "12 0 34"},
+		{"[12 0 R]", "12@0"},
+		{"[12 0 R 34]", "12@0 34"},
+		{"[1 0 0 1 0 0]", "1 0 0 1 0 0"},
+		{"[1 2 3 0 R]", "1 2 3@0"},
+		{"[12 0 obj]", "12 0 obj"},
+		{"[12 -1 R]", "12 -1 R"},
+		{"[1.5 0 R]", "1.5 0 R"},
+		{"<< /Matrix [1 0 0 1 0 0] /Ref 5 0 R >>", "/Matrix: 1 0 0 1 0 0, /Ref: 5@0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(test.value + " "))
+			token, err := reader.readToken(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := reader.readValue(r, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeValue(value); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+// Describe a parsed value, with references written as id@gen
+func describeValue(value *PdfValue) string {
+	switch value.Type {
+	case PDF_TYPE_NUMERIC:
+		return fmt.Sprintf("%d", value.Int)
+	case PDF_TYPE_REAL:
+		return fmt.Sprintf("%g", value.Real)
+	case PDF_TYPE_OBJREF:
+		return fmt.Sprintf("%d@%d", value.Id, value.Gen)
+	case PDF_TYPE_ARRAY:
+		s := make([]string, len(value.Array))
+		for i, v := range value.Array {
+			s[i] = describeValue(v)
+		}
+		return strings.Join(s, " ")
+	case PDF_TYPE_DICTIONARY:
+		keys := make([]string, 0, len(value.Dictionary))
+		for key := range value.Dictionary {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		s := make([]string, len(keys))
+		for i, key := range keys {
+			s[i] = key + ": " + describeValue(value.Dictionary[key])
+		}
+		return strings.Join(s, ", ")
+	}
+	return value.Token
+}
+
+// Parse errors include the offset at which the file, or the data of an object stream, was read
+func TestParseErrorOffset(t *testing.T) {
+	objs := pagesPdf("BT ET")
+	objs[3] = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> garbage"
+	data := buildPdf(objs)
+	reader, err := NewPdfReaderFromStream("test", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = reader.resolveObject(&PdfValue{Type: PDF_TYPE_OBJREF, Id: 3})
+	if want := fmt.Sprintf("got: garbage at offset %d", bytes.Index(data, []byte("garbage"))+len("garbage")); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("object: got error %v, want %s", err, want)
+	}
+
+	// An unterminated string in the trailer is read up to the end of the file
+	data = bytes.Replace(buildPdf(pagesPdf("BT ET")), []byte("trailer\n<<"), []byte("trailer\n<< /Size ("), 1)
+	_, err = NewPdfReaderFromStream("test", bytes.NewReader(data))
+	if want := fmt.Sprintf("at offset %d", len(data)); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("xref: got error %v, want %s", err, want)
+	}
+
+	// The offset of a compressed object is in the data of its object stream
+	objs = pagesPdf("BT ET")
+	compressed := map[int]string{3: "(unterminated"}
+	delete(objs, 3)
+	reader, err = NewPdfReaderFromStream("test", bytes.NewReader(buildObjStmPdf(objs, compressed, "", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = reader.resolveObject(&PdfValue{Type: PDF_TYPE_OBJREF, Id: 3})
+	if want := fmt.Sprintf("at offset %d", len("3 0 (unterminated\n")); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("compressed object: got error %v, want %s", err, want)
+	}
+}
+
+// Comments between obj and the value, and between the value and the stream keyword, are skipped
+func TestObjectComments(t *testing.T) {
+	const content = "% stream data is kept\nBT /F1 12 Tf (one) Tj ET"
+
+	tests := []struct {
+		name string
+		objs func(objs map[int]string)
+	}{
+		{"before the dictionary", func(objs map[int]string) {
+			objs[10] = "% a comment\n" + objs[10]
+			objs[11] = "% a comment\n" + objs[11]
+		}},
+		{"several comments", func(objs map[int]string) {
+			objs[10] = "%\n%% two comments\n" + objs[10]
+		}},
+		{"before the stream keyword", func(objs map[int]string) {
+			objs[11] = strings.Replace(objs[11], ">>\nstream", ">> % stream and endstream in a comment\nstream", 1)
+		}},
+		{"on a line before the stream keyword", func(objs map[int]string) {
+			objs[11] = strings.Replace(objs[11], ">>\nstream", ">>\n% /Length 1\n\nstream", 1)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf(content)
+			test.objs(objs)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			got, err := importer.GetPageContentStream(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("got content %q, want %q", got, content)
+			}
+		})
+	}
+}
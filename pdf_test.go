@@ -0,0 +1,266 @@
+package gofpdi
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"testing"
+)
+
+// Build a pdf with a classic xref table from objects by id.  The catalog is object 1.
+func buildPdf(objs map[int]string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	ids := make([]int, 0, len(objs))
+	size := 0
+	for id := range objs {
+		ids = append(ids, id)
+		if id >= size {
+			size = id + 1
+		}
+	}
+	sort.Ints(ids)
+
+	offsets := make(map[int]int, len(objs))
+	for _, id := range ids {
+		offsets[id] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", id, objs[id])
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for id := 1; id < size; id++ {
+		if offset, ok := offsets[id]; ok {
+			fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+		} else {
+			buf.WriteString("0000000000 65535 f \n")
+		}
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, xref)
+
+	return buf.Bytes()
+}
+
+// A stream object with an uncompressed data
+func pdfStream(dict string, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// Objects of a pdf with one page for each content stream, which use the font /F1
+func pagesPdf(contents ...string) map[int]string {
+	kids := ""
+	objs := map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		3: "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	for i, content := range contents {
+		page := 10 + 2*i
+		kids += fmt.Sprintf("%d 0 R ", page)
+		objs[page] = fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", page+1)
+		objs[page+1] = pdfStream("", content)
+	}
+	objs[2] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(contents))
+
+	return objs
+}
+
+// An importer whose source is a pdf in memory
+func newTestImporter(t testing.TB, data []byte) *Importer {
+	importer := NewImporter()
+	if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	return importer
+}
+
+// An object id allocator that counts up from first
+func idCounter(first int) func() int {
+	n := first - 1
+	return func() int {
+		n++
+		return n
+	}
+}
+
+// Get the content of a template as it is inlined in a page content stream
+func templateContent(t testing.TB, importer *Importer, tplid int) string {
+	content, _, _, err := importer.GetTemplateContent(tplid, idCounter(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// Get the width and height of a template
+func templateSize(t testing.TB, importer *Importer, tplid int) (float64, float64) {
+	tplInfo, err := importer.getTplInfo(tplid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := tplInfo.Writer.tpls[tplInfo.TemplateId]
+	return tpl.W, tpl.H
+}
+
+// Build a pdf with an xref stream from objects by id.  The objects in compressed are stored in an
+// object stream.  The data of the object stream and of the xref stream is encoded with encode and
+// filter (e.g. /FlateDecode), or not encoded if filter is empty.  The catalog is object 1.
+func buildObjStmPdf(objs map[int]string, compressed map[int]string, filter string, encode func([]byte) []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+
+	size := 0
+	for _, m := range []map[int]string{objs, compressed} {
+		for id := range m {
+			if id >= size {
+				size = id + 1
+			}
+		}
+	}
+	objStmId := size
+	xrefId := size + 1
+
+	// The object stream has the ids and offsets of its objects, followed by the objects
+	ids := make([]int, 0, len(compressed))
+	for id := range compressed {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	var header, body bytes.Buffer
+	index := make(map[int]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+		fmt.Fprintf(&header, "%d %d ", id, body.Len())
+		body.WriteString(compressed[id] + "\n")
+	}
+	data := append(header.Bytes(), body.Bytes()...)
+	dict := fmt.Sprintf("/Type /ObjStm /N %d /First %d", len(ids), header.Len())
+	if filter != "" {
+		data = encode(data)
+		dict += " /Filter " + filter
+	}
+
+	all := make(map[int]string, len(objs)+1)
+	for id, obj := range objs {
+		all[id] = obj
+	}
+	all[objStmId] = fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+
+	ids = ids[:0]
+	for id := range all {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	offsets := make(map[int]int, len(all))
+	for _, id := range ids {
+		offsets[id] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", id, all[id])
+	}
+
+	// Entries of 1 byte type, 4 bytes offset or object stream id, and 2 bytes generation or index
+	var xref bytes.Buffer
+	for id := 0; id <= xrefId; id++ {
+		if offset, ok := offsets[id]; ok {
+			xref.Write([]byte{1, byte(offset >> 24), byte(offset >> 16), byte(offset >> 8), byte(offset), 0, 0})
+		} else if i, ok := index[id]; ok {
+			xref.Write([]byte{2, byte(objStmId >> 24), byte(objStmId >> 16), byte(objStmId >> 8), byte(objStmId), byte(i >> 8), byte(i)})
+		} else if id == xrefId {
+			offset := buf.Len()
+			xref.Write([]byte{1, byte(offset >> 24), byte(offset >> 16), byte(offset >> 8), byte(offset), 0, 0})
+		} else {
+			xref.Write([]byte{0, 0, 0, 0, 0, 255, 255})
+		}
+	}
+
+	data = xref.Bytes()
+	dict = fmt.Sprintf("/Type /XRef /Size %d /W [1 4 2] /Root 1 0 R", xrefId+1)
+	if filter != "" {
+		data = encode(data)
+		dict += " /Filter " + filter
+	}
+
+	start := buf.Len()
+	fmt.Fprintf(&buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n", xrefId, dict, len(data))
+	buf.Write(data)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", start)
+
+	return buf.Bytes()
+}
+
+// Append an incremental update with objects by id and a classic xref table to a pdf.  The trailer of
+// the update has the given entries, where %d is replaced by the offset of the previous xref section.
+func appendUpdate(data []byte, objs map[int]string, trailer string) []byte {
+	prev := 0
+	i := bytes.LastIndex(data, []byte("startxref"))
+	fmt.Sscanf(string(data[i:]), "startxref\n%d", &prev)
+
+	buf := bytes.NewBuffer(append([]byte(nil), data...))
+	ids := make([]int, 0, len(objs))
+	for id := range objs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	offsets := make(map[int]int, len(objs))
+	for _, id := range ids {
+		offsets[id] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", id, objs[id])
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	for _, id := range ids {
+		fmt.Fprintf(buf, "%d 1\n%010d 00000 n \n", id, offsets[id])
+	}
+	size := ids[len(ids)-1] + 1
+	fmt.Fprintf(buf, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", size, fmt.Sprintf(trailer, prev), xref)
+
+	return buf.Bytes()
+}
+
+// Split an imported stream object into its dictionary and its data
+func splitStream(t testing.TB, object []byte) (string, []byte) {
+	i := bytes.Index(object, []byte("stream\n"))
+	j := bytes.LastIndex(object, []byte("\nendstream"))
+	if i < 0 || j < i+7 {
+		t.Fatalf("object %q is not a stream", object)
+	}
+	return string(object[:i]), object[i+7 : j]
+}
+
+// Find the imported object that contains s
+func findObject(t testing.TB, objects map[int][]byte, s string) (int, []byte) {
+	for id, object := range objects {
+		if bytes.Contains(object, []byte(s)) {
+			return id, object
+		}
+	}
+	t.Fatalf("no object contains %s", s)
+	return 0, nil
+}
+
+// Compress data with /FlateDecode
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// Get the decoded data of an imported stream object compressed with /FlateDecode
+func inflate(t testing.TB, object []byte) []byte {
+	_, data := splitStream(t, object)
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
@@ -0,0 +1,85 @@
+package gofpdi
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// Check if the document is a pdf portfolio (collection), which has a /Collection dictionary in its
+// catalog
+func (this *PdfReader) isPortfolio() bool {
+	if this.catalog == nil || this.catalog.Value == nil {
+		return false
+	}
+
+	_, ok := this.catalog.Value.Dictionary["/Collection"]
+	return ok
+}
+
+// Get the documents of a portfolio: its attachments that are pdfs
+func (this *PdfReader) getPortfolioDocuments() ([]Attachment, error) {
+	if !this.isPortfolio() {
+		return nil, errors.New("Document is not a pdf portfolio")
+	}
+
+	attachments, err := this.getAttachments()
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		// The header may follow some garbage, like in any other pdf file
+		header := attachment.Data
+		if len(header) > 1024 {
+			header = header[:1024]
+		}
+		if attachment.MimeType == "application/pdf" || bytes.Contains(header, []byte("%PDF-")) {
+			documents = append(documents, attachment)
+		}
+	}
+
+	return documents, nil
+}
+
+// Get the names of the pdf documents in the current source, which must be a pdf portfolio
+func (this *Importer) ListPortfolioDocuments() ([]string, error) {
+	documents, err := this.GetReader().getPortfolioDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(documents))
+	for i, document := range documents {
+		names[i] = document.Name
+	}
+
+	return names, nil
+}
+
+// Set a pdf document of the current source, which must be a pdf portfolio, as the source.  name is
+// one of the names returned by ListPortfolioDocuments.  To select another document of the portfolio,
+// set the portfolio as the source again first.
+func (this *Importer) SetSourcePortfolioEntry(name string) error {
+	source := this.sourceFile + "#" + name
+	if _, ok := this.readers[source]; ok {
+		return this.setSourceStream(source, nil)
+	}
+
+	documents, err := this.GetReader().getPortfolioDocuments()
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		if document.Name == name {
+			if err = this.setSourceStream(source, bytes.NewReader(document.Data)); err != nil {
+				return errors.Wrap(err, "Failed to read portfolio document "+name)
+			}
+			return nil
+		}
+	}
+
+	return errors.New("Portfolio document " + name + " not found")
+}
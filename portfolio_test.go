@@ -0,0 +1,76 @@
+package gofpdi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPortfolio(t *testing.T) {
+	// A portfolio with two pdf documents and a text file
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"a.pdf", buildPdf(pagesPdf("BT /F1 12 Tf (a one) Tj ET"))},
+		{"b.pdf", buildPdf(pagesPdf("BT /F1 12 Tf (b one) Tj ET", "BT /F1 12 Tf (b two) Tj ET"))},
+		{"notes.txt", []byte("Not a pdf")},
+	}
+	objs := pagesPdf("BT /F1 12 Tf (cover) Tj ET")
+	objs[1] = "<< /Type /Catalog /Pages 2 0 R /Names << /EmbeddedFiles 5 0 R >> /Collection << /Type /Collection /View /T >> >>"
+	names := ""
+	for i, file := range files {
+		names += fmt.Sprintf("(%s) %d 0 R ", file.name, 20+2*i)
+		objs[20+2*i] = fmt.Sprintf("<< /Type /Filespec /F (%s) /UF (%s) /EF << /F %d 0 R >> >>", file.name, file.name, 21+2*i)
+		objs[21+2*i] = pdfStream("/Type /EmbeddedFile", string(file.data))
+	}
+	objs[5] = "<< /Names [" + names + "] >>"
+
+	importer := newTestImporter(t, buildPdf(objs))
+	documents, err := importer.ListPortfolioDocuments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(documents, " ") != "a.pdf b.pdf" {
+		t.Fatalf("got documents %v, want a.pdf and b.pdf", documents)
+	}
+
+	// Select each document, setting the portfolio as the source again in between
+	for _, document := range []struct {
+		name     string
+		contents []string
+	}{
+		{"b.pdf", []string{"BT /F1 12 Tf (b one) Tj ET", "BT /F1 12 Tf (b two) Tj ET"}},
+		{"a.pdf", []string{"BT /F1 12 Tf (a one) Tj ET"}},
+		{"b.pdf", []string{"BT /F1 12 Tf (b one) Tj ET", "BT /F1 12 Tf (b two) Tj ET"}},
+	} {
+		if err := importer.setSourceStream("test.pdf", nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := importer.SetSourcePortfolioEntry(document.name); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := importer.GetNumPages(); n != len(document.contents) {
+			t.Fatalf("%s: got %d pages, want %d", document.name, n, len(document.contents))
+		}
+		for i, want := range document.contents {
+			tplid := importer.ImportPage(i+1, "/MediaBox")
+			if content := templateContent(t, importer, tplid); !strings.Contains(content, want) {
+				t.Errorf("%s: got content %q of page %d, want %q", document.name, content, i+1, want)
+			}
+		}
+	}
+
+	// Other attachments are not documents of the portfolio
+	importer.setSourceStream("test.pdf", nil)
+	if err := importer.SetSourcePortfolioEntry("notes.txt"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("got error %v for notes.txt, want not found", err)
+	}
+
+	// A pdf with attachments but without a /Collection is not a portfolio
+	objs[1] = "<< /Type /Catalog /Pages 2 0 R /Names << /EmbeddedFiles 5 0 R >> >>"
+	if _, err := newTestImporter(t, buildPdf(objs)).ListPortfolioDocuments(); err == nil {
+		t.Errorf("got documents of a pdf that is not a portfolio")
+	}
+}
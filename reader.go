@@ -3,43 +3,63 @@ package gofpdi
 import (
 	"bufio"
 	"bytes"
-	"compress/zlib"
-	"encoding/binary"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
 
 	"github.com/pkg/errors"
 )
 
+// Filters defined by the pdf specification
+var standardFilters = []string{"/ASCIIHexDecode", "/ASCII85Decode", "/LZWDecode", "/FlateDecode", "/RunLengthDecode",
+	"/CCITTFaxDecode", "/JBIG2Decode", "/DCTDecode", "/JPXDecode", "/Crypt"}
+
 type PdfReader struct {
 	availableBoxes []string
 	stack          []string
 	trailer        *PdfValue
 	catalog        *PdfValue
 	pages          []*PdfValue
+	pagesRoot      *PdfValue
 	xrefPos        int
 	xref           map[int]map[int]int
 	xrefStream     map[int][2]int
 	f              io.ReadSeeker
+	file           *os.File
 	nBytes         int64
 	sourceFile     string
 	curPage        int
 	alreadyRead    bool
 	pageCount      int
+	lazy           bool
+	depth          int
+	warnings       []string
+	trace          func(event string, args ...interface{})
+	limits         ResourceLimits
+	encryptErr     error
+	xrefSeen       map[int]bool
+	xrefSection    map[int]bool
+	unknownFilter  func(name string, data []byte) ([]byte, error)
+	unmap          func() error
+	resources      map[int]*PdfValue
+	pageTreeKids   map[*PdfValue][]pageTreeKid
+}
+
+// A kid of a page tree node, see getPageTreeKids
+type pageTreeKid struct {
+	Ref   *PdfValue
+	Node  bool // The kid is a /Pages node rather than a page
+	Count int  // Number of pages of the kid: 1 for a page, 0 for a kid that is skipped
 }
 
 func NewPdfReaderFromStream(sourceFile string, rs io.ReadSeeker) (*PdfReader, error) {
-	length, err := rs.Seek(0, 2)
+	parser, err := newPdfReaderFromStream(sourceFile, rs)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to determine stream length")
-	}
-	parser := &PdfReader{f: rs, sourceFile: sourceFile, nBytes: length}
-	if err := parser.init(); err != nil {
-		return nil, errors.Wrap(err, "Failed to initialize parser")
+		return nil, err
 	}
 	if err := parser.read(); err != nil {
 		return nil, errors.Wrap(err, "Failed to read pdf from stream")
@@ -48,6 +68,67 @@ func NewPdfReaderFromStream(sourceFile string, rs io.ReadSeeker) (*PdfReader, er
 }
 
 func NewPdfReader(filename string) (*PdfReader, error) {
+	parser, err := newPdfReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err = parser.read(); err != nil {
+		parser.Close()
+		return nil, errors.Wrap(err, "Failed to read pdf")
+	}
+
+	return parser, nil
+}
+
+// Create a PdfReader for a memory-mapped file, so that objects are read from memory without seeking
+// the file.  This is faster for large files.  Where memory mapping is not supported, the file is read
+// like NewPdfReader.  Close unmaps the file.
+func NewPdfReaderMmap(filename string) (*PdfReader, error) {
+	parser, err := newPdfReaderMmap(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err = parser.read(); err != nil {
+		parser.Close()
+		return nil, errors.Wrap(err, "Failed to read pdf")
+	}
+
+	return parser, nil
+}
+
+// Close the file of a reader created from a file name, and unmap a memory-mapped file.  The reader
+// cannot be used afterwards.
+func (this *PdfReader) Close() error {
+	var err error
+
+	if this.file != nil {
+		err = this.file.Close()
+		this.file = nil
+	}
+
+	if this.unmap != nil {
+		if e := this.unmap(); e != nil && err == nil {
+			err = e
+		}
+		this.unmap = nil
+	}
+
+	return err
+}
+
+// Create a PdfReader for a stream without reading it, so that options can be set before calling read()
+func newPdfReaderFromStream(sourceFile string, rs io.ReadSeeker) (*PdfReader, error) {
+	length, err := rs.Seek(0, 2)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to determine stream length")
+	}
+	parser := &PdfReader{f: rs, sourceFile: sourceFile, nBytes: length}
+	parser.init()
+	return parser, nil
+}
+
+// Create a PdfReader for a file without reading it, so that options can be set before calling read()
+func newPdfReader(filename string) (*PdfReader, error) {
 	var err error
 	f, err := os.Open(filename)
 	if err != nil {
@@ -55,29 +136,81 @@ func NewPdfReader(filename string) (*PdfReader, error) {
 	}
 	info, err := f.Stat()
 	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "Failed to obtain file information")
+	}
+
+	parser := &PdfReader{f: f, file: f, sourceFile: filename, nBytes: info.Size()}
+	parser.init()
+	return parser, nil
+}
+
+// Create a PdfReader for a memory-mapped file without reading it, or for the file if it cannot be mapped
+func newPdfReaderMmap(filename string) (*PdfReader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to open file")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
 		return nil, errors.Wrap(err, "Failed to obtain file information")
 	}
 
-	parser := &PdfReader{f: f, sourceFile: filename, nBytes: info.Size()}
-	if err = parser.init(); err != nil {
-		return nil, errors.Wrap(err, "Failed to initialize parser")
+	// Empty files cannot be mapped
+	var data []byte
+	var unmap func() error
+	if info.Size() > 0 {
+		data, unmap, err = mmapFile(f, info.Size())
 	}
-	if err = parser.read(); err != nil {
-		return nil, errors.Wrap(err, "Failed to read pdf")
+	if info.Size() == 0 || err != nil {
+		parser := &PdfReader{f: f, file: f, sourceFile: filename, nBytes: info.Size()}
+		parser.init()
+		return parser, nil
 	}
 
+	// The mapping stays valid after the file is closed
+	f.Close()
+
+	parser := &PdfReader{f: bytes.NewReader(data), sourceFile: filename, nBytes: info.Size(), unmap: unmap}
+	parser.init()
 	return parser, nil
 }
 
-func (this *PdfReader) init() error {
+func (this *PdfReader) init() {
 	this.availableBoxes = []string{"/MediaBox", "/CropBox", "/BleedBox", "/TrimBox", "/ArtBox"}
 	this.xref = make(map[int]map[int]int, 0)
 	this.xrefStream = make(map[int][2]int, 0)
-	err := this.read()
-	if err != nil {
-		return errors.Wrap(err, "Failed to read pdf")
-	}
-	return nil
+	this.xrefSeen = make(map[int]bool, 0)
+	this.resources = make(map[int]*PdfValue, 0)
+	this.pageTreeKids = make(map[*PdfValue][]pageTreeKid, 0)
+}
+
+// Set the page boxes that are resolved for each page, in order (default /MediaBox, /CropBox,
+// /BleedBox, /TrimBox and /ArtBox).  Boxes that are not in the list are not resolved.
+func (this *PdfReader) SetAvailableBoxes(boxes []string) {
+	this.availableBoxes = append([]string(nil), boxes...)
+}
+
+// In lazy mode, only references to pages are kept.  Page objects are resolved when they are needed
+// and released afterwards, so memory usage scales with one page rather than the whole document.
+// Must be set before the pdf is read.
+func (this *PdfReader) SetLazyMode(b bool) {
+	this.lazy = b
+}
+
+// Set a function that is called on parse events, for debugging pdfs that fail to parse.
+// Events are "xref" (position), "object" (id, gen), "filter" (filter name), and
+// "fallback" (description).  Pass nil to disable tracing.
+func (this *PdfReader) SetTraceFunc(fn func(event string, args ...interface{})) {
+	this.trace = fn
+}
+
+// Set a function that decodes stream filters that gofpdi does not support (e.g. a proprietary
+// filter).  It is called with the filter name (e.g. "/MyDecode") and the data to decode.  If no
+// function is set, streams with unsupported filters fail to decode.
+func (this *PdfReader) SetUnknownFilterHandler(fn func(name string, data []byte) ([]byte, error)) {
+	this.unknownFilter = fn
 }
 
 type PdfValue struct {
@@ -202,9 +335,8 @@ func (this *PdfReader) readToken(r *bufio.Reader) (string, error) {
 		return this.readToken(r)
 
 	default:
-		// FIXME this may not be performant to create new strings for each byte
-		// Is it probably better to create a buffer and then convert to a string at the end.
-		str := string(b)
+		var buf bytes.Buffer
+		buf.WriteByte(b)
 
 	loop:
 		for {
@@ -217,13 +349,28 @@ func (this *PdfReader) readToken(r *bufio.Reader) (string, error) {
 				r.UnreadByte()
 				break loop
 			default:
-				str += string(b)
+				buf.WriteByte(b)
+				if err = this.checkTokenLength(buf.Len()); err != nil {
+					return "", err
+				}
 			}
 		}
-		return str, nil
+		return buf.String(), nil
+	}
+}
+
+// Wrap a parse error with the offset at which r stopped reading from s (the file, or the data of
+// an object stream), so that the problem can be found.  If err is nil, a new error is returned.
+func parseError(s io.Seeker, r *bufio.Reader, err error, msg string) error {
+	if pos, serr := s.Seek(0, io.SeekCurrent); serr == nil {
+		msg = fmt.Sprintf("%s at offset %d", msg, pos-int64(r.Buffered()))
+	}
+
+	if err == nil {
+		return errors.New(msg)
 	}
 
-	return "", nil
+	return errors.Wrap(err, msg)
 }
 
 // Read a value based on a token
@@ -242,24 +389,29 @@ func (this *PdfReader) readValue(r *bufio.Reader, t string) (*PdfValue, error) {
 		// This is a hex string
 
 		// Read bytes until '>' is found
-		var s string
+		var buf bytes.Buffer
 		for {
 			b, err = r.ReadByte()
 			if err != nil {
 				return nil, errors.Wrap(err, "Failed to read byte")
 			}
 			if b != '>' {
-				s += string(b)
+				buf.WriteByte(b)
 			} else {
 				break
 			}
 		}
 
 		result.Type = PDF_TYPE_HEX
-		result.String = s
+		result.String = buf.String()
 
 	case "<<":
 		// This is a dictionary
+		this.depth++
+		defer func() { this.depth-- }()
+		if err := this.checkDepth(); err != nil {
+			return nil, err
+		}
 
 		// Recurse into this function until we reach the end of the dictionary.
 		for {
@@ -306,6 +458,11 @@ func (this *PdfReader) readValue(r *bufio.Reader, t string) (*PdfValue, error) {
 
 	case "[":
 		// This is an array
+		this.depth++
+		defer func() { this.depth-- }()
+		if err := this.checkDepth(); err != nil {
+			return nil, err
+		}
 
 		tmpResult := make([]*PdfValue, 0)
 
@@ -395,8 +552,8 @@ func (this *PdfReader) readValue(r *bufio.Reader, t string) (*PdfValue, error) {
 				return nil, errors.Wrap(err, "Failed to read token")
 			}
 			if t2 != "" {
-				if is_numeric(t2) {
-					// Two numeric tokens in a row.
+				if is_object_number(t) && is_object_number(t2) {
+					// Two integer tokens in a row.
 					// In this case, we're probably in front of either an object reference
 					// or an object specification.
 					// Determine the case and return the data.
@@ -408,6 +565,11 @@ func (this *PdfReader) readValue(r *bufio.Reader, t string) (*PdfValue, error) {
 					if t3 != "" {
 						switch t3 {
 						case "obj":
+							// Object specifications can only appear at the top level, not inside an array
+							// or dictionary.  Otherwise, treat the tokens as plain numbers.
+							if this.depth > 0 {
+								break
+							}
 							result.Type = PDF_TYPE_OBJDEC
 							result.Id, _ = strconv.Atoi(t)
 							result.Gen, _ = strconv.Atoi(t2)
@@ -464,6 +626,11 @@ func (this *PdfReader) resolveCompressedObject(objSpec *PdfValue) (*PdfValue, er
 	objectId := this.xrefStream[objSpec.Id][0]
 	objectIndex := this.xrefStream[objSpec.Id][1]
 
+	// Object streams cannot be compressed themselves, which could otherwise lead to endless recursion
+	if _, ok := this.xref[objectId]; !ok {
+		return nil, errors.New(fmt.Sprintf("Object stream %d of object %d is not in the xref table", objectId, objSpec.Id))
+	}
+
 	// Read compressed object
 	compressedObjSpec := &PdfValue{Type: PDF_TYPE_OBJREF, Id: objectId, Gen: 0}
 
@@ -472,6 +639,9 @@ func (this *PdfReader) resolveCompressedObject(objSpec *PdfValue) (*PdfValue, er
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to resolve compressed object")
 	}
+	if compressedObj.Type != PDF_TYPE_STREAM {
+		return nil, errors.New(fmt.Sprintf("Object stream %d is not a stream", objectId))
+	}
 
 	// Verify object type is /ObjStm
 	if _, ok := compressedObj.Value.Dictionary["/Type"]; ok {
@@ -483,40 +653,32 @@ func (this *PdfReader) resolveCompressedObject(objSpec *PdfValue) (*PdfValue, er
 	}
 
 	// Get number of sub-objects in compressed object
-	n := compressedObj.Value.Dictionary["/N"].Int
+	n := decodeParm(compressedObj.Value, "/N", 0)
 	if n <= 0 {
 		return nil, errors.New("No sub objects in compressed object")
 	}
 
 	// Get offset of first object
-	first := compressedObj.Value.Dictionary["/First"].Int
+	first := decodeParm(compressedObj.Value, "/First", 0)
 
 	// Get length
 	//length := compressedObj.Value.Dictionary["/Length"].Int
 
-	// Check for filter
-	filter := ""
-	if _, ok := compressedObj.Value.Dictionary["/Filter"]; ok {
-		filter = compressedObj.Value.Dictionary["/Filter"].Token
-		if filter != "/FlateDecode" {
-			return nil, errors.New("Unsupported filter - expected /FlateDecode, got: " + filter)
-		}
+	// Decode the object stream with the same filters as content streams
+	data, err := this.rebuildContentStream(compressedObj)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode object stream")
 	}
 
-	if filter == "/FlateDecode" {
-		// Decompress if filter is /FlateDecode
-		// Uncompress zlib compressed data
-		var out bytes.Buffer
-		zlibReader, _ := zlib.NewReader(bytes.NewBuffer(compressedObj.Stream.Bytes))
-		defer zlibReader.Close()
-		io.Copy(&out, zlibReader)
-
-		// Set stream to uncompressed data
-		compressedObj.Stream.Bytes = out.Bytes()
-	}
+	// A number is read ahead of the tokens that follow it, which belong to the next object of the
+	// stream (e.g. the /Count of a page tree node, followed by a /Kids array).  Keep them off the
+	// token stack of the file.
+	stack := this.stack
+	this.stack = nil
+	defer func() { this.stack = stack }()
 
 	// Get io.Reader for bytes
-	r := bufio.NewReader(bytes.NewBuffer(compressedObj.Stream.Bytes))
+	r := bufio.NewReader(bytes.NewBuffer(data))
 
 	subObjId := 0
 	subObjPos := 0
@@ -558,7 +720,7 @@ func (this *PdfReader) resolveCompressedObject(objSpec *PdfValue) (*PdfValue, er
 	}
 
 	// Now create an io.ReadSeeker
-	rs := io.ReadSeeker(bytes.NewReader(compressedObj.Stream.Bytes))
+	rs := io.ReadSeeker(bytes.NewReader(data))
 
 	// Determine where to seek to (sub-object position + /First)
 	seekTo := int64(subObjPos + first)
@@ -572,13 +734,13 @@ func (this *PdfReader) resolveCompressedObject(objSpec *PdfValue) (*PdfValue, er
 	// Read token
 	token, err := this.readToken(r)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to read token")
+		return nil, parseError(rs, r, err, "Failed to read token")
 	}
 
 	// Read object
 	obj, err := this.readValue(r, token)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to read value for token: "+token)
+		return nil, parseError(rs, r, err, "Failed to read value for token: "+token)
 	}
 
 	result := &PdfValue{}
@@ -587,13 +749,150 @@ func (this *PdfReader) resolveCompressedObject(objSpec *PdfValue) (*PdfValue, er
 	result.Type = PDF_TYPE_OBJECT
 	result.Value = obj
 
+	if this.trace != nil {
+		this.trace("object", result.Id, result.Gen)
+	}
+
 	return result, nil
 }
 
+// Skip the end of line (CRLF or LF) after the stream keyword.  Unlike skipWhitespace, this does not
+// skip any further bytes, which belong to the stream data even if they are whitespace.
+// Spaces before the end of line, and a single CR, are tolerated.
+func (this *PdfReader) skipStreamEol(r *bufio.Reader) error {
+	peek, err := r.Peek(18)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+
+	i := 0
+	for i < len(peek) && (peek[i] == ' ' || peek[i] == '\t') {
+		i++
+	}
+
+	// Without an end of line, the data starts right after the keyword
+	if i == len(peek) || (peek[i] != '\r' && peek[i] != '\n') {
+		return nil
+	}
+
+	if peek[i] == '\r' && i+1 < len(peek) && peek[i+1] == '\n' {
+		i++
+	}
+
+	_, err = r.Discard(i + 1)
+	return err
+}
+
+// Read the data of a stream with the given length.  Returns false if the data is not followed by
+// endstream, i.e. the length is wrong.
+func (this *PdfReader) readStreamData(r *bufio.Reader, length int) ([]byte, bool) {
+	if length < 0 || int64(length) > this.nBytes {
+		return nil, false
+	}
+
+	data := make([]byte, length)
+
+	// Cannot use reader.Read() because that may not read all the bytes
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, false
+	}
+
+	token, err := this.readToken(r)
+	if err != nil || token != "endstream" {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// Get the data of the stream of the object at offset by searching for the stream and endstream
+// keywords.  Leaves the file positioned after endstream.
+func (this *PdfReader) recoverStreamData(offset int64) ([]byte, error) {
+	_, err := this.f.Seek(offset, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to set position of file")
+	}
+
+	var buf []byte
+	chunk := make([]byte, 65536)
+	start := -1
+
+	// Where to continue searching for the keywords, so that each chunk is searched once, plus the
+	// bytes of a keyword that may have been split between chunks
+	streamFrom := 0
+	endFrom := 0
+
+	for {
+		n, err := this.f.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+
+		// Find the start of the data, after the stream keyword and its end of line
+		if start < 0 {
+			if i := bytes.Index(buf[streamFrom:], []byte("stream")); i >= 0 && len(buf) > streamFrom+i+7 {
+				start = streamFrom + i + 6
+				if buf[start] == '\r' {
+					start++
+				}
+				if buf[start] == '\n' {
+					start++
+				}
+				endFrom = start
+			} else if i >= 0 {
+				streamFrom += i
+			} else if len(buf) > len("stream") {
+				streamFrom = len(buf) - len("stream")
+			}
+		}
+
+		if start >= 0 {
+			if i := bytes.Index(buf[endFrom:], []byte("endstream")); i >= 0 {
+				i += endFrom - start
+				end := start + i
+
+				// Remove the end of line before endstream
+				if end > start && buf[end-1] == '\n' {
+					end--
+				}
+				if end > start && buf[end-1] == '\r' {
+					end--
+				}
+
+				_, err = this.f.Seek(offset+int64(start+i+len("endstream")), 0)
+				if err != nil {
+					return nil, errors.Wrap(err, "Failed to set position of file")
+				}
+
+				return buf[start:end], nil
+			}
+
+			// Stop reading a stream without endstream once it exceeds the maximum stream size
+			if err := this.checkStreamSize(len(buf) - start); err != nil {
+				return nil, err
+			}
+
+			if len(buf)-len("endstream") > endFrom {
+				endFrom = len(buf) - len("endstream")
+			}
+		}
+
+		if err == io.EOF || n == 0 {
+			return nil, errors.New("Could not find endstream")
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read stream")
+		}
+	}
+}
+
 func (this *PdfReader) resolveObject(objSpec *PdfValue) (*PdfValue, error) {
 	var err error
 	var old_pos int64
 
+	// A missing dictionary entry or array element
+	if objSpec == nil {
+		return nil, errors.New("Object is missing")
+	}
+
 	// Create new bufio.Reader
 	r := bufio.NewReader(this.f)
 
@@ -620,44 +919,9 @@ func (this *PdfReader) resolveObject(objSpec *PdfValue) (*PdfValue, error) {
 			return nil, errors.Wrap(err, "Failed to set position of file")
 		}
 
-		token, err := this.readToken(r)
-		if err != nil {
-			return nil, errors.Wrap(err, "Failed to read token")
-		}
-
-		obj, err := this.readValue(r, token)
-		if err != nil {
-			return nil, errors.Wrap(err, "Failed to read value for token: "+token)
-		}
-
-		if obj.Type != PDF_TYPE_OBJDEC {
-			return nil, errors.New(fmt.Sprintf("Expected type to be PDF_TYPE_OBJDEC, got: %d", obj.Type))
-		}
-
-		if obj.Id != objSpec.Id {
-			return nil, errors.New(fmt.Sprintf("Object ID (%d) does not match ObjSpec ID (%d)", obj.Id, objSpec.Id))
-		}
-
-		if obj.Gen != objSpec.Gen {
-			return nil, errors.New("Object Gen does not match ObjSpec Gen")
-		}
-
-		// Read next token
-		token, err = this.readToken(r)
-		if err != nil {
-			return nil, errors.Wrap(err, "Failed to read token")
-		}
-
-		// Read actual object value
-		value, err := this.readValue(r, token)
-		if err != nil {
-			return nil, errors.Wrap(err, "Failed to read value for token: "+token)
-		}
-
-		// Read next token
-		token, err = this.readToken(r)
+		obj, value, token, err := this.readObjectValue(r, objSpec)
 		if err != nil {
-			return nil, errors.Wrap(err, "Failed to read token")
+			return nil, err
 		}
 
 		result := &PdfValue{}
@@ -669,60 +933,66 @@ func (this *PdfReader) resolveObject(objSpec *PdfValue) (*PdfValue, error) {
 		if token == "stream" {
 			result.Type = PDF_TYPE_STREAM
 
-			err = this.skipWhitespace(r)
+			err = this.skipStreamEol(r)
 			if err != nil {
-				return nil, errors.Wrap(err, "Failed to skip whitespace")
+				return nil, errors.Wrap(err, "Failed to skip end of line after stream keyword")
 			}
 
-			// Get stream length dictionary
-			lengthDict := value.Dictionary["/Length"]
-
-			// Get number of bytes of stream
-			length := lengthDict.Int
-
-			// If lengthDict is an object reference, resolve the object and set length
-			if lengthDict.Type == PDF_TYPE_OBJREF {
-				lengthDict, err = this.resolveObject(lengthDict)
-
+			// Get number of bytes of stream.  The length may be a reference to an object, which may
+			// itself be in an object stream.  A missing or invalid length is recovered below.
+			length := -1
+			if lengthDict, ok := value.Dictionary["/Length"]; ok {
+				lengthDict, err = this.resolveValue(lengthDict)
 				if err != nil {
 					return nil, errors.Wrap(err, "Failed to resolve length object of stream")
 				}
 
-				// Set length to resolved object value
-				length = lengthDict.Value.Int
+				if lengthDict.Type == PDF_TYPE_NUMERIC {
+					length = lengthDict.Int
+				}
 			}
 
-			// Read length bytes
-			bytes := make([]byte, length)
-
-			// Cannot use reader.Read() because that may not read all the bytes
-			_, err := io.ReadFull(r, bytes)
-			if err != nil {
-				return nil, errors.Wrap(err, "Failed to read bytes from buffer")
+			if err = this.checkStreamSize(length); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Stream of object %d", obj.Id))
 			}
 
-			token, err = this.readToken(r)
-			if err != nil {
-				return nil, errors.Wrap(err, "Failed to read token")
-			}
-			if token != "endstream" {
-				return nil, errors.New("Expected next token to be: endstream, got: " + token)
+			// Read length bytes, which must be followed by endstream
+			data, ok := this.readStreamData(r, length)
+			if !ok {
+				// The /Length is wrong.  Find the end of the stream by searching for endstream instead.
+				data, err = this.recoverStreamData(int64(offset))
+				if err != nil {
+					return nil, errors.Wrap(err, "Failed to recover stream with wrong /Length")
+				}
+				if err = this.checkStreamSize(len(data)); err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("Stream of object %d", obj.Id))
+				}
+				this.warnings = append(this.warnings, fmt.Sprintf("Stream of object %d has wrong /Length %d, actual length is %d", obj.Id, length, len(data)))
+				if this.trace != nil {
+					this.trace("fallback", fmt.Sprintf("recovered stream of object %d by searching for endstream", obj.Id))
+				}
+
+				// Correct the /Length, so that the stream is written correctly when it is imported
+				value.Dictionary["/Length"] = &PdfValue{Type: PDF_TYPE_NUMERIC, Int: len(data), Real: float64(len(data))}
+
+				// The file is now positioned after endstream
+				r = bufio.NewReader(this.f)
 			}
 
 			token, err = this.readToken(r)
 			if err != nil {
-				return nil, errors.Wrap(err, "Failed to read token")
+				return nil, parseError(this.f, r, err, "Failed to read token")
 			}
 
 			streamObj := &PdfValue{}
 			streamObj.Type = PDF_TYPE_STREAM
-			streamObj.Bytes = bytes
+			streamObj.Bytes = data
 
 			result.Stream = streamObj
 		}
 
 		if token != "endobj" {
-			return nil, errors.New("Expected next token to be: endobj, got: " + token)
+			return nil, parseError(this.f, r, nil, "Expected next token to be: endobj, got: "+token)
 		}
 
 		// Reposition the file pointer to previous position
@@ -731,13 +1001,116 @@ func (this *PdfReader) resolveObject(objSpec *PdfValue) (*PdfValue, error) {
 			return nil, errors.Wrap(err, "Failed to set position of file")
 		}
 
+		if this.trace != nil {
+			this.trace("object", result.Id, result.Gen)
+		}
+
 		return result, nil
 
 	} else {
 		return objSpec, nil
 	}
+}
+
+// Read the header ("<id> <gen> obj") and value of an object at the position of r, and the token
+// after the value, which is "stream" for a stream
+func (this *PdfReader) readObjectValue(r *bufio.Reader, objSpec *PdfValue) (*PdfValue, *PdfValue, string, error) {
+	token, err := this.readToken(r)
+	if err != nil {
+		return nil, nil, "", parseError(this.f, r, err, "Failed to read token")
+	}
+
+	obj, err := this.readValue(r, token)
+	if err != nil {
+		return nil, nil, "", parseError(this.f, r, err, "Failed to read value for token: "+token)
+	}
+
+	if obj.Type != PDF_TYPE_OBJDEC {
+		return nil, nil, "", parseError(this.f, r, nil, fmt.Sprintf("Expected type to be PDF_TYPE_OBJDEC, got: %d", obj.Type))
+	}
+
+	if obj.Id != objSpec.Id {
+		return nil, nil, "", errors.New(fmt.Sprintf("Object ID (%d) does not match ObjSpec ID (%d)", obj.Id, objSpec.Id))
+	}
+
+	if obj.Gen != objSpec.Gen {
+		return nil, nil, "", errors.New("Object Gen does not match ObjSpec Gen")
+	}
+
+	// Read next token
+	token, err = this.readToken(r)
+	if err != nil {
+		return nil, nil, "", parseError(this.f, r, err, "Failed to read token")
+	}
+
+	// Read actual object value
+	value, err := this.readValue(r, token)
+	if err != nil {
+		return nil, nil, "", parseError(this.f, r, err, "Failed to read value for token: "+token)
+	}
+
+	// Read next token.  Comments between the value and the stream keyword (and between obj and
+	// the value) are skipped by readToken, so the stream data starts after the end of line
+	// that follows the keyword.
+	token, err = this.readToken(r)
+	if err != nil {
+		return nil, nil, "", parseError(this.f, r, err, "Failed to read token")
+	}
+
+	return obj, value, token, nil
+}
+
+// Resolve an object reference to its value without reading the data of a stream, e.g. to look at the
+// /Filter of a stream without loading it.  For a stream, this is the stream dictionary.
+func (this *PdfReader) resolveDictionary(objSpec *PdfValue) (*PdfValue, error) {
+	if objSpec == nil {
+		return nil, errors.New("Object is missing")
+	}
+	if objSpec.Type == PDF_TYPE_STREAM {
+		return objSpec.Value, nil
+	}
+	if objSpec.Type != PDF_TYPE_OBJREF {
+		return objSpec, nil
+	}
+
+	// Objects in object streams cannot be streams
+	offsets, ok := this.xref[objSpec.Id]
+	if !ok {
+		return this.resolveValue(objSpec)
+	}
+
+	old_pos, err := this.f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get current position of file")
+	}
+	defer this.f.Seek(old_pos, 0)
 
-	return &PdfValue{}, nil
+	_, err = this.f.Seek(int64(offsets[objSpec.Gen]), 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to set position of file")
+	}
+
+	_, value, _, err := this.readObjectValue(bufio.NewReader(this.f), objSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// Resolve an object reference and return its value.  Streams are returned as is, so that
+// both the stream dictionary (.Value) and the stream data (.Stream) are available.
+func (this *PdfReader) resolveValue(objSpec *PdfValue) (*PdfValue, error) {
+	res, err := this.resolveObject(objSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Type == PDF_TYPE_OBJECT {
+		return res.Value, nil
+	}
+
+	return res, nil
 }
 
 // Find the xref offset (should be at the end of the PDF)
@@ -767,12 +1140,20 @@ func (this *PdfReader) findXref() error {
 
 	// Create new bufio.Reader
 	r := bufio.NewReader(this.f)
+	found := false
 	for {
-		// Read all tokens until "startxref" is found
+		// Read all tokens until the last "startxref" is found.  Incremental updates that are smaller
+		// than toRead leave the startxref of the previous revision in the bytes that are read.
 		token, err := this.readToken(r)
 		if err != nil {
 			return errors.Wrap(err, "Failed to read token")
 		}
+		if token == "" {
+			if found {
+				break
+			}
+			return errors.New("Failed to find startxref token")
+		}
 
 		if token == "startxref" {
 			token, err = this.readToken(r)
@@ -789,7 +1170,7 @@ func (this *PdfReader) findXref() error {
 
 			// Successfully read the xref position
 			this.xrefPos = result
-			break
+			found = true
 		}
 	}
 
@@ -802,45 +1183,142 @@ func (this *PdfReader) findXref() error {
 
 	this.xrefPos = result
 
+	if this.trace != nil {
+		this.trace("xref", result)
+	}
+
+	// Offsets may be relative to a %PDF header that does not start the file
+	if err = this.checkHeaderOffset(); err != nil {
+		return errors.Wrap(err, "Failed to check pdf header")
+	}
+
 	return nil
 }
 
-// Read and parse the xref table
-func (this *PdfReader) readXref() error {
-	var err error
-
-	// Create new bufio.Reader
-	r := bufio.NewReader(this.f)
+// Like Acrobat, the header may be anywhere in the first 1024 bytes of the file
+const maxHeaderOffset = 1024
 
-	// Set file pointer to xref start
-	_, err = this.f.Seek(int64(this.xrefPos), 0)
-	if err != nil {
+// A file may start with bytes before the %PDF header, e.g. a UTF-8 byte order mark (EF BB BF) that
+// an editor added, or a mail or web server's junk.  If the offsets of the file are relative to the
+// header, as when the bytes were added after the pdf was written, the header is used as the origin
+// of all offsets.  The header may also be %!PS-Adobe-N.n PDF-M.m, which Acrobat accepts.
+func (this *PdfReader) checkHeaderOffset() error {
+	if _, err := this.f.Seek(0, 0); err != nil {
 		return errors.Wrap(err, "Failed to set position of file")
 	}
 
-	// Xref should start with 'xref'
-	t, err := this.readToken(r)
-	if err != nil {
-		return errors.Wrap(err, "Failed to read token")
+	head := make([]byte, maxHeaderOffset)
+	n, err := io.ReadFull(this.f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return errors.Wrap(err, "Failed to read pdf header")
+	}
+
+	loc := pdfHeaderRegexp.FindIndex(head[:n])
+	if loc == nil || loc[0] == 0 {
+		return nil
+	}
+	offset := loc[0]
+
+	// The offsets are relative to the start of the file if the xref is where startxref says
+	if this.isXrefAt(int64(this.xrefPos)) || !this.isXrefAt(int64(this.xrefPos+offset)) {
+		return nil
+	}
+
+	this.f = &offsetReadSeeker{rs: this.f, offset: int64(offset)}
+	this.nBytes -= int64(offset)
+	this.warnings = append(this.warnings, fmt.Sprintf("The file has %d bytes before the %%PDF header, which is used as the origin of offsets", offset))
+
+	return nil
+}
+
+// Check if an xref table or xref stream object starts at pos
+func (this *PdfReader) isXrefAt(pos int64) bool {
+	if _, err := this.f.Seek(pos, 0); err != nil {
+		return false
+	}
+
+	data := make([]byte, 32)
+	n, _ := io.ReadFull(this.f, data)
+
+	return xrefStartRegexp.Match(data[:n])
+}
+
+var pdfHeaderRegexp = regexp.MustCompile(`%PDF-|%!PS-Adobe-\d+\.\d+ PDF-`)
+
+var xrefStartRegexp = regexp.MustCompile(`^\s*(xref|\d+\s+\d+\s+obj)`)
+
+// A ReadSeeker whose position 0 is at offset in rs
+type offsetReadSeeker struct {
+	rs     io.ReadSeeker
+	offset int64
+}
+
+func (this *offsetReadSeeker) Read(p []byte) (int, error) {
+	return this.rs.Read(p)
+}
+
+func (this *offsetReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence == 0 {
+		offset += this.offset
+	}
+
+	pos, err := this.rs.Seek(offset, whence)
+	return pos - this.offset, err
+}
+
+// Read and parse the xref table or xref stream at xrefPos, and the older sections it references.
+// When an object is defined more than once, the definition of the newest section wins, and within a
+// section the last definition wins.
+func (this *PdfReader) readXref() error {
+	var err error
+
+	// Stop if a /Prev offset leads back to an xref section that has already been read
+	if this.xrefSeen[this.xrefPos] {
+		this.warnings = append(this.warnings, fmt.Sprintf("Xref section at offset %d is referenced more than once", this.xrefPos))
+		return nil
+	}
+	this.xrefSeen[this.xrefPos] = true
+
+	// The ids of the objects in this section, with true for objects in use.  The xref stream of a
+	// hybrid file (/XRefStm) belongs to the section of the xref table that references it.
+	section := this.xrefSection
+	if section == nil {
+		section = make(map[int]bool, 0)
+	}
+	this.xrefSection = nil
+
+	// Create new bufio.Reader
+	r := bufio.NewReader(this.f)
+
+	// Set file pointer to xref start
+	_, err = this.f.Seek(int64(this.xrefPos), 0)
+	if err != nil {
+		return errors.Wrap(err, "Failed to set position of file")
+	}
+
+	// Xref should start with 'xref'
+	t, err := this.readToken(r)
+	if err != nil {
+		return parseError(this.f, r, err, "Failed to read token")
 	}
 	if t != "xref" {
 		// Maybe this is an XRef stream ...
 		v, err := this.readValue(r, t)
 		if err != nil {
-			return errors.Wrap(err, "Failed to read XRef stream")
+			return parseError(this.f, r, err, "Failed to read XRef stream")
 		}
 
 		if v.Type == PDF_TYPE_OBJDEC {
 			// Read next token
 			t, err = this.readToken(r)
 			if err != nil {
-				return errors.Wrap(err, "Failed to read token")
+				return parseError(this.f, r, err, "Failed to read token")
 			}
 
 			// Read actual object value
 			v, err := this.readValue(r, t)
 			if err != nil {
-				return errors.Wrap(err, "Failed to read value for token: "+t)
+				return parseError(this.f, r, err, "Failed to read value for token: "+t)
 			}
 
 			// If /Type is set, check to see if it is XRef
@@ -848,25 +1326,6 @@ func (this *PdfReader) readXref() error {
 				if v.Dictionary["/Type"].Token == "/XRef" {
 					// Continue reading xref stream data now that it is confirmed that it is an xref stream
 
-					// Check for /DecodeParms
-					paethDecode := false
-					if _, ok := v.Dictionary["/DecodeParms"]; ok {
-						columns := 0
-						predictor := 0
-
-						if _, ok2 := v.Dictionary["/DecodeParms"].Dictionary["/Columns"]; ok2 {
-							columns = v.Dictionary["/DecodeParms"].Dictionary["/Columns"].Int
-						}
-						if _, ok2 := v.Dictionary["/DecodeParms"].Dictionary["/Predictor"]; ok2 {
-							predictor = v.Dictionary["/DecodeParms"].Dictionary["/Predictor"].Int
-						}
-
-						if columns > 4 || predictor > 12 {
-							return errors.New("Unsupported /DecodeParms - only tested with /Columns <= 4 and /Predictor <= 12")
-						}
-						paethDecode = true
-					}
-
 					/*
 						// Check to make sure field size is [1 2 1] - not yet tested with other field sizes
 						if v.Dictionary["/W"].Array[0].Int != 1 || v.Dictionary["/W"].Array[1].Int > 4 || v.Dictionary["/W"].Array[2].Int != 1 {
@@ -898,8 +1357,8 @@ func (this *PdfReader) readXref() error {
 						prevXref = v.Dictionary["/Prev"].Int
 					}
 
-					// Set root object
-					if _, ok := v.Dictionary["/Root"]; ok {
+					// Set root object.  The newest section is read first, so its trailer is kept.
+					if _, ok := v.Dictionary["/Root"]; ok && this.trailer == nil {
 						// Just set the whole dictionary with /Root key to keep compatibiltiy with existing code
 						this.trailer = v
 					} else {
@@ -909,13 +1368,11 @@ func (this *PdfReader) readXref() error {
 
 					startObject := index[0]
 
-					err = this.skipWhitespace(r)
-					if err != nil {
-						return errors.Wrap(err, "Failed to skip whitespace")
-					}
-
 					// Get stream length dictionary
-					lengthDict := v.Dictionary["/Length"]
+					lengthDict, ok := v.Dictionary["/Length"]
+					if !ok {
+						return errors.New("Xref stream has no /Length")
+					}
 
 					// Get number of bytes of stream
 					length := lengthDict.Int
@@ -929,20 +1386,28 @@ func (this *PdfReader) readXref() error {
 						}
 
 						// Set length to resolved object value
-						length = lengthDict.Value.Int
+						if lengthDict.Value != nil {
+							length = lengthDict.Value.Int
+						}
+					}
+					if length < 0 || int64(length) > this.nBytes {
+						return errors.New(fmt.Sprintf("Xref stream has an invalid /Length %d", length))
+					}
+					if err = this.checkStreamSize(length); err != nil {
+						return errors.Wrap(err, "Xref stream")
 					}
 
 					t, err = this.readToken(r)
 					if err != nil {
-						return errors.Wrap(err, "Failed to read token")
+						return parseError(this.f, r, err, "Failed to read token")
 					}
 					if t != "stream" {
-						return errors.New("Expected next token to be: stream, got: " + t)
+						return parseError(this.f, r, nil, "Expected next token to be: stream, got: "+t)
 					}
 
-					err = this.skipWhitespace(r)
+					err = this.skipStreamEol(r)
 					if err != nil {
-						return errors.Wrap(err, "Failed to skip whitespace")
+						return errors.Wrap(err, "Failed to skip end of line after stream keyword")
 					}
 
 					// Read length bytes
@@ -957,99 +1422,78 @@ func (this *PdfReader) readXref() error {
 					// Look for endstream token
 					t, err = this.readToken(r)
 					if err != nil {
-						return errors.Wrap(err, "Failed to read token")
+						return parseError(this.f, r, err, "Failed to read token")
 					}
 					if t != "endstream" {
-						return errors.New("Expected next token to be: endstream, got: " + t)
+						return parseError(this.f, r, nil, "Expected next token to be: endstream, got: "+t)
 					}
 
 					// Look for endobj token
 					t, err = this.readToken(r)
 					if err != nil {
-						return errors.Wrap(err, "Failed to read token")
+						return parseError(this.f, r, err, "Failed to read token")
 					}
 					if t != "endobj" {
-						return errors.New("Expected next token to be: endobj, got: " + t)
+						return parseError(this.f, r, nil, "Expected next token to be: endobj, got: "+t)
 					}
 
-					// Now decode zlib data
-					b := bytes.NewReader(data)
-
-					z, err := zlib.NewReader(b)
+					// Decode the stream data, including the PNG predictor that is usually used for xref streams
+					filters, parms, err := this.getStreamFilters(v)
 					if err != nil {
-						return errors.Wrap(err, "zlib.NewReader error")
+						return errors.Wrap(err, "Failed to get xref stream filters")
 					}
-					defer z.Close()
 
-					p, err := ioutil.ReadAll(z)
+					p, err := this.decodeStream(data, filters, parms)
 					if err != nil {
-						return errors.Wrap(err, "ioutil.ReadAll error")
+						return errors.Wrap(err, "Failed to decode xref stream")
 					}
 
-					objPos := 0
-					objGen := 0
 					i := startObject
 
-					// Decode result with paeth algorithm
-					var result []byte
-					b = bytes.NewReader(p)
+					if len(v.Dictionary["/W"].Array) < 3 {
+						return errors.New("Xref stream /W array does not contain 3 elements")
+					}
 
 					firstFieldSize := v.Dictionary["/W"].Array[0].Int
 					middleFieldSize := v.Dictionary["/W"].Array[1].Int
 					lastFieldSize := v.Dictionary["/W"].Array[2].Int
 
 					fieldSize := firstFieldSize + middleFieldSize + lastFieldSize
-					if paethDecode {
-						fieldSize++
+					if fieldSize <= 0 || firstFieldSize < 0 || middleFieldSize < 0 || lastFieldSize < 0 {
+						return errors.New("Invalid xref stream /W array")
 					}
 
-					prevRow := make([]byte, fieldSize)
-					for {
-						result = make([]byte, fieldSize)
-						_, err := io.ReadFull(b, result)
-						if err != nil {
-							if err == io.EOF {
-								break
-							} else {
-								return errors.Wrap(err, "io.ReadFull error")
-							}
-						}
+					for pos := 0; pos+fieldSize <= len(p); pos += fieldSize {
+						row := p[pos : pos+fieldSize]
 
-						if paethDecode {
-							filterPaeth(result, prevRow, fieldSize)
-							copy(prevRow, result)
+						// The type defaults to 1 if its field is omitted
+						objType := 1
+						if firstFieldSize > 0 {
+							objType = readBigEndian(row[:firstFieldSize])
 						}
+						field2 := readBigEndian(row[firstFieldSize : firstFieldSize+middleFieldSize])
+						field3 := readBigEndian(row[firstFieldSize+middleFieldSize:])
 
-						objectData := make([]byte, fieldSize)
-						if paethDecode {
-							copy(objectData, result[1:fieldSize])
-						} else {
-							copy(objectData, result[0:fieldSize])
+						// Entries of newer sections, and entries for objects in use of the xref table of a
+						// hybrid file, take precedence
+						if this.hasNewerXrefEntry(i, section) || section[i] {
+							objType = 0
 						}
 
-						if objectData[0] == 1 {
-							// Regular objects
-							b := make([]byte, 4)
-							copy(b[4-middleFieldSize:], objectData[1:1+middleFieldSize])
-
-							objPos = int(binary.BigEndian.Uint32(b))
-							objGen = int(objectData[firstFieldSize+middleFieldSize])
-
-							// Append map[int]int
+						if objType == 1 {
+							// Regular objects: position and generation
 							this.xref[i] = make(map[int]int, 1)
-
-							// Set object id, generation, and position
-							this.xref[i][objGen] = objPos
-						} else if objectData[0] == 2 {
-							// Compressed objects
-							b := make([]byte, 4)
-							copy(b[4-middleFieldSize:], objectData[1:1+middleFieldSize])
-
-							objId := int(binary.BigEndian.Uint32(b))
-							objIdx := int(objectData[firstFieldSize+middleFieldSize])
-
-							// object id (i) is located in StmObj (objId) at index (objIdx)
-							this.xrefStream[i] = [2]int{objId, objIdx}
+							this.xref[i][field3] = field2
+							delete(this.xrefStream, i)
+							section[i] = true
+						} else if objType == 2 {
+							// Compressed objects: object id (i) is located in StmObj (field2) at index (field3)
+							this.xrefStream[i] = [2]int{field2, field3}
+							delete(this.xref, i)
+							section[i] = true
+						}
+						if err = this.checkObjectCount(); err != nil {
+							return err
 						}
 
 						i++
@@ -1072,14 +1516,14 @@ func (this *PdfReader) readXref() error {
 			return nil
 		}
 
-		return errors.New("Expected xref to start with 'xref'.  Got: " + t)
+		return parseError(this.f, r, nil, "Expected xref to start with 'xref'.  Got: "+t)
 	}
 
 	for {
 		// Next value will be the starting object id (usually 0, but not always) or the trailer
 		t, err = this.readToken(r)
 		if err != nil {
-			return errors.Wrap(err, "Failed to read token")
+			return parseError(this.f, r, err, "Failed to read token")
 		}
 
 		// Check for trailer
@@ -1090,52 +1534,63 @@ func (this *PdfReader) readXref() error {
 		// Convert token to int
 		startObject, err := strconv.Atoi(t)
 		if err != nil {
-			return errors.Wrap(err, "Failed to convert start object to integer: "+t)
+			return parseError(this.f, r, err, "Failed to convert start object to integer: "+t)
 		}
 
 		// Determine how many objects there are
 		t, err = this.readToken(r)
 		if err != nil {
-			return errors.Wrap(err, "Failed to read token")
+			return parseError(this.f, r, err, "Failed to read token")
 		}
 
 		// Convert token to int
 		numObject, err := strconv.Atoi(t)
 		if err != nil {
-			return errors.Wrap(err, "Failed to convert num object to integer: "+t)
+			return parseError(this.f, r, err, "Failed to convert num object to integer: "+t)
 		}
 
 		// For all objects in xref, read object position, object generation, and status (free or new)
 		for i := startObject; i < startObject+numObject; i++ {
 			t, err = this.readToken(r)
 			if err != nil {
-				return errors.Wrap(err, "Failed to read token")
+				return parseError(this.f, r, err, "Failed to read token")
 			}
 
 			// Get object position as int
 			objPos, err := strconv.Atoi(t)
 			if err != nil {
-				return errors.Wrap(err, "Failed to convert object position to integer: "+t)
+				return parseError(this.f, r, err, "Failed to convert object position to integer: "+t)
 			}
 
 			t, err = this.readToken(r)
 			if err != nil {
-				return errors.Wrap(err, "Failed to read token")
+				return parseError(this.f, r, err, "Failed to read token")
 			}
 
 			// Get object generation as int
 			objGen, err := strconv.Atoi(t)
 			if err != nil {
-				return errors.Wrap(err, "Failed to convert object generation to integer: "+t)
+				return parseError(this.f, r, err, "Failed to convert object generation to integer: "+t)
 			}
 
 			// Get object status (free or new)
 			objStatus, err := this.readToken(r)
 			if err != nil {
-				return errors.Wrap(err, "Failed to read token")
+				return parseError(this.f, r, err, "Failed to read token")
 			}
 			if objStatus != "f" && objStatus != "n" {
-				return errors.New("Expected objStatus to be 'n' or 'f', got: " + objStatus)
+				return parseError(this.f, r, nil, "Expected objStatus to be 'n' or 'f', got: "+objStatus)
+			}
+
+			// Entries of newer sections take precedence
+			if this.hasNewerXrefEntry(i, section) {
+				continue
+			}
+
+			// An object that is defined more than once in the same table (in overlapping subsections)
+			// uses its last definition, like an object that is redefined by an incremental update
+			if _, ok := section[i]; ok {
+				this.warnings = append(this.warnings, fmt.Sprintf("Object %d is defined more than once in the xref table at offset %d; the last definition is used", i, this.xrefPos))
 			}
 
 			// Append map[int]int
@@ -1143,26 +1598,42 @@ func (this *PdfReader) readXref() error {
 
 			// Set object id, generation, and position
 			this.xref[i][objGen] = objPos
+			section[i] = objStatus == "n"
+
+			if err = this.checkObjectCount(); err != nil {
+				return err
+			}
 		}
 	}
 
 	// Read trailer dictionary
 	t, err = this.readToken(r)
 	if err != nil {
-		return errors.Wrap(err, "Failed to read token")
+		return parseError(this.f, r, err, "Failed to read token")
 	}
 
 	trailer, err := this.readValue(r, t)
 	if err != nil {
-		return errors.Wrap(err, "Failed to read value for token: "+t)
+		return parseError(this.f, r, err, "Failed to read value for token: "+t)
 	}
 
-	// If /Root is set, then set trailer object so that /Root can be read later
-	if _, ok := trailer.Dictionary["/Root"]; ok {
+	// If /Root is set, then set trailer object so that /Root can be read later.  The trailers of
+	// older sections (/Prev) are read later, and must not replace the newest one.
+	if _, ok := trailer.Dictionary["/Root"]; ok && this.trailer == nil {
 		this.trailer = trailer
 	}
 
-	// If a /Prev xref trailer is specified, parse that
+	// In hybrid files, compressed objects are in an xref stream that only readers of PDF 1.5 and
+	// later know about
+	if stm, ok := trailer.Dictionary["/XRefStm"]; ok && stm.Type == PDF_TYPE_NUMERIC {
+		this.xrefSection = section
+		this.xrefPos = stm.Int
+		if err = this.readXref(); err != nil {
+			return errors.Wrap(err, "Failed to read /XRefStm xref stream")
+		}
+	}
+
+	// If a /Prev xref trailer is specified, parse that.  It may be an xref table or an xref stream.
 	if tr, ok := trailer.Dictionary["/Prev"]; ok {
 		// Resolve parent xref table
 		this.xrefPos = tr.Int
@@ -1172,11 +1643,32 @@ func (this *PdfReader) readXref() error {
 	return nil
 }
 
+// Check if an object has an entry in a newer xref section than the one being read.  Sections are
+// read from the newest to the oldest by following /Prev, so a newer entry is one that is not in
+// section, the ids of the section being read.
+func (this *PdfReader) hasNewerXrefEntry(id int, section map[int]bool) bool {
+	if _, ok := section[id]; ok {
+		return false
+	}
+
+	_, inXref := this.xref[id]
+	_, inStream := this.xrefStream[id]
+
+	return inXref || inStream
+}
+
 // Read root (catalog object)
 func (this *PdfReader) readRoot() error {
 	var err error
 
-	rootObjSpec := this.trailer.Dictionary["/Root"]
+	if this.trailer == nil {
+		return errors.New("Trailer with /Root not found")
+	}
+
+	rootObjSpec, ok := this.trailer.Dictionary["/Root"]
+	if !ok || rootObjSpec.Type != PDF_TYPE_OBJREF {
+		return errors.New("Trailer has no /Root reference")
+	}
 
 	// Read root (catalog)
 	this.catalog, err = this.resolveObject(rootObjSpec)
@@ -1189,21 +1681,38 @@ func (this *PdfReader) readRoot() error {
 
 // Read kids (pages inside a page tree)
 func (this *PdfReader) readKids(kids *PdfValue, r int) error {
+	// Guard against /Kids references that form a loop
+	if r > 64 {
+		return errors.New("Page tree is too deep")
+	}
+
 	// Loop through pages and add to result
 	for i := 0; i < len(kids.Array); i++ {
 		page, err := this.resolveObject(kids.Array[i])
 		if err != nil {
-			return errors.Wrap(err, "Failed to resolve page/pages object")
+			// Damaged files may reference freed or missing objects.  Skip them, so that the
+			// other pages can still be used.
+			this.warnings = append(this.warnings, fmt.Sprintf("Skipped page tree kid that cannot be resolved: %s", err.Error()))
+			continue
+		}
+
+		if page.Value == nil || page.Value.Type != PDF_TYPE_DICTIONARY {
+			this.warnings = append(this.warnings, "Skipped page tree kid that is not a dictionary")
+			continue
 		}
 
-		objType := page.Value.Dictionary["/Type"].Token
+		objType := pageTreeNodeType(page.Value)
 		if objType == "/Page" {
+			if this.curPage >= len(this.pages) {
+				return errors.New(fmt.Sprintf("Page tree contains more pages than /Count (%d)", len(this.pages)))
+			}
+
 			// Set page and increment curPage
 			this.pages[this.curPage] = page
 			this.curPage++
 		} else if objType == "/Pages" {
 			// Resolve kids
-			subKids, err := this.resolveObject(page.Value.Dictionary["/Kids"])
+			subKids, err := this.resolveValue(page.Value.Dictionary["/Kids"])
 			if err != nil {
 				return errors.Wrap(err, "Failed to resolve kids")
 			}
@@ -1214,38 +1723,81 @@ func (this *PdfReader) readKids(kids *PdfValue, r int) error {
 				return errors.Wrap(err, "Failed to read kids")
 			}
 		} else {
-			return errors.Wrap(err, fmt.Sprintf("Unknown object type '%s'.  Expected: /Pages or /Page", objType))
+			return errors.New(fmt.Sprintf("Unknown object type '%s'.  Expected: /Pages or /Page", objType))
 		}
 	}
 
 	return nil
 }
 
+// Get the /Type of a page tree node.  If it is missing, nodes with /Kids are taken to be /Pages.
+func pageTreeNodeType(node *PdfValue) string {
+	if t, ok := node.Dictionary["/Type"]; ok {
+		return t.Token
+	}
+
+	if _, ok := node.Dictionary["/Kids"]; ok {
+		return "/Pages"
+	}
+
+	return "/Page"
+}
+
 // Read all pages in PDF
 func (this *PdfReader) readPages() error {
 	var err error
 
+	if this.catalog.Value == nil || this.catalog.Value.Type != PDF_TYPE_DICTIONARY {
+		return errors.New("Root object is not a dictionary")
+	}
+
 	// resolve_pages_dict
 	pagesDict, err := this.resolveObject(this.catalog.Value.Dictionary["/Pages"])
 	if err != nil {
 		return errors.Wrap(err, "Failed to resolve pages object")
 	}
 
-	// This will normally return itself
-	kids, err := this.resolveObject(pagesDict.Value.Dictionary["/Kids"])
+	if pagesDict.Value == nil || pagesDict.Value.Type != PDF_TYPE_DICTIONARY {
+		return errors.New("Pages object is not a dictionary")
+	}
+
+	// Some minimal pdfs point /Pages directly to a single page instead of a page tree
+	if isSinglePage(pagesDict.Value) {
+		this.pageCount = 1
+		this.pages = []*PdfValue{pagesDict}
+		return nil
+	}
+
+	// /Kids may be a reference to an array, which may be in an object stream like the page tree nodes
+	kids, err := this.resolveValue(pagesDict.Value.Dictionary["/Kids"])
 	if err != nil {
 		return errors.Wrap(err, "Failed to resolve kids object")
 	}
 
 	// Get number of pages
-	pageCount, err := this.resolveObject(pagesDict.Value.Dictionary["/Count"])
+	pageCount, err := this.resolveValue(pagesDict.Value.Dictionary["/Count"])
 	if err != nil {
 		return errors.Wrap(err, "Failed to get page count")
 	}
+	if pageCount.Type != PDF_TYPE_NUMERIC || pageCount.Int < 0 {
+		return errors.New("Page count is not a non-negative integer")
+	}
 	this.pageCount = pageCount.Int
 
+	// Each page is an object, so a larger /Count is wrong and must not be allocated
+	if nObjects := len(this.xref) + len(this.xrefStream); this.pageCount > nObjects {
+		this.warnings = append(this.warnings, fmt.Sprintf("Page count %d is larger than the number of objects %d", this.pageCount, nObjects))
+		this.pageCount = nObjects
+	}
+
 	// Allocate pages
-	this.pages = make([]*PdfValue, pageCount.Int)
+	this.pages = make([]*PdfValue, this.pageCount)
+
+	// In lazy mode, pages are found in the page tree when they are used (see getPageRef)
+	if this.lazy {
+		this.pagesRoot = pagesDict
+		return nil
+	}
 
 	// Read kids
 	err = this.readKids(kids, 0)
@@ -1253,61 +1805,188 @@ func (this *PdfReader) readPages() error {
 		return errors.Wrap(err, "Failed to read kids")
 	}
 
+	// If kids were skipped, the document has fewer pages than /Count
+	if this.curPage < len(this.pages) {
+		this.warnings = append(this.warnings, fmt.Sprintf("Page tree has %d pages, but /Count is %d", this.curPage, len(this.pages)))
+		this.pages = this.pages[:this.curPage]
+		this.pageCount = this.curPage
+	}
+
 	return nil
 }
 
+// Determine if the object that the catalog /Pages points to is a page rather than a page tree node
+func isSinglePage(pages *PdfValue) bool {
+	if pages == nil || pages.Type != PDF_TYPE_DICTIONARY {
+		return false
+	}
+
+	if t, ok := pages.Dictionary["/Type"]; ok && t.Token == "/Page" {
+		return true
+	}
+
+	_, hasKids := pages.Dictionary["/Kids"]
+	_, hasContents := pages.Dictionary["/Contents"]
+	return !hasKids && hasContents
+}
+
+// Get the page object (or in lazy mode, the reference to it) for a page number
+func (this *PdfReader) getPageRef(pageno int) (*PdfValue, error) {
+	if pageno < 1 || pageno > len(this.pages) {
+		return nil, errors.New(fmt.Sprintf("Page %d does not exist", pageno))
+	}
+
+	if this.pages[pageno-1] == nil && this.pagesRoot != nil {
+		page, err := this.findPage(this.pagesRoot, pageno-1, 0)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Failed to find page %d in page tree", pageno))
+		}
+		this.pages[pageno-1] = page
+	}
+
+	if this.pages[pageno-1] == nil {
+		return nil, errors.New(fmt.Sprintf("Page %d is missing from page tree", pageno))
+	}
+
+	return this.pages[pageno-1], nil
+}
+
+// Find the reference to the page with the 0-based index among the pages below a page tree node.
+// The /Count of /Pages nodes is used to skip subtrees that do not contain the page, so only the
+// nodes on the way to the page and their kids are resolved.
+func (this *PdfReader) findPage(node *PdfValue, index int, depth int) (*PdfValue, error) {
+	// Guard against circular references in malformed documents
+	if depth > 64 {
+		return nil, errors.New("Page tree is too deep")
+	}
+
+	kids, err := this.getPageTreeKids(node)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kid := range kids {
+		if index < kid.Count {
+			if kid.Node {
+				return this.findPage(kid.Ref, index, depth+1)
+			}
+			return kid.Ref, nil
+		}
+		index -= kid.Count
+	}
+
+	return nil, errors.New("Page tree contains fewer pages than /Count")
+}
+
+// Get the kids of a page tree node and their page counts.  The kids are cached by node, so that
+// finding each page of a document resolves every node and its kids only once.  Only the references
+// and counts are kept, not the resolved pages.
+func (this *PdfReader) getPageTreeKids(node *PdfValue) ([]pageTreeKid, error) {
+	if kids, ok := this.pageTreeKids[node]; ok {
+		return kids, nil
+	}
+
+	nodeValue, err := this.resolveValue(node)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve page tree node")
+	}
+
+	kidsValue, err := this.resolveValue(nodeValue.Dictionary["/Kids"])
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve kids")
+	}
+
+	kids := make([]pageTreeKid, 0, len(kidsValue.Array))
+	for _, kid := range kidsValue.Array {
+		kidValue, err := this.resolveValue(kid)
+		if err != nil || kidValue.Type != PDF_TYPE_DICTIONARY {
+			// Skip freed or missing kids, as readKids does
+			kids = append(kids, pageTreeKid{Ref: kid})
+			continue
+		}
+
+		if pageTreeNodeType(kidValue) == "/Pages" {
+			count, err := this.resolveValue(kidValue.Dictionary["/Count"])
+			if err != nil {
+				return nil, errors.Wrap(err, "Failed to get page count")
+			}
+			if count.Int < 0 {
+				count = &PdfValue{Type: PDF_TYPE_NUMERIC}
+			}
+			kids = append(kids, pageTreeKid{Ref: kid, Node: true, Count: count.Int})
+		} else {
+			kids = append(kids, pageTreeKid{Ref: kid, Count: 1})
+		}
+	}
+
+	this.pageTreeKids[node] = kids
+
+	return kids, nil
+}
+
 // Get references to page resources for a given page number
 func (this *PdfReader) getPageResources(pageno int) (*PdfValue, error) {
 	var err error
 
-	// Check to make sure page exists in pages slice
-	if len(this.pages) < pageno {
-		return nil, errors.New(fmt.Sprintf("Page %d does not exist!!", pageno))
+	// Get the page, finding it in the page tree in lazy mode
+	pageRef, err := this.getPageRef(pageno)
+	if err != nil {
+		return nil, err
 	}
 
 	// Resolve page object
-	page, err := this.resolveObject(this.pages[pageno-1])
+	page, err := this.resolveObject(pageRef)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to resolve page object")
 	}
 
-	// Check to see if /Resources exists in Dictionary
-	if _, ok := page.Value.Dictionary["/Resources"]; ok {
-		// Resolve /Resources object
-		res, err := this.resolveObject(page.Value.Dictionary["/Resources"])
-		if err != nil {
-			return nil, errors.Wrap(err, "Failed to resolve resources object")
+	// If /Resources does not exist on the page, it is inherited from /Parent.  Walk up the page
+	// tree until it is found, with a limit in case the /Parent references form a loop.
+	for depth := 0; ; depth++ {
+		if _, ok := page.Value.Dictionary["/Resources"]; ok {
+			break
 		}
 
-		// If type is PDF_TYPE_OBJECT, return its Value
-		if res.Type == PDF_TYPE_OBJECT {
-			return res.Value, nil
+		parent, ok := page.Value.Dictionary["/Parent"]
+		if !ok || depth >= 64 {
+			// A page without resources (e.g. a blank page) gets an empty resource dictionary
+			return &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, 0)}, nil
 		}
 
-		// Otherwise, returned the resolved object
-		return res, nil
-	} else {
-		// If /Resources does not exist, check to see if /Parent exists and return that
-		if _, ok := page.Value.Dictionary["/Parent"]; ok {
-			// Resolve parent object
-			res, err := this.resolveObject(page.Value.Dictionary["/Parent"])
-			if err != nil {
-				return nil, errors.Wrap(err, "Failed to resolve parent object")
-			}
-
-			// If /Parent object type is PDF_TYPE_OBJECT, return its Value
-			if res.Type == PDF_TYPE_OBJECT {
-				return res.Value, nil
-			}
+		page, err = this.resolveObject(parent)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to resolve parent object")
+		}
+		if page.Value == nil || page.Value.Type != PDF_TYPE_DICTIONARY {
+			return &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, 0)}, nil
+		}
+	}
 
-			// Otherwise, return the resolved parent object
+	// Pages often share one indirect /Resources object, which is resolved once.  In lazy mode, it is
+	// resolved for each page, so that memory usage does not grow with the number of pages.
+	ref := page.Value.Dictionary["/Resources"]
+	if ref.Type == PDF_TYPE_OBJREF && !this.lazy {
+		if res, ok := this.resources[ref.Id]; ok {
 			return res, nil
 		}
 	}
 
-	// Return an empty PdfValue if we got here
-	// TODO:  Improve error handling
-	return &PdfValue{}, nil
+	// Resolve /Resources object
+	res, err := this.resolveValue(ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve resources object")
+	}
+
+	// A null resources entry is the same as an empty resource dictionary
+	if res.Type == PDF_TYPE_NULL {
+		return &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, 0)}, nil
+	}
+
+	if ref.Type == PDF_TYPE_OBJREF && !this.lazy && this.resources != nil {
+		this.resources[ref.Id] = res
+	}
+
+	return res, nil
 }
 
 // Get page content and return a slice of PdfValue objects
@@ -1324,10 +2003,40 @@ func (this *PdfReader) getPageContent(objSpec *PdfValue) ([]*PdfValue, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to resolve object")
 		}
-		contents = append(contents, content)
+
+		if err = this.checkCompressedContent(objSpec, content); err != nil {
+			return nil, err
+		}
+
+		if content.Type == PDF_TYPE_STREAM {
+			contents = append(contents, content)
+		} else if content.Value != nil && content.Value.Type == PDF_TYPE_ARRAY {
+			// An indirect array of content streams.  Only streams are taken from it, so that an
+			// array which references itself cannot cause endless recursion.
+			for i := 0; i < len(content.Value.Array); i++ {
+				if this.isNullContent(content.Value.Array[i]) {
+					continue
+				}
+				tmpContent, err := this.resolveObject(content.Value.Array[i])
+				if err != nil {
+					return nil, errors.Wrap(err, "Failed to resolve object")
+				}
+				if err = this.checkCompressedContent(content.Value.Array[i], tmpContent); err != nil {
+					return nil, err
+				}
+				if tmpContent.Type == PDF_TYPE_STREAM {
+					contents = append(contents, tmpContent)
+				}
+			}
+		}
+
+		// Anything else (e.g. null) is a blank page
 	} else if objSpec.Type == PDF_TYPE_ARRAY {
 		// If objSpec is an array, loop through the array and recursively get page content and append to contents
 		for i := 0; i < len(objSpec.Array); i++ {
+			if this.isNullContent(objSpec.Array[i]) {
+				continue
+			}
 			tmpContents, err := this.getPageContent(objSpec.Array[i])
 			if err != nil {
 				return nil, errors.Wrap(err, "Failed to get page content")
@@ -1341,18 +2050,57 @@ func (this *PdfReader) getPageContent(objSpec *PdfValue) ([]*PdfValue, error) {
 	return contents, nil
 }
 
+// Check if an element of a /Contents array is null, e.g. a stray null that some producers write
+// between content streams, or a reference to an object that is not defined, which is also null
+func (this *PdfReader) isNullContent(value *PdfValue) bool {
+	if value == nil || value.Type == PDF_TYPE_NULL {
+		return true
+	}
+	if value.Type != PDF_TYPE_OBJREF {
+		return false
+	}
+
+	_, inXref := this.xref[value.Id]
+	_, inXrefStream := this.xrefStream[value.Id]
+	if inXref || inXrefStream {
+		return false
+	}
+
+	this.warnings = append(this.warnings, fmt.Sprintf("Content stream %d is not defined and is left out", value.Id))
+	return true
+}
+
+// Return an error if a content stream is in an object stream.  Object streams cannot contain streams,
+// so the object is a stream dictionary without its data, and the content of the page is lost.
+// Arrays of content streams may be in object streams.
+func (this *PdfReader) checkCompressedContent(objSpec *PdfValue, content *PdfValue) error {
+	if objSpec.Type != PDF_TYPE_OBJREF || content.Value == nil || content.Value.Type != PDF_TYPE_DICTIONARY {
+		return nil
+	}
+
+	if _, ok := this.xrefStream[objSpec.Id]; ok {
+		return errors.New(fmt.Sprintf("Content stream %d is in an object stream, which cannot contain streams", objSpec.Id))
+	}
+
+	return nil
+}
+
 // Get content (i.e. PDF drawing instructions)
 func (this *PdfReader) getContent(pageno int) (string, error) {
 	var err error
 	var contents []*PdfValue
 
-	// Check to make sure page exists in pages slice
-	if len(this.pages) < pageno {
-		return "", errors.New(fmt.Sprintf("Page %d does not exist.", pageno))
+	// Get the page, finding it in the page tree in lazy mode
+	pageRef, err := this.getPageRef(pageno)
+	if err != nil {
+		return "", err
 	}
 
-	// Get page
-	page := this.pages[pageno-1]
+	// Resolve page object
+	page, err := this.resolveObject(pageRef)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to resolve page object")
+	}
 
 	// FIXME: This could be slow, converting []byte to string and appending many times
 	buffer := ""
@@ -1373,6 +2121,12 @@ func (this *PdfReader) getContent(pageno int) (string, error) {
 				return "", errors.Wrap(err, "Failed to rebuild content stream")
 			}
 
+			// Separate content streams with a newline, so that the last token of one stream
+			// and the first token of the next one are not merged
+			if i > 0 {
+				buffer += "\n"
+			}
+
 			// FIXME:  This is probably slow
 			buffer += string(tmpBuffer)
 		}
@@ -1385,56 +2139,16 @@ func (this *PdfReader) getContent(pageno int) (string, error) {
 // This will decode content if one or more /Filter (such as FlateDecode) is specified.
 // If there are multiple filters, they will be decoded in the order in which they were specified.
 func (this *PdfReader) rebuildContentStream(content *PdfValue) ([]byte, error) {
-	var err error
-	var tmpFilter *PdfValue
-
-	// Allocate slice of PdfValue
-	filters := make([]*PdfValue, 0)
-
-	// If content has a /Filter, append it to filters slice
-	if _, ok := content.Value.Dictionary["/Filter"]; ok {
-		filter := content.Value.Dictionary["/Filter"]
-
-		// If filter type is a reference, resolve it
-		if filter.Type == PDF_TYPE_OBJREF {
-			tmpFilter, err = this.resolveObject(filter)
-			if err != nil {
-				return nil, errors.Wrap(err, "Failed to resolve object")
-			}
-			filter = tmpFilter.Value
-		}
-
-		if filter.Type == PDF_TYPE_TOKEN {
-			// If filter type is a token (e.g. FlateDecode), appent it to filters slice
-			filters = append(filters, filter)
-		} else if filter.Type == PDF_TYPE_ARRAY {
-			// If filter type is an array, then there are multiple filters.  Set filters variable to array value.
-			filters = filter.Array
-		}
-
+	if this.encryptErr != nil {
+		return nil, this.encryptErr
 	}
 
-	// Set stream variable to content bytes
-	stream := content.Stream.Bytes
-
-	// Loop through filters and apply each filter to stream
-	for i := 0; i < len(filters); i++ {
-		switch filters[i].Token {
-		case "/FlateDecode":
-			// Uncompress zlib compressed data
-			var out bytes.Buffer
-			zlibReader, _ := zlib.NewReader(bytes.NewBuffer(stream))
-			defer zlibReader.Close()
-			io.Copy(&out, zlibReader)
-
-			// Set stream to uncompressed data
-			stream = out.Bytes()
-		default:
-			return nil, errors.New("Unspported filter: " + filters[i].Token)
-		}
+	filters, parms, err := this.getStreamFilters(content.Value)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get stream filters")
 	}
 
-	return stream, nil
+	return this.decodeStream(content.Stream.Bytes, filters, parms)
 }
 
 func (this *PdfReader) getNumPages() (int, error) {
@@ -1456,11 +2170,42 @@ func (this *PdfReader) getAllPageBoxes(k float64) (map[int]map[string]map[string
 		if result[i] == nil {
 			return nil, errors.Wrap(err, "Unable to get page box")
 		}
+
+		// Replace boxes that are not defined with the box they default to
+		for boxName, box := range result[i] {
+			if len(box) == 0 {
+				var fallback string
+				fallback, result[i][boxName] = resolveBoxWithFallback(result[i], boxName)
+				if this.trace != nil {
+					this.trace("fallback", fmt.Sprintf("page %d %s uses %s", i, boxName, fallback))
+				}
+			}
+		}
 	}
 
 	return result, nil
 }
 
+// Get the box to use for boxName.  If it is not defined, fall back to the box it defaults to in the
+// pdf spec: /BleedBox, /TrimBox and /ArtBox default to /CropBox, which defaults to /MediaBox.
+// Returns the name of the box that was found, or an empty name if no box was found.
+func resolveBoxWithFallback(pageBoxes map[string]map[string]float64, boxName string) (string, map[string]float64) {
+	for {
+		if len(pageBoxes[boxName]) > 0 {
+			return boxName, pageBoxes[boxName]
+		}
+
+		switch boxName {
+		case "/BleedBox", "/TrimBox", "/ArtBox":
+			boxName = "/CropBox"
+		case "/CropBox":
+			boxName = "/MediaBox"
+		default:
+			return "", nil
+		}
+	}
+}
+
 // Get all page box data
 func (this *PdfReader) getPageBoxes(pageno int, k float64) (map[string]map[string]float64, error) {
 	var err error
@@ -1468,13 +2213,14 @@ func (this *PdfReader) getPageBoxes(pageno int, k float64) (map[string]map[strin
 	// Allocate result with the number of available boxes
 	result := make(map[string]map[string]float64, len(this.availableBoxes))
 
-	// Check to make sure page exists in pages slice
-	if len(this.pages) < pageno {
-		return nil, errors.New(fmt.Sprintf("Page %d does not exist?", pageno))
+	// Get the page, finding it in the page tree in lazy mode
+	pageRef, err := this.getPageRef(pageno)
+	if err != nil {
+		return nil, err
 	}
 
 	// Resolve page object
-	page, err := this.resolveObject(this.pages[pageno-1])
+	page, err := this.resolveObject(pageRef)
 	if err != nil {
 		return nil, errors.New("Failed to resolve page object")
 	}
@@ -1483,7 +2229,7 @@ func (this *PdfReader) getPageBoxes(pageno int, k float64) (map[string]map[strin
 	for i := 0; i < len(this.availableBoxes); i++ {
 		box, err := this.getPageBox(page, this.availableBoxes[i], k)
 		if err != nil {
-			return nil, errors.New("Failed to get page box")
+			return nil, errors.Wrap(err, "Failed to get page box")
 		}
 
 		result[this.availableBoxes[i]] = box
@@ -1495,105 +2241,302 @@ func (this *PdfReader) getPageBoxes(pageno int, k float64) (map[string]map[strin
 // Get a specific page box value (e.g. MediaBox) and return its values
 func (this *PdfReader) getPageBox(page *PdfValue, box_index string, k float64) (map[string]float64, error) {
 	var err error
-	var tmpBox *PdfValue
 
 	// Allocate 8 fields in result
 	result := make(map[string]float64, 8)
 
-	// Check to make sure box_index (e.g. MediaBox) exists in page dictionary
-	if _, ok := page.Value.Dictionary[box_index]; ok {
-		box := page.Value.Dictionary[box_index]
-
-		// If the box type is a reference, resolve it
-		if box.Type == PDF_TYPE_OBJREF {
-			tmpBox, err = this.resolveObject(box)
-			if err != nil {
-				return nil, errors.New("Failed to resolve object")
-			}
-			box = tmpBox.Value
+	// If /MediaBox or /CropBox is not on the page, it is inherited from /Parent.  Each box is
+	// inherited separately, so that e.g. a page with a /MediaBox inherits the /CropBox of its
+	// parent.  The other boxes are not inheritable, and default to the /CropBox instead.
+	var value *PdfValue
+	if box_index == "/MediaBox" || box_index == "/CropBox" {
+		value, err = this.getInheritedValue(page, box_index)
+		if err != nil {
+			return nil, err
 		}
+	} else if page.Value != nil && page.Value.Type == PDF_TYPE_DICTIONARY {
+		value = page.Value.Dictionary[box_index]
+	}
+	if value == nil {
+		return result, nil
+	}
 
-		if box.Type == PDF_TYPE_ARRAY {
-			// If the box type is an array, calculate scaled value based on k
-			result["x"] = box.Array[0].Real / k
-			result["y"] = box.Array[1].Real / k
-			result["w"] = math.Abs(box.Array[0].Real-box.Array[2].Real) / k
-			result["h"] = math.Abs(box.Array[1].Real-box.Array[3].Real) / k
-			result["llx"] = math.Min(box.Array[0].Real, box.Array[2].Real)
-			result["lly"] = math.Min(box.Array[1].Real, box.Array[3].Real)
-			result["urx"] = math.Max(box.Array[0].Real, box.Array[2].Real)
-			result["ury"] = math.Max(box.Array[1].Real, box.Array[3].Real)
-		} else {
-			// TODO: Improve error handling
-			return nil, errors.New("Could not get page box")
-		}
-	} else if _, ok := page.Value.Dictionary["/Parent"]; ok {
-		parentObj, err := this.resolveObject(page.Value.Dictionary["/Parent"])
+	// If the box type is a reference (also when inherited from /Parent), resolve it
+	box, err := this.resolveValue(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve page box")
+	}
+
+	if box.Type != PDF_TYPE_ARRAY {
+		// TODO: Improve error handling
+		return nil, errors.New("Could not get page box")
+	}
+
+	// A box is a rectangle, so it must have 4 values
+	if len(box.Array) < 4 {
+		return nil, errors.New(fmt.Sprintf("Page box %s has %d values, expected 4", box_index, len(box.Array)))
+	}
+
+	// Boxes may mix integers and reals (e.g. [0 0 595.276 842]), and values may be references
+	var c [4]float64
+	for i := 0; i < 4; i++ {
+		v, err := this.resolveValue(box.Array[i])
 		if err != nil {
-			return nil, errors.Wrap(err, "Could not resolve parent object")
+			return nil, errors.Wrap(err, "Failed to resolve page box value")
 		}
 
-		// If the page box is inherited from /Parent, recursively return page box of parent
-		return this.getPageBox(parentObj, box_index, k)
+		switch v.Type {
+		case PDF_TYPE_NUMERIC:
+			c[i] = float64(v.Int)
+		case PDF_TYPE_REAL:
+			c[i] = v.Real
+		default:
+			return nil, errors.New(fmt.Sprintf("Page box %s has a value that is not a number", box_index))
+		}
 	}
 
+	// Calculate scaled value based on k.  Any two opposite corners may be given (e.g. [612 792 0 0]),
+	// so the position is that of the lower left corner.
+	result["x"] = math.Min(c[0], c[2]) / k
+	result["y"] = math.Min(c[1], c[3]) / k
+	result["w"] = math.Abs(c[0]-c[2]) / k
+	result["h"] = math.Abs(c[1]-c[3]) / k
+	result["llx"] = math.Min(c[0], c[2])
+	result["lly"] = math.Min(c[1], c[3])
+	result["urx"] = math.Max(c[0], c[2])
+	result["ury"] = math.Max(c[1], c[3])
+
 	return result, nil
 }
 
+// Get the rotation of a page in degrees, normalized to 0, 90, 180 or 270
+func (this *PdfReader) getNormalizedPageRotation(pageno int) (int, error) {
+	rotation, err := this.getPageRotation(pageno)
+	if err != nil {
+		return 0, err
+	}
+
+	// Some producers write the rotation as a real number, e.g. /Rotate 90.0
+	angle := float64(rotation.Int)
+	if rotation.Type == PDF_TYPE_REAL {
+		angle = rotation.Real
+	}
+
+	// /Rotate must be a multiple of 90.  Other values are rounded to the nearest multiple of 90,
+	// because the page can only be placed upright or turned by a quarter.
+	rounded := int(math.Round(angle/90)) * 90
+	if float64(rounded) != angle {
+		warning := fmt.Sprintf("Page %d has /Rotate %s, which is not a multiple of 90; %d is used", pageno, strconv.FormatFloat(angle, 'f', -1, 64), normalizeRotation(rounded))
+		if !in_array(warning, this.warnings) {
+			this.warnings = append(this.warnings, warning)
+		}
+	}
+
+	return normalizeRotation(rounded), nil
+}
+
+// Normalize a rotation to the range [0, 360), e.g. -90 becomes 270 and 450 becomes 90
+func normalizeRotation(angle int) int {
+	angle %= 360
+	if angle < 0 {
+		angle += 360
+	}
+
+	return angle
+}
+
 // Get page rotation for a page number
 func (this *PdfReader) getPageRotation(pageno int) (*PdfValue, error) {
-	// Check to make sure page exists in pages slice
-	if len(this.pages) < pageno {
-		return nil, errors.New(fmt.Sprintf("Page %d does not exist!!!!", pageno))
+	// Get the page, finding it in the page tree in lazy mode
+	pageRef, err := this.getPageRef(pageno)
+	if err != nil {
+		return nil, err
 	}
 
-	return this._getPageRotation(this.pages[pageno-1])
+	// Resolve page object
+	page, err := this.resolveObject(pageRef)
+	if err != nil {
+		return nil, errors.New("Failed to resolve page object")
+	}
+
+	// /Rotate is inherited like the page boxes, so that a rotation and a box inherited from
+	// different levels of the page tree are combined
+	rotation, err := this.getInheritedValue(page, "/Rotate")
+	if err != nil || rotation == nil {
+		return &PdfValue{Int: 0}, err
+	}
+
+	res, err := this.resolveValue(rotation)
+	if err != nil {
+		return nil, errors.New("Failed to resolve rotate object")
+	}
+
+	return res, nil
 }
 
-// Get page rotation for a page object spec
-func (this *PdfReader) _getPageRotation(page *PdfValue) (*PdfValue, error) {
+// Get the value of an inheritable page attribute (e.g. /MediaBox, /Rotate) of a resolved page
+// object.  If it is not on the page, it is inherited from /Parent.  Returns nil if neither the page
+// nor its ancestors have the attribute.
+func (this *PdfReader) getInheritedValue(page *PdfValue, key string) (*PdfValue, error) {
 	var err error
 
+	// Walk up the page tree until the attribute is found, with a limit in case the /Parent
+	// references form a loop
+	for depth := 0; ; depth++ {
+		if page.Value == nil || page.Value.Type != PDF_TYPE_DICTIONARY {
+			return nil, nil
+		}
+
+		if value, ok := page.Value.Dictionary[key]; ok {
+			return value, nil
+		}
+
+		parent, ok := page.Value.Dictionary["/Parent"]
+		if !ok {
+			return nil, nil
+		}
+
+		if depth >= 64 {
+			return nil, errors.New("Page tree is too deep to inherit " + key)
+		}
+
+		page, err = this.resolveObject(parent)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not resolve parent object")
+		}
+	}
+}
+
+// Get the annotations of a page (usually references to annotation dictionaries)
+func (this *PdfReader) getPageAnnots(pageno int) ([]*PdfValue, error) {
+	// Get the page, finding it in the page tree in lazy mode
+	pageRef, err := this.getPageRef(pageno)
+	if err != nil {
+		return nil, err
+	}
+
 	// Resolve page object
-	page, err = this.resolveObject(page)
+	page, err := this.resolveValue(pageRef)
 	if err != nil {
-		return nil, errors.New("Failed to resolve page object")
+		return nil, errors.Wrap(err, "Failed to resolve page object")
+	}
+
+	annots, ok := page.Dictionary["/Annots"]
+	if !ok {
+		return nil, nil
 	}
 
-	// Check to make sure /Rotate exists in page dictionary
-	if _, ok := page.Value.Dictionary["/Rotate"]; ok {
-		res, err := this.resolveObject(page.Value.Dictionary["/Rotate"])
+	annots, err = this.resolveValue(annots)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve annotations object")
+	}
+
+	return annots.Array, nil
+}
+
+// Get warnings about features of a page that cannot be fully reproduced when it is imported.
+// If withAnnots is true, annotations are imported and no warning is given for them.  Objects that
+// fail to resolve are skipped, so that collecting warnings never fails an import.
+func (this *PdfReader) getPageWarnings(pageno int, withAnnots bool) []string {
+	warnings := make([]string, 0)
+
+	if this.encryptErr != nil {
+		warnings = append(warnings, "Document is encrypted; imported content is not readable")
+	}
+
+	// JavaScript can be in the document name tree or in the open action
+	if this.catalog != nil && this.catalog.Value != nil {
+		if names, ok := this.catalog.Value.Dictionary["/Names"]; ok {
+			if names, err := this.resolveValue(names); err == nil {
+				if _, ok := names.Dictionary["/JavaScript"]; ok {
+					warnings = append(warnings, "Document contains JavaScript which is not imported")
+				}
+			}
+		}
+
+		if action, ok := this.catalog.Value.Dictionary["/OpenAction"]; ok {
+			if action, err := this.resolveValue(action); err == nil {
+				if s, ok := action.Dictionary["/S"]; ok && s.Token == "/JavaScript" {
+					warnings = append(warnings, "Document open action is JavaScript which is not imported")
+				}
+			}
+		}
+	}
+
+	// Get the page, finding it in the page tree in lazy mode
+	pageRef, err := this.getPageRef(pageno)
+	if err != nil {
+		return warnings
+	}
+	page, err := this.resolveValue(pageRef)
+	if err != nil {
+		return warnings
+	}
+
+	if _, ok := page.Dictionary["/AA"]; ok {
+		warnings = append(warnings, "Page has additional actions (/AA) which are not imported")
+	}
+
+	if annots, ok := page.Dictionary["/Annots"]; ok && !withAnnots {
+		if annots, err := this.resolveValue(annots); err == nil && len(annots.Array) > 0 {
+			warnings = append(warnings, fmt.Sprintf("Page has %d annotations which are not imported", len(annots.Array)))
+		}
+	}
+
+	resources, err := this.getPageResources(pageno)
+	if err != nil {
+		return warnings
+	}
+
+	// Look for resource streams which use non-standard filters.  These are passed through
+	// undecoded, so a viewer may not be able to display them.  Only the stream dictionaries are
+	// read, not the stream data.
+	for _, category := range []string{"/XObject", "/Pattern", "/Shading"} {
+		entries, ok := resources.Dictionary[category]
+		if !ok {
+			continue
+		}
+
+		entries, err = this.resolveValue(entries)
 		if err != nil {
-			return nil, errors.New("Failed to resolve rotate object")
+			continue
 		}
 
-		// If the type is PDF_TYPE_OBJECT, return its value
-		if res.Type == PDF_TYPE_OBJECT {
-			return res.Value, nil
+		// Give the warnings in the same order every time
+		names := make([]string, 0, len(entries.Dictionary))
+		for name := range entries.Dictionary {
+			names = append(names, name)
 		}
+		sort.Strings(names)
 
-		// Otherwise, return the object
-		return res, nil
-	} else {
-		// Check to see if parent has a rotation
-		if _, ok := page.Value.Dictionary["/Parent"]; ok {
-			// Recursively return /Parent page rotation
-			res, err := this._getPageRotation(page.Value.Dictionary["/Parent"])
-			if err != nil {
-				return nil, errors.Wrap(err, "Failed to get page rotation for parent")
+		for _, name := range names {
+			dict, err := this.resolveDictionary(entries.Dictionary[name])
+			if err != nil || dict.Type != PDF_TYPE_DICTIONARY {
+				continue
 			}
 
-			// If the type is PDF_TYPE_OBJECT, return its value
-			if res.Type == PDF_TYPE_OBJECT {
-				return res.Value, nil
+			filter, ok := dict.Dictionary["/Filter"]
+			if !ok {
+				continue
+			}
+			if filter, err = this.resolveValue(filter); err != nil {
+				continue
 			}
 
-			// Otherwise, return the object
-			return res, nil
+			filters := []*PdfValue{filter}
+			if filter.Type == PDF_TYPE_ARRAY {
+				filters = filter.Array
+			}
+
+			for _, f := range filters {
+				if f.Type == PDF_TYPE_TOKEN && !in_array(f.Token, standardFilters) {
+					warnings = append(warnings, fmt.Sprintf("Resource %s %s uses non-standard filter %s which is passed through undecoded", category, name, f.Token))
+				}
+			}
 		}
 	}
 
-	return &PdfValue{Int: 0}, nil
+	return warnings
 }
 
 func (this *PdfReader) read() error {
@@ -1613,6 +2556,10 @@ func (this *PdfReader) read() error {
 			return errors.Wrap(err, "Failed to read xref table")
 		}
 
+		// Remember if the document is encrypted in a way that is not supported.  The structure can
+		// still be read, but decoding streams fails with this error.
+		this.encryptErr = this.checkEncryption()
+
 		// Read catalog
 		err = this.readRoot()
 		if err != nil {
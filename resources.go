@@ -0,0 +1,149 @@
+package gofpdi
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Merge the resource dictionaries of several pages of the document into one, e.g. to inline the
+// content of several templates in one page.  Resources with the same name and the same object are
+// shared.  A name that is already used for another object is renamed by appending _1, _2, etc.
+// Returns the merged resources and, for each resource dictionary, its renamed resources by category,
+// e.g. "/Font": {"/F1": "/F1_1"}.  Categories and names are merged in sorted order, so the result
+// does not depend on map order.
+func (this *PdfReader) mergeResources(resources []*PdfValue) (*PdfValue, []map[string]map[string]string, error) {
+	merged := &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, 0)}
+	renamed := make([]map[string]map[string]string, len(resources))
+
+	for i, res := range resources {
+		renamed[i] = make(map[string]map[string]string, 0)
+
+		res, err := this.resolveValue(res)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Failed to resolve resources")
+		}
+
+		categories := make([]string, 0, len(res.Dictionary))
+		for category := range res.Dictionary {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+
+		for _, category := range categories {
+			entries, err := this.resolveValue(res.Dictionary[category])
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "Failed to resolve resource category "+category)
+			}
+
+			// /ProcSet is an array of names, which are combined
+			if entries.Type == PDF_TYPE_ARRAY {
+				if _, ok := merged.Dictionary[category]; !ok {
+					merged.Dictionary[category] = &PdfValue{Type: PDF_TYPE_ARRAY}
+				}
+				for _, entry := range entries.Array {
+					if !containsValue(merged.Dictionary[category].Array, entry) {
+						merged.Dictionary[category].Array = append(merged.Dictionary[category].Array, entry)
+					}
+				}
+				continue
+			}
+			if entries.Type != PDF_TYPE_DICTIONARY {
+				continue
+			}
+
+			if _, ok := merged.Dictionary[category]; !ok {
+				merged.Dictionary[category] = &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, 0)}
+			}
+			target := merged.Dictionary[category].Dictionary
+
+			names := make([]string, 0, len(entries.Dictionary))
+			for name := range entries.Dictionary {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				value := entries.Dictionary[name]
+
+				newName := name
+				for n := 1; ; n++ {
+					existing, ok := target[newName]
+					if !ok || equalValues(existing, value) {
+						break
+					}
+					newName = fmt.Sprintf("%s_%d", name, n)
+				}
+
+				target[newName] = value
+				if newName != name {
+					if renamed[i][category] == nil {
+						renamed[i][category] = make(map[string]string, 0)
+					}
+					renamed[i][category][name] = newName
+				}
+			}
+		}
+	}
+
+	return merged, renamed, nil
+}
+
+// Check if two values are the same: references to the same object, or equal direct values
+func equalValues(a *PdfValue, b *PdfValue) bool {
+	if a.Type != b.Type {
+		return false
+	}
+
+	switch a.Type {
+	case PDF_TYPE_OBJREF:
+		return a.Id == b.Id && a.Gen == b.Gen
+	case PDF_TYPE_NUMERIC:
+		return a.Int == b.Int
+	case PDF_TYPE_REAL:
+		return a.Real == b.Real
+	case PDF_TYPE_BOOLEAN:
+		return a.Bool == b.Bool
+	case PDF_TYPE_TOKEN:
+		return a.Token == b.Token
+	case PDF_TYPE_STRING, PDF_TYPE_HEX:
+		return a.String == b.String
+	case PDF_TYPE_NULL:
+		return true
+	case PDF_TYPE_ARRAY:
+		if len(a.Array) != len(b.Array) {
+			return false
+		}
+		for i := range a.Array {
+			if !equalValues(a.Array[i], b.Array[i]) {
+				return false
+			}
+		}
+		return true
+	case PDF_TYPE_DICTIONARY:
+		if len(a.Dictionary) != len(b.Dictionary) {
+			return false
+		}
+		for k, v := range a.Dictionary {
+			if w, ok := b.Dictionary[k]; !ok || !equalValues(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Streams are always indirect, so they are compared by reference
+	return a == b
+}
+
+// Check if an array contains a value
+func containsValue(array []*PdfValue, value *PdfValue) bool {
+	for _, v := range array {
+		if equalValues(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
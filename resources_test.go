@@ -0,0 +1,129 @@
+package gofpdi
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Merging the resources of two pages with a /F1 font each renames the second one
+func TestMergeTemplateResources(t *testing.T) {
+	refRegexp := regexp.MustCompile(`(/F[0-9_]+) (\d+) 0 R`)
+
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj /F2 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj /F2 12 Tf (two) Tj ET")
+	objs[10] = strings.Replace(objs[10], "/Font << /F1 3 0 R >>", "/Font << /F1 3 0 R /F2 5 0 R >> /ProcSet [/PDF /Text]", 1)
+	objs[12] = strings.Replace(objs[12], "/Font << /F1 3 0 R >>", "/Font << /F1 4 0 R /F2 5 0 R >> /ProcSet [/PDF /ImageB]", 1)
+	objs[4] = "<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>"
+	objs[5] = "<< /Type /Font /Subtype /Type1 /BaseFont /Times-Roman >>"
+	data := buildPdf(objs)
+
+	// The renames do not depend on map order
+	for i := 0; i < 5; i++ {
+		importer := newTestImporter(t, data)
+		tplids := []int{importer.ImportPage(1, "/MediaBox"), importer.ImportPage(2, "/MediaBox")}
+
+		resources, renamed, objects, err := importer.MergeTemplateResources(tplids, idCounter(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []map[string]map[string]string{{}, {"/Font": {"/F1": "/F1_1"}}}
+		if !reflect.DeepEqual(renamed, want) {
+			t.Fatalf("got renames %v, want %v", renamed, want)
+		}
+
+		// Each name references its own font, and the shared /F2 is merged
+		fonts := make(map[string]string)
+		for _, m := range refRegexp.FindAllSubmatch(resources, -1) {
+			id, _ := strconv.Atoi(string(m[2]))
+			fonts[string(m[1])] = string(objects[id])
+		}
+		for name, font := range map[string]string{"/F1": "/Helvetica", "/F1_1": "/Courier", "/F2": "/Times-Roman"} {
+			if !strings.Contains(fonts[name], "/BaseFont "+font) {
+				t.Errorf("got font %s %q, want %s", name, fonts[name], font)
+			}
+		}
+		if len(fonts) != 3 {
+			t.Errorf("got fonts %v in resources %q, want 3", fonts, resources)
+		}
+
+		// The procedure sets are combined
+		if !strings.Contains(string(resources), "/ProcSet [/PDF /Text /ImageB ]") {
+			t.Errorf("got resources %q, want combined /ProcSet", resources)
+		}
+	}
+
+	// Templates of different sources cannot be merged
+	importer := newTestImporter(t, data)
+	first := importer.ImportPage(1, "/MediaBox")
+	if err := importer.setSourceStream("other.pdf", strings.NewReader(string(data))); err != nil {
+		t.Fatal(err)
+	}
+	second := importer.ImportPage(1, "/MediaBox")
+	if _, _, _, err := importer.MergeTemplateResources([]int{first, second}, idCounter(100)); err == nil {
+		t.Error("expected an error merging templates of different sources")
+	}
+}
+
+// Pages that share one indirect /Resources object import it once, with its font
+func TestSharedResources(t *testing.T) {
+	fontRegexp := regexp.MustCompile(`/F1 (\d+) 0 R`)
+
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET", "BT /F1 12 Tf (three) Tj ET")
+	for _, id := range []int{10, 12, 14} {
+		objs[id] = strings.Replace(objs[id], "/Resources << /Font << /F1 3 0 R >> >>", "/Resources 4 0 R", 1)
+	}
+	objs[4] = "<< /Font << /F1 3 0 R >> >>"
+	data := buildPdf(objs)
+
+	for _, lazy := range []bool{false, true} {
+		// Count the reads of the resources
+		reads := 0
+		importer := NewImporter()
+		importer.SetLazyMode(lazy)
+		importer.SetTraceFunc(func(event string, args ...interface{}) {
+			if event == "object" && args[0].(int) == 4 {
+				reads++
+			}
+		})
+		if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		tplids, err := importer.ImportPages([]int{1, 2, 3}, "/MediaBox")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !lazy && reads != 1 {
+			t.Errorf("read the shared resources %d times, want once", reads)
+		}
+
+		templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every page uses the one imported font
+		fonts := make(map[string]bool)
+		for _, tplid := range tplids {
+			name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 0, 0)
+			m := fontRegexp.FindSubmatch(objects[templates[name]])
+			if m == nil {
+				t.Fatalf("lazy %v: template %d has no font /F1 in %q", lazy, tplid, objects[templates[name]])
+			}
+			fonts[string(m[1])] = true
+		}
+		if len(fonts) != 1 {
+			t.Errorf("lazy %v: got fonts %v, want one", lazy, fonts)
+		}
+		for id := range fonts {
+			n, _ := strconv.Atoi(id)
+			if !strings.Contains(string(objects[n]), "/BaseFont /Helvetica") {
+				t.Errorf("lazy %v: got font %q", lazy, objects[n])
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package gofpdi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPageRotation(t *testing.T) {
+	tests := []struct {
+		rotate  string
+		want    int
+		warning bool
+	}{
+		{"0", 0, false},
+		{"90", 90, false},
+		{"-90", 270, false},
+		{"-180", 180, false},
+		{"-270", 90, false},
+		{"360", 0, false},
+		{"450", 90, false},
+		{"-450", 270, false},
+		{"720", 0, false},
+		{"90.0", 90, false},
+		{"44", 0, true},
+		{"45", 90, true},
+		{"-45", 270, true},
+		{"179.5", 180, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rotate, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[10] = "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 600 800] /Rotate " + test.rotate + " /Contents 11 0 R >>"
+
+			reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildPdf(objs)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := reader.getNormalizedPageRotation(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got rotation %d, want %d", got, test.want)
+			}
+			if test.warning != (len(reader.warnings) > 0) {
+				t.Errorf("unexpected warnings %q", reader.warnings)
+			}
+
+			// The importer exposes the same rotation
+			if got, err := newTestImporter(t, buildPdf(objs)).GetPageRotation(1); err != nil || got != test.want {
+				t.Errorf("GetPageRotation: got rotation %d (%v), want %d", got, err, test.want)
+			}
+
+			// The template of a page turned by a quarter has width and height swapped
+			writer, _ := NewPdfWriter("")
+			tplid, err := writer.ImportPage(reader, 1, "/MediaBox")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tpl := writer.tpls[tplid]
+			wantW, wantH := 600.0, 800.0
+			if test.want%180 != 0 {
+				wantW, wantH = wantH, wantW
+			}
+			if tpl.W != wantW || tpl.H != wantH || tpl.Rotation != -test.want {
+				t.Errorf("got template %.0f x %.0f rotated %d, want %.0f x %.0f rotated %d", tpl.W, tpl.H, tpl.Rotation, wantW, wantH, -test.want)
+			}
+		})
+	}
+}
+
+func TestGetPageRotation(t *testing.T) {
+	objs := pagesPdf("BT ET", "BT ET", "BT ET")
+	objs[2] = "<< /Type /Pages /Kids [10 0 R 5 0 R] /Count 3 >>"
+	objs[5] = "<< /Type /Pages /Parent 2 0 R /Kids [12 0 R 14 0 R] /Count 2 /Rotate 90 >>"
+	objs[10] = strings.Replace(objs[10], "/MediaBox", "/Rotate 270 /MediaBox", 1)
+	objs[12] = strings.Replace(objs[12], "/Parent 2 0 R", "/Parent 5 0 R", 1)
+	objs[14] = strings.Replace(objs[14], "/Parent 2 0 R", "/Parent 5 0 R /Rotate 180", 1)
+	importer := newTestImporter(t, buildPdf(objs))
+
+	// Page 2 inherits the rotation of its parent, page 3 overrides it
+	for pageno, want := range map[int]int{1: 270, 2: 90, 3: 180} {
+		got, err := importer.GetPageRotation(pageno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("page %d: got rotation %d, want %d", pageno, got, want)
+		}
+	}
+
+	if _, err := importer.GetPageRotation(4); err == nil {
+		t.Error("page 4: expected an error")
+	}
+}
+
+// The rotation and the box of a page may be inherited from different ancestors
+func TestInheritedRotationAndBox(t *testing.T) {
+	objs := pagesPdf("BT ET", "BT ET", "BT ET")
+	objs[2] = "<< /Type /Pages /Kids [5 0 R 14 0 R] /Count 3 /Rotate 90 >>"
+	objs[5] = "<< /Type /Pages /Parent 2 0 R /Kids [10 0 R 12 0 R] /Count 2 /MediaBox [0 0 600 800] >>"
+	objs[10] = strings.Replace(objs[10], "/Parent 2 0 R /MediaBox [0 0 612 792]", "/Parent 5 0 R", 1)
+	objs[12] = strings.Replace(objs[12], "/Parent 2 0 R /MediaBox [0 0 612 792]", "/Parent 5 0 R /Rotate 180", 1)
+	objs[14] = strings.Replace(objs[14], "/MediaBox [0 0 612 792]", "/MediaBox [0 0 300 400]", 1)
+	data := buildPdf(objs)
+
+	// Page 1 inherits the box of its parent and the rotation of its grandparent, page 2 overrides the
+	// rotation and page 3 the box
+	tests := []struct {
+		pageno   int
+		rotation int
+		w, h     float64
+	}{
+		{1, 90, 800, 600},
+		{2, 180, 600, 800},
+		{3, 90, 400, 300},
+	}
+
+	for _, test := range tests {
+		importer := newTestImporter(t, data)
+		if got, err := importer.GetPageRotation(test.pageno); err != nil || got != test.rotation {
+			t.Errorf("page %d: got rotation %d (%v), want %d", test.pageno, got, err, test.rotation)
+		}
+
+		tplid := importer.ImportPage(test.pageno, "/MediaBox")
+		if w, h := templateSize(t, importer, tplid); w != test.w || h != test.h {
+			t.Errorf("page %d: got template %.0f x %.0f, want %.0f x %.0f", test.pageno, w, h, test.w, test.h)
+		}
+	}
+}
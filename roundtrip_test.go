@@ -0,0 +1,163 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Build a pdf with a page for each template, which shows the template, from the imported objects.
+// The templates are the template names and object ids, and sizes the width and height of the pages.
+func assemblePdf(t testing.TB, templates map[string]int, objects map[int][]byte, sizes map[string][2]float64) []byte {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	objs := map[int]string{1: "<< /Type /Catalog /Pages 2 0 R >>"}
+	kids := ""
+	for i, name := range names {
+		page := 10 + 2*i
+		kids += fmt.Sprintf("%d 0 R ", page)
+		objs[page] = fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << %s %d 0 R >> >> /Contents %d 0 R >>",
+			sizes[name][0], sizes[name][1], name, templates[name], page+1)
+		objs[page+1] = pdfStream("", name+" Do")
+	}
+	objs[2] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(names))
+
+	for id, object := range objects {
+		if _, ok := objs[id]; ok {
+			t.Fatalf("imported object %d clashes with the objects of the pdf", id)
+		}
+		objs[id] = strings.TrimSuffix(string(object), "endobj\n")
+	}
+
+	return buildPdf(objs)
+}
+
+// Import pages 1 to n and get the template names and the sizes of the templates
+func importPages(t testing.TB, importer *Importer, n int) map[string][2]float64 {
+	sizes := make(map[string][2]float64, 0)
+	for pageno := 1; pageno <= n; pageno++ {
+		tplid := importer.ImportPage(pageno, "/MediaBox")
+		name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 0, 0)
+		tplInfo, err := importer.getTplInfo(tplid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpl := tplInfo.Writer.tpls[tplInfo.TemplateId]
+		sizes[name] = [2]float64{tpl.W, tpl.H}
+	}
+	return sizes
+}
+
+// Check that the decoded data of one of the objects contains s
+func objectsContain(t testing.TB, objects map[int][]byte, s string) bool {
+	for _, object := range objects {
+		if bytes.Contains(object, []byte("/FlateDecode")) && bytes.Contains(object, []byte("stream\n")) {
+			object = inflate(t, object)
+		}
+		if bytes.Contains(object, []byte(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// A pdf assembled from imported objects can be imported again
+func TestRoundTrip(t *testing.T) {
+	objs := pagesPdf("BT /F1 12 Tf (page 1) Tj ET", "BT /F1 12 Tf (page 2) Tj ET")
+	objs[12] = strings.Replace(objs[12], "/MediaBox [0 0 612 792]", "/MediaBox [0 0 300 400]", 1)
+	data := buildPdf(objs)
+	sizes := [][2]float64{{612, 792}, {300, 400}}
+
+	// Import both pages and assemble a pdf from the imported objects, in the ways that a pdf
+	// generation library can
+	tests := []struct {
+		name     string
+		assemble func(t *testing.T) []byte
+	}{
+		{"ids", func(t *testing.T) []byte {
+			importer := newTestImporter(t, data)
+			pageSizes := importPages(t, importer, 2)
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return assemblePdf(t, templates, objects, pageSizes)
+		}},
+		{"hashes", func(t *testing.T) []byte {
+			importer := newTestImporter(t, data)
+			pageSizes := importPages(t, importer, 2)
+			hashes := importer.PutFormXobjectsUnordered()
+			unordered := importer.GetImportedObjectsUnordered()
+
+			// Give each object an id, and replace the hashes of the references with the ids
+			ids := make(map[string]int, 0)
+			for hash := range unordered {
+				ids[hash] = 100 + len(ids)
+			}
+			hashRegexp := regexp.MustCompile(`[0-9a-f]{40}`)
+			objects := make(map[int][]byte, 0)
+			for hash, object := range unordered {
+				objects[ids[hash]] = hashRegexp.ReplaceAllFunc(object, func(h []byte) []byte {
+					id, ok := ids[string(h)]
+					if !ok {
+						t.Fatalf("object references the unknown hash %s", h)
+					}
+					return []byte(strconv.Itoa(id))
+				})
+			}
+			templates := make(map[string]int, 0)
+			for name, hash := range hashes {
+				templates[name] = ids[hash]
+			}
+			return assemblePdf(t, templates, objects, pageSizes)
+		}},
+		{"StampPages", func(t *testing.T) []byte {
+			src := writeTempPdf(t, data)
+			defer os.Remove(src)
+			output, err := StampPages(src, []StampSpec{{PageNo: 1}, {PageNo: 2}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return output
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := test.assemble(t)
+
+			// Import the pages of the assembled pdf, which have the text and size of the pages
+			importer := newTestImporter(t, output)
+			if n := importer.GetNumPages(); n != 2 {
+				t.Fatalf("got %d pages, want 2", n)
+			}
+			for pageno := 1; pageno <= 2; pageno++ {
+				importer.ImportPage(pageno, "/MediaBox")
+				_, objects, err := importer.PutFormXobjectsWithIds(idCounter(1000 * pageno))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if text := fmt.Sprintf("(page %d)", pageno); !objectsContain(t, objects, text) {
+					t.Errorf("page %d does not contain %s", pageno, text)
+				}
+
+				boxes, err := importer.GetPageBoxesRaw(pageno)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if box := boxes["/MediaBox"]; box["w"] != sizes[pageno-1][0] || box["h"] != sizes[pageno-1][1] {
+					t.Errorf("page %d has size %vx%v, want %v", pageno, box["w"], box["h"], sizes[pageno-1])
+				}
+			}
+		})
+	}
+}
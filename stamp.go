@@ -0,0 +1,140 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Describes one page of the pdf created by StampPages
+type StampSpec struct {
+	PageNo int     // Page number in the source pdf (e.g. 1)
+	Box    string  // Box to import (e.g. /MediaBox), defaults to /MediaBox
+	Width  float64 // Width of the output page, defaults to the width of the imported page
+	Height float64 // Height of the output page, defaults to the height of the imported page
+	X      float64 // Position of the imported page, measured from the left of the output page
+	Y      float64 // Position of the imported page, measured from the top of the output page
+	W      float64 // Width of the imported page.  If 0, it is calculated from H.
+	H      float64 // Height of the imported page.  If 0, it is calculated from W.
+}
+
+// Options of the pdf created by StampPagesToWithOptions
+type StampOptions struct {
+	XrefStream bool // Write a cross-reference stream (PDF 1.5) instead of an xref table
+}
+
+// Create a complete pdf with one page for each spec, each page showing an imported page of src
+func StampPages(src string, outputs []StampSpec) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := StampPagesTo(&buf, src, outputs); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Like StampPages, but write the pdf to w.  Imported objects are written as soon as they are
+// complete, so memory usage does not grow with the size of the output.
+func StampPagesTo(w io.Writer, src string, outputs []StampSpec) error {
+	return StampPagesToWithOptions(w, src, outputs, StampOptions{})
+}
+
+// Like StampPagesTo, with options for the output pdf
+func StampPagesToWithOptions(w io.Writer, src string, outputs []StampSpec, opts StampOptions) error {
+	importer := NewImporter()
+	if err := importer.setSourceFile(src); err != nil {
+		return errors.Wrap(err, "Failed to open source file")
+	}
+	defer importer.GetReader().Close()
+
+	tplids := make([]int, len(outputs))
+	for i, spec := range outputs {
+		box := spec.Box
+		if box == "" {
+			box = "/MediaBox"
+		}
+
+		tplid, err := importer.importPage(spec.PageNo, box, "")
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Failed to import page %d", spec.PageNo))
+		}
+		tplids[i] = tplid
+	}
+
+	header := "%PDF-1.7\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return errors.Wrap(err, "Failed to write header")
+	}
+
+	// Object 1 is the catalog and object 2 is the page tree, followed by a page and a content
+	// stream for each output page.  Imported objects are numbered after those.
+	importer.SetNextObjectID(3 + 2*len(outputs))
+
+	writer := importer.GetWriter()
+	writer.SetOutput(w, len(header))
+	writer.SetXrefStream(opts.XrefStream)
+
+	tplObjIds, err := writer.PutFormXobjects(importer.GetReader())
+	if err != nil {
+		return errors.Wrap(err, "Failed to put form xobjects")
+	}
+
+	kids := ""
+	for i, spec := range outputs {
+		pageId := 3 + 2*i
+		contentId := pageId + 1
+		kids += fmt.Sprintf("%d 0 R ", pageId)
+
+		tplInfo, err := importer.getTplInfo(tplids[i])
+		if err != nil {
+			return err
+		}
+		tpl := tplInfo.Writer.tpls[tplInfo.TemplateId]
+
+		width := spec.Width
+		height := spec.Height
+		if width == 0 {
+			width = tpl.W
+		}
+		if height == 0 {
+			height = tpl.H
+		}
+
+		tplName, scaleX, scaleY, tx, ty := importer.UseTemplate(tplids[i], spec.X, spec.Y, spec.W, spec.H)
+
+		content := fmt.Sprintf("q %.4F 0 0 %.4F %.4F %.4F cm %s Do Q", scaleX, scaleY, tx, height+ty, tplName)
+
+		writer.newObj(pageId, false)
+		writer.out(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2F %.2F] /Resources << /XObject << %s %d 0 R >> >> /Contents %d 0 R >>",
+			width, height, tplName, tplObjIds[tplName].id, contentId))
+		writer.endObj()
+
+		writer.newObj(contentId, false)
+		writer.out(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+		writer.endObj()
+	}
+
+	// Keep the language of the source document, e.g. for screen readers.  An invalid /Lang is left out.
+	_, lang, err := importer.GetReader().getLanguage()
+
+	writer.newObj(1, false)
+	writer.straightOut("<< /Type /Catalog /Pages 2 0 R ")
+	if err == nil && lang != nil {
+		writer.straightOut("/Lang ")
+		writer.writeValue(lang)
+	}
+	writer.out(">>")
+	writer.endObj()
+
+	writer.newObj(2, false)
+	writer.out(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(outputs)))
+	writer.endObj()
+
+	if err := writer.putXref(1); err != nil {
+		return errors.Wrap(err, "Failed to write cross-reference")
+	}
+
+	return nil
+}
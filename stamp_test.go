@@ -0,0 +1,236 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Write a pdf to a temporary file and return its name
+func writeTempPdf(t testing.TB, data []byte) string {
+	f, err := ioutil.TempFile("", "gofpdi-*.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+// Count the open file descriptors of the process, or skip the test where this is not possible
+func countOpenFiles(t *testing.T) int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("Cannot count open files:", err)
+	}
+	return len(fds)
+}
+
+func TestStampPages(t *testing.T) {
+	src := writeTempPdf(t, buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET")))
+	defer os.Remove(src)
+
+	tests := []struct {
+		name    string
+		outputs []StampSpec
+		opts    StampOptions
+		fails   bool
+	}{
+		{"one page", []StampSpec{{PageNo: 1}}, StampOptions{}, false},
+		{"two pages scaled", []StampSpec{{PageNo: 2, Width: 300, Height: 400, W: 300}, {PageNo: 1}}, StampOptions{}, false},
+		{"xref stream", []StampSpec{{PageNo: 1}}, StampOptions{XrefStream: true}, false},
+		{"missing page", []StampSpec{{PageNo: 3}}, StampOptions{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := countOpenFiles(t)
+
+			var buf bytes.Buffer
+			err := StampPagesToWithOptions(&buf, src, test.outputs, test.opts)
+			if test.fails != (err != nil) {
+				t.Fatalf("unexpected error result: %v", err)
+			}
+
+			if after := countOpenFiles(t); after != before {
+				t.Errorf("%d files were left open", after-before)
+			}
+
+			if test.fails {
+				return
+			}
+
+			// The output must be readable and have the requested pages
+			reader, err := NewPdfReaderFromStream("output", bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := reader.getNumPages()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(test.outputs) {
+				t.Errorf("got %d pages, want %d", n, len(test.outputs))
+			}
+
+			// The objects are written as they are complete, so check that the xref points to each
+			objects, err := reader.listObjects()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, object := range objects {
+				if object.Error != "" {
+					t.Errorf("object %d: %s", object.Id, object.Error)
+				}
+			}
+		})
+	}
+}
+
+// Records the largest live heap while a pdf is written, sampled every 64 KB of output
+type heapSampler struct {
+	w       io.Writer
+	written int
+	base    uint64
+	peak    uint64
+}
+
+func (this *heapSampler) Write(p []byte) (int, error) {
+	if this.written/(64<<10) != (this.written+len(p))/(64<<10) {
+		this.sample()
+	}
+	this.written += len(p)
+	return this.w.Write(p)
+}
+
+func (this *heapSampler) sample() {
+	if heap := heapAlloc(); heap > this.base && heap-this.base > this.peak {
+		this.peak = heap - this.base
+	}
+}
+
+// Merge 200 pages into one pdf, with StampPagesTo, which writes objects as soon as they are
+// complete, and with the buffered objects of PutFormXobjects.  Compare the peak heap that is logged.
+func BenchmarkMerge(b *testing.B) {
+	contents := make([]string, 200)
+	outputs := make([]StampSpec, len(contents))
+	for i := range contents {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "BT /F1 12 Tf (page %d) Tj ET", i+1)
+		for j := 0; j < 200; j++ {
+			fmt.Fprintf(&buf, " %d %d m %d %d l S", (i*j)%612, (i+j)%792, (i*7+j*13)%612, (i*11+j*3)%792)
+		}
+		contents[i] = buf.String()
+		outputs[i] = StampSpec{PageNo: i + 1}
+	}
+	src := writeTempPdf(b, buildPdf(pagesPdf(contents...)))
+	defer os.Remove(src)
+
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sampler := &heapSampler{w: ioutil.Discard, base: heapAlloc()}
+			if err := StampPagesTo(sampler, src, outputs); err != nil {
+				b.Fatal(err)
+			}
+			b.Logf("peak heap: %d bytes for %d bytes of output", sampler.peak, sampler.written)
+		}
+	})
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sampler := &heapSampler{w: ioutil.Discard, base: heapAlloc()}
+
+			importer := NewImporter()
+			importer.SetSourceFile(src)
+			for pageno := 1; pageno <= len(contents); pageno++ {
+				importer.ImportPage(pageno, "/MediaBox")
+			}
+			importer.PutFormXobjects()
+			objects := importer.GetImportedObjects()
+			sampler.sample()
+			for _, object := range objects {
+				io.WriteString(sampler, object)
+			}
+			importer.Reset()
+
+			b.Logf("peak heap: %d bytes for %d bytes of output", sampler.peak, sampler.written)
+		}
+	})
+}
+
+// Output with a cross-reference stream reads back like output with an xref table
+func TestStampXrefStream(t *testing.T) {
+	src := writeTempPdf(t, buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET")))
+	defer os.Remove(src)
+
+	outputs := []StampSpec{{PageNo: 2}, {PageNo: 1, Width: 300, Height: 400, W: 300}}
+	var table, stream bytes.Buffer
+	if err := StampPagesToWithOptions(&table, src, outputs, StampOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := StampPagesToWithOptions(&stream, src, outputs, StampOptions{XrefStream: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(stream.Bytes(), []byte("\nxref\n")) || bytes.Contains(stream.Bytes(), []byte("trailer")) || !bytes.Contains(stream.Bytes(), []byte("/Type /XRef")) {
+		t.Fatalf("output has no cross-reference stream, or an xref table")
+	}
+
+	// The cross-reference stream has the objects of the xref table, and itself
+	summaries := make([]map[int]ObjectSummary, 2)
+	importers := make([]*Importer, 2)
+	for i, data := range [][]byte{table.Bytes(), stream.Bytes()} {
+		reader, err := NewPdfReaderFromStream("output", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects, err := reader.listObjects()
+		if err != nil {
+			t.Fatal(err)
+		}
+		summaries[i] = make(map[int]ObjectSummary, len(objects))
+		for _, object := range objects {
+			if object.Error != "" {
+				t.Errorf("object %d: %s", object.Id, object.Error)
+			}
+			summaries[i][object.Id] = object
+		}
+		importers[i] = newTestImporter(t, data)
+	}
+	if len(summaries[1]) != len(summaries[0])+1 {
+		t.Errorf("got %d objects, want %d and the cross-reference stream", len(summaries[1]), len(summaries[0]))
+	}
+	for id, object := range summaries[1] {
+		if object.Type == "/XRef" {
+			continue
+		}
+		if object != summaries[0][id] {
+			t.Errorf("got object %+v, want %+v", object, summaries[0][id])
+		}
+	}
+
+	// The pages are the same
+	if n := importers[1].GetNumPages(); n != 2 {
+		t.Fatalf("got %d pages, want 2", n)
+	}
+	for pageno := 1; pageno <= 2; pageno++ {
+		want, err := importers[0].GetPageContentStream(pageno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := importers[1].GetPageContentStream(pageno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("page %d: got content %q, want %q", pageno, got, want)
+		}
+	}
+}
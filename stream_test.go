@@ -0,0 +1,143 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Streams with a wrong /Length are recovered by searching for endstream, also when a keyword is
+// split between the chunks that are read
+func TestRecoverStreamData(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"short", 10},
+		// The data starts 32 bytes after the object offset, where the first chunk starts
+		{"endstream at chunk end", 65536 - 32 - 1 - 9},
+		{"endstream split between chunks", 65536 - 32 - 1 - 4},
+		{"endstream after chunk", 65536 - 32 - 1},
+		{"several chunks", 3*65536 + 100},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := strings.Repeat("0 0 m ", test.size/6+1)[:test.size]
+			objs := pagesPdf("BT ET")
+			objs[11] = "<< /Length 3 >>\nstream\n" + data + "\nendstream"
+
+			reader, err := NewPdfReaderFromStream("test", bytes.NewReader(buildPdf(objs)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := reader.getContent(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(content) != strings.TrimSpace(data) {
+				t.Errorf("got %d bytes of content, want %d", len(content), len(data))
+			}
+		})
+	}
+}
+
+// A stream whose /Length is wrong is recovered with a warning
+func TestWrongStreamLength(t *testing.T) {
+	content := "BT /F1 12 Tf 72 712 Td (Hello) Tj ET"
+
+	tests := []struct {
+		name   string
+		length string
+	}{
+		{"too small", "10"},
+		{"too large", "50"},
+		{"past the end of the file", "100000"},
+		{"zero", "0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[11] = "<< /Length " + test.length + " >>\nstream\n" + content + "\nendstream"
+			importer := newTestImporter(t, buildPdf(objs))
+
+			got, err := importer.GetPageContentStream(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(string(got)) != content {
+				t.Errorf("got content %q, want %q", got, content)
+			}
+
+			want := fmt.Sprintf("Stream of object 11 has wrong /Length %s, actual length is %d", test.length, len(content))
+			if warnings := importer.GetWarnings(); !in_array(want, warnings) {
+				t.Errorf("got warnings %q, want %q", warnings, want)
+			}
+		})
+	}
+}
+
+// Only the end of line after the stream keyword is skipped, not whitespace that starts the data
+func TestStreamEol(t *testing.T) {
+	tests := []struct {
+		name string
+		eol  string
+		data string
+	}{
+		{"lf", "\n", "BT ET"},
+		{"crlf", "\r\n", "BT ET"},
+		{"lf and space", "\n", " BT ET"},
+		{"crlf and space", "\r\n", " BT ET"},
+		{"lf and lf", "\n", "\nBT ET"},
+		{"crlf and crlf", "\r\n", "\r\nBT ET"},
+		{"lf and null", "\n", "\x00BT ET"},
+		{"crlf and tab", "\r\n", "\tBT ET"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[11] = fmt.Sprintf("<< /Length %d >>\nstream%s%s\nendstream", len(test.data), test.eol, test.data)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			got, err := importer.GetPageContentStream(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.data {
+				t.Errorf("got content %q, want %q", got, test.data)
+			}
+			if warnings := importer.GetWarnings(); len(warnings) > 0 {
+				t.Errorf("unexpected warnings %q", warnings)
+			}
+		})
+	}
+}
+
+// The /Length of a stream may be a reference to an object in an object stream
+func TestCompressedStreamLength(t *testing.T) {
+	content := "BT /F1 12 Tf 72 712 Td (Hello) Tj ET"
+
+	objs := pagesPdf(content)
+	objs[11] = "<< /Length 20 0 R >>\nstream\n" + content + "\nendstream"
+	compressed := map[int]string{1: objs[1], 2: objs[2], 10: objs[10], 20: fmt.Sprintf("%d", len(content))}
+	for id := range compressed {
+		delete(objs, id)
+	}
+	importer := newTestImporter(t, buildObjStmPdf(objs, compressed, "", nil))
+
+	got, err := importer.GetPageContentStream(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("got content %q, want %q", got, content)
+	}
+
+	// The length is read, not recovered by searching for endstream
+	if warnings := importer.GetWarnings(); len(warnings) > 0 {
+		t.Errorf("unexpected warnings %q", warnings)
+	}
+}
@@ -0,0 +1,156 @@
+package gofpdi
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Get the structure elements of a tagged page: the elements that the marked content of the page
+// belongs to (from the /ParentTree of the /StructTreeRoot) and their ancestors.  Returns copies of
+// the elements by object id, without references to pages and to elements that are not returned,
+// and references to the top elements, whose parent is the structure tree root.
+func (this *PdfReader) getPageStructure(pageno int) (map[int]*PdfValue, []*PdfValue, error) {
+	elems := make(map[int]*PdfValue, 0)
+	top := make([]*PdfValue, 0)
+
+	pageRef, err := this.getPageRef(pageno)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page, err := this.resolveValue(pageRef)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to resolve page object")
+	}
+
+	structParents, ok := page.Dictionary["/StructParents"]
+	if !ok || this.catalog.Value == nil {
+		return elems, top, nil
+	}
+	structParents, err = this.resolveValue(structParents)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to resolve /StructParents")
+	}
+
+	rootRef, ok := this.catalog.Value.Dictionary["/StructTreeRoot"]
+	if !ok {
+		return elems, top, nil
+	}
+	root, err := this.resolveValue(rootRef)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to resolve /StructTreeRoot")
+	}
+
+	parentTree, ok := root.Dictionary["/ParentTree"]
+	if !ok {
+		return elems, top, nil
+	}
+
+	entries := make([]*PdfValue, 0)
+	if err = this.readNumberTree(parentTree, &entries, 0); err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to read /ParentTree")
+	}
+
+	// The entry of the page is an array of the elements of its marked content, indexed by MCID
+	var parents *PdfValue
+	for i := 0; i+1 < len(entries); i += 2 {
+		if entries[i].Type == PDF_TYPE_NUMERIC && entries[i].Int == structParents.Int {
+			parents, err = this.resolveValue(entries[i+1])
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "Failed to resolve /ParentTree entry")
+			}
+			break
+		}
+	}
+	if parents == nil {
+		return elems, top, nil
+	}
+
+	// Collect the elements and their ancestors up to the root
+	refs := make(map[int]*PdfValue, 0)
+	for _, ref := range parents.Array {
+		for depth := 0; ref != nil && ref.Type == PDF_TYPE_OBJREF && depth < 64; depth++ {
+			if _, ok := refs[ref.Id]; ok || (rootRef.Type == PDF_TYPE_OBJREF && ref.Id == rootRef.Id) {
+				break
+			}
+
+			elem, err := this.resolveValue(ref)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "Failed to resolve structure element")
+			}
+			if elem.Type != PDF_TYPE_DICTIONARY {
+				break
+			}
+
+			refs[ref.Id] = ref
+			elems[ref.Id] = elem
+			ref = elem.Dictionary["/P"]
+		}
+	}
+
+	for id, elem := range elems {
+		elems[id] = stripStructElem(elem, elems)
+
+		if _, ok := elems[id].Dictionary["/P"]; !ok {
+			top = append(top, refs[id])
+		}
+	}
+
+	sort.Slice(top, func(i, j int) bool { return top[i].Id < top[j].Id })
+
+	return elems, top, nil
+}
+
+// Get a copy of a structure element without its page (/Pg), and without the parent and kids that are
+// not in elems, which would otherwise import the whole structure tree and source document
+func stripStructElem(elem *PdfValue, elems map[int]*PdfValue) *PdfValue {
+	result := &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, len(elem.Dictionary))}
+	for k, v := range elem.Dictionary {
+		result.Dictionary[k] = v
+	}
+
+	delete(result.Dictionary, "/Pg")
+
+	if p, ok := result.Dictionary["/P"]; ok {
+		if _, ok := elems[p.Id]; p.Type != PDF_TYPE_OBJREF || !ok {
+			delete(result.Dictionary, "/P")
+		}
+	}
+
+	k, ok := result.Dictionary["/K"]
+	if !ok {
+		return result
+	}
+
+	kids := []*PdfValue{k}
+	if k.Type == PDF_TYPE_ARRAY {
+		kids = k.Array
+	}
+
+	// Keep marked content ids, marked content references and kids that are imported.  Object
+	// references (/OBJR) are left out, because they refer to annotations of the source page.
+	result.Dictionary["/K"] = &PdfValue{Type: PDF_TYPE_ARRAY, Array: make([]*PdfValue, 0, len(kids))}
+	for _, kid := range kids {
+		switch kid.Type {
+		case PDF_TYPE_NUMERIC:
+			result.Dictionary["/K"].Array = append(result.Dictionary["/K"].Array, kid)
+		case PDF_TYPE_OBJREF:
+			if _, ok := elems[kid.Id]; ok {
+				result.Dictionary["/K"].Array = append(result.Dictionary["/K"].Array, kid)
+			}
+		case PDF_TYPE_DICTIONARY:
+			if t, ok := kid.Dictionary["/Type"]; ok && t.Token == "/MCR" {
+				mcr := &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, len(kid.Dictionary))}
+				for k, v := range kid.Dictionary {
+					mcr.Dictionary[k] = v
+				}
+				delete(mcr.Dictionary, "/Pg")
+				delete(mcr.Dictionary, "/StmOwn")
+				result.Dictionary["/K"].Array = append(result.Dictionary["/K"].Array, mcr)
+			}
+		}
+	}
+
+	return result
+}
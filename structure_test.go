@@ -0,0 +1,70 @@
+package gofpdi
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The structure elements of the marked content of a tagged page are imported with their ancestors,
+// without the elements of other pages
+func TestImportStructure(t *testing.T) {
+	refRegexp := regexp.MustCompile(`(\d+) 0 R`)
+
+	objs := pagesPdf("/P <</MCID 0>> BDC BT /F1 12 Tf (one) Tj ET EMC", "/P <</MCID 0>> BDC BT /F1 12 Tf (two) Tj ET EMC")
+	objs[1] = "<< /Type /Catalog /Pages 2 0 R /StructTreeRoot 30 0 R /MarkInfo << /Marked true >> >>"
+	objs[10] = strings.Replace(objs[10], "/Contents", "/StructParents 0 /Contents", 1)
+	objs[12] = strings.Replace(objs[12], "/Contents", "/StructParents 1 /Contents", 1)
+	objs[30] = "<< /Type /StructTreeRoot /K 31 0 R /ParentTree 35 0 R /ParentTreeNextKey 2 >>"
+	objs[31] = "<< /Type /StructElem /S /Document /P 30 0 R /K [32 0 R 33 0 R] >>"
+	objs[32] = "<< /Type /StructElem /S /P /P 31 0 R /Pg 10 0 R /K 0 /T (first paragraph) >>"
+	objs[33] = "<< /Type /StructElem /S /P /P 31 0 R /Pg 12 0 R /K 0 /T (second paragraph) >>"
+	objs[35] = "<< /Nums [0 [32 0 R] 1 [33 0 R]] >>"
+
+	importer := newTestImporter(t, buildPdf(objs))
+	importer.SetImportStructure(true)
+	tplid := importer.ImportPage(1, "/MediaBox")
+	_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top, err := importer.GetTemplateStructure(tplid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 1 {
+		t.Fatalf("got %d top structure elements, want 1", len(top))
+	}
+	document := objects[top[0]]
+	if !bytes.Contains(document, []byte("/S /Document")) || bytes.Contains(document, []byte("/P ")) {
+		t.Errorf("got top element %q, want /Document without /P", document)
+	}
+
+	// The document element has the paragraph of page 1 as its only kid
+	kids := refRegexp.FindAllSubmatch(document, -1)
+	if len(kids) != 1 {
+		t.Fatalf("got top element %q, want one kid", document)
+	}
+	id, _ := strconv.Atoi(string(kids[0][1]))
+	paragraph := objects[id]
+	if !bytes.Contains(paragraph, []byte("(first paragraph)")) || !bytes.Contains(paragraph, []byte("/P "+strconv.Itoa(top[0])+" 0 R")) {
+		t.Errorf("got paragraph %q, want the first paragraph with the document as /P", paragraph)
+	}
+
+	for id, object := range objects {
+		if bytes.Contains(object, []byte("/Pg")) {
+			t.Errorf("object %d %q references a page", id, object)
+		}
+		if bytes.Contains(object, []byte("(second paragraph)")) || bytes.Contains(object, []byte("/StructTreeRoot")) {
+			t.Errorf("object %d %q is not part of the structure of page 1", id, object)
+		}
+	}
+
+	// The marked content of the page is kept
+	if content := templateContent(t, importer, tplid); !strings.Contains(content, "/P <</MCID 0>> BDC") {
+		t.Errorf("got content %q without marked content", content)
+	}
+}
@@ -0,0 +1,332 @@
+package gofpdi
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// A /ToUnicode CMap of a font, which maps character codes to text.  Only the code space ranges and
+// the bfchar and bfrange mappings are used.
+type toUnicodeMap struct {
+	codespaces []cmapRange
+	chars      map[string]string
+	ranges     []cmapRange
+}
+
+// A range of character codes of the same length, with (for bfrange) the text of the first code,
+// or the text of each code if Dst is an array
+type cmapRange struct {
+	Low  []byte
+	High []byte
+	Dst  *PdfValue
+}
+
+// A font for text extraction
+type textFont struct {
+	cmap *toUnicodeMap
+	cid  bool // Type0 font, whose codes are two bytes unless the CMap defines code space ranges
+}
+
+// Parse a decoded /ToUnicode CMap stream
+func (this *PdfReader) parseToUnicode(data []byte) (*toUnicodeMap, error) {
+	// A CMap is a PostScript program, but the operators it uses have the same syntax as the
+	// operators of a content stream
+	ops, err := this.parseContent(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cmap := &toUnicodeMap{chars: make(map[string]string, 0)}
+	isString := func(v *PdfValue) bool {
+		return v.Type == PDF_TYPE_HEX || v.Type == PDF_TYPE_STRING
+	}
+
+	for _, op := range ops {
+		switch op.Operator {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(op.Operands); i += 2 {
+				if isString(op.Operands[i]) && isString(op.Operands[i+1]) {
+					cmap.codespaces = append(cmap.codespaces, cmapRange{Low: pdf_string_bytes(op.Operands[i]), High: pdf_string_bytes(op.Operands[i+1])})
+				}
+			}
+
+		case "endbfchar":
+			for i := 0; i+1 < len(op.Operands); i += 2 {
+				if isString(op.Operands[i]) && isString(op.Operands[i+1]) {
+					cmap.chars[string(pdf_string_bytes(op.Operands[i]))] = decode_utf16(pdf_string_bytes(op.Operands[i+1]))
+				}
+			}
+
+		case "endbfrange":
+			for i := 0; i+2 < len(op.Operands); i += 3 {
+				if !isString(op.Operands[i]) || !isString(op.Operands[i+1]) {
+					continue
+				}
+				r := cmapRange{Low: pdf_string_bytes(op.Operands[i]), High: pdf_string_bytes(op.Operands[i+1]), Dst: op.Operands[i+2]}
+				if len(r.Low) != len(r.High) || (!isString(r.Dst) && r.Dst.Type != PDF_TYPE_ARRAY) {
+					continue
+				}
+				cmap.ranges = append(cmap.ranges, r)
+			}
+		}
+	}
+
+	return cmap, nil
+}
+
+// Get the length of the character code at the start of b, by the code space ranges of the CMap.
+// If no range matches, n bytes are used.
+func (this *toUnicodeMap) codeLength(b []byte, n int) int {
+	for _, r := range this.codespaces {
+		if len(r.Low) <= len(b) && r.contains(b[:len(r.Low)]) {
+			return len(r.Low)
+		}
+	}
+
+	if n > len(b) {
+		return len(b)
+	}
+	return n
+}
+
+// Get the text of a character code
+func (this *toUnicodeMap) lookup(code []byte) (string, bool) {
+	if text, ok := this.chars[string(code)]; ok {
+		return text, true
+	}
+
+	for _, r := range this.ranges {
+		if len(r.Low) != len(code) || !r.contains(code) {
+			continue
+		}
+
+		offset := readBigEndian(code) - readBigEndian(r.Low)
+		if r.Dst.Type == PDF_TYPE_ARRAY {
+			if offset >= len(r.Dst.Array) {
+				return "", false
+			}
+			return decode_utf16(pdf_string_bytes(r.Dst.Array[offset])), true
+		}
+
+		// The last byte of the text of the first code is incremented for the following codes
+		dst := pdf_string_bytes(r.Dst)
+		if len(dst) == 0 {
+			return "", false
+		}
+		dst = append([]byte(nil), dst...)
+		n := int(dst[len(dst)-1]) + offset
+		dst[len(dst)-1] = byte(n)
+		if n > 0xff && len(dst) >= 2 {
+			dst[len(dst)-2] += byte(n >> 8)
+		}
+		return decode_utf16(dst), true
+	}
+
+	return "", false
+}
+
+// Check if a code of the same length is in the range.  Each byte is compared separately, as in
+// the code space ranges of a CMap.
+func (this cmapRange) contains(code []byte) bool {
+	for i := range code {
+		if code[i] < this.Low[i] || code[i] > this.High[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Decode UTF-16BE bytes without a byte order mark to UTF-8
+func decode_utf16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// Get a font for text extraction from its font dictionary
+func (this *PdfReader) getTextFont(font *PdfValue) (*textFont, error) {
+	font, err := this.resolveValue(font)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve font")
+	}
+
+	result := &textFont{}
+	if font.Type != PDF_TYPE_DICTIONARY {
+		return result, nil
+	}
+
+	if subtype, ok := font.Dictionary["/Subtype"]; ok && subtype.Token == "/Type0" {
+		result.cid = true
+	}
+
+	toUnicode, ok := font.Dictionary["/ToUnicode"]
+	if !ok {
+		return result, nil
+	}
+
+	stream, err := this.resolveObject(toUnicode)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to resolve /ToUnicode CMap")
+	}
+	if stream.Type != PDF_TYPE_STREAM {
+		// e.g. /Identity-H, which gives no text
+		return result, nil
+	}
+
+	data, err := this.rebuildContentStream(stream)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode /ToUnicode CMap")
+	}
+
+	result.cmap, err = this.parseToUnicode(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse /ToUnicode CMap")
+	}
+
+	return result, nil
+}
+
+// Decode the bytes of a string shown with the font to text.  Codes that the /ToUnicode CMap does
+// not map are decoded as PDFDocEncoding for simple fonts, and as U+FFFD for Type0 fonts.
+func (this *textFont) decode(b []byte) string {
+	n := 1
+	if this.cid {
+		n = 2
+	}
+
+	var buf bytes.Buffer
+	for len(b) > 0 {
+		length := n
+		if this.cmap != nil {
+			length = this.cmap.codeLength(b, n)
+		} else if length > len(b) {
+			length = len(b)
+		}
+		code := b[:length]
+		b = b[length:]
+
+		if this.cmap != nil {
+			if text, ok := this.cmap.lookup(code); ok {
+				buf.WriteString(text)
+				continue
+			}
+		}
+		if this.cid {
+			buf.WriteRune('\ufffd')
+		} else {
+			buf.WriteString(decode_pdf_text(code))
+		}
+	}
+
+	return buf.String()
+}
+
+// Get the text of a page, in the order of the content stream, with a line break when the text
+// moves to a new line.  Text inside form xobjects is not included.
+func (this *PdfReader) getPageText(pageno int) (string, error) {
+	content, err := this.getContent(pageno)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get page content")
+	}
+
+	ops, err := this.parseContent([]byte(content))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to parse page content")
+	}
+
+	resources, err := this.getPageResources(pageno)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get page resources")
+	}
+	fonts := &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, 0)}
+	if f, ok := resources.Dictionary["/Font"]; ok {
+		if fonts, err = this.resolveValue(f); err != nil {
+			return "", errors.Wrap(err, "Failed to resolve font resources")
+		}
+	}
+
+	var buf bytes.Buffer
+	newline := func() {
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+	operand := func(op contentOp, i int) *PdfValue {
+		if i < 0 || i >= len(op.Operands) {
+			return &PdfValue{Type: PDF_TYPE_NULL}
+		}
+		return op.Operands[i]
+	}
+	number := func(v *PdfValue) float64 {
+		if v.Type == PDF_TYPE_REAL {
+			return v.Real
+		}
+		return float64(v.Int)
+	}
+
+	textFonts := make(map[string]*textFont, 0)
+	font := &textFont{}
+	show := func(v *PdfValue) {
+		if v.Type == PDF_TYPE_HEX || v.Type == PDF_TYPE_STRING {
+			buf.WriteString(font.decode(pdf_string_bytes(v)))
+		}
+	}
+
+	for _, op := range ops {
+		switch op.Operator {
+		case "Tf":
+			name := operand(op, 0).Token
+			if _, ok := textFonts[name]; !ok {
+				textFonts[name] = &textFont{}
+				if f, ok := fonts.Dictionary[name]; ok {
+					if textFonts[name], err = this.getTextFont(f); err != nil {
+						return "", errors.Wrap(err, "Failed to get font "+name)
+					}
+				}
+			}
+			font = textFonts[name]
+
+		case "Tj":
+			show(operand(op, 0))
+
+		case "'":
+			newline()
+			show(operand(op, 0))
+
+		case "\"":
+			newline()
+			show(operand(op, 2))
+
+		case "TJ":
+			for _, v := range operand(op, 0).Array {
+				// A large negative adjustment (in thousandths of the font size) is a word space
+				if (v.Type == PDF_TYPE_NUMERIC || v.Type == PDF_TYPE_REAL) && number(v) < -200 {
+					buf.WriteByte(' ')
+				}
+				show(v)
+			}
+
+		case "T*", "Tm":
+			newline()
+
+		case "Td", "TD":
+			if number(operand(op, 1)) != 0 {
+				newline()
+			}
+		}
+	}
+
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+// Get the text of a page of the source document.  Text of fonts with a /ToUnicode CMap (e.g. the
+// Type0 fonts of CJK text and subset fonts) is mapped by the CMap.  This is a simple extraction that
+// does not reorder text by its position on the page.
+func (this *Importer) GetPageText(pageno int) (string, error) {
+	return this.GetReader().getPageText(pageno)
+}
@@ -0,0 +1,61 @@
+package gofpdi
+
+import (
+	"strings"
+	"testing"
+)
+
+// Text of a Type0 font is mapped by its /ToUnicode CMap
+func TestGetPageText(t *testing.T) {
+	const cmap = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CMapName /Adobe-Identity-UCS def
+/CMapType 2 def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0001> <65E5>
+<0002> <672C>
+endbfchar
+2 beginbfrange
+<0010> <0012> <0041>
+<0020> <0021> [<0048> <D83DDE00>]
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+
+	// Codes that are not in the CMap are replaced, and text of simple fonts is PDFDocEncoding
+	const content = "BT /F1 12 Tf <00010002> Tj 0 -14 Td <001000110012> Tj T* [<0020> -300 <0021>] TJ <0099> Tj /F2 12 Tf (caf\\351) ' ET"
+	const want = "日本\nABC\nH 😀\ufffd\ncafé"
+
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		{"cmap", pdfStream("", cmap)},
+		{"compressed cmap", pdfStream("/Filter /FlateDecode", string(deflate([]byte(cmap))))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf(content)
+			objs[3] = "<< /Type /Font /Subtype /Type0 /BaseFont /NotoSansCJK /Encoding /Identity-H /DescendantFonts [5 0 R] /ToUnicode 6 0 R >>"
+			objs[4] = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"
+			objs[5] = "<< /Type /Font /Subtype /CIDFontType2 /BaseFont /NotoSansCJK /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> >>"
+			objs[6] = test.stream
+			objs[10] = strings.Replace(objs[10], "/F1 3 0 R", "/F1 3 0 R /F2 4 0 R", 1)
+
+			got, err := newTestImporter(t, buildPdf(objs)).GetPageText(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("got text %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// The trace function is called for the xref, each resolved object, each decoded filter and each
+// fallback during an import
+func TestTraceFunc(t *testing.T) {
+	objs := pagesPdf("")
+	objs[11] = pdfStream("/Filter /FlateDecode", string(deflate([]byte("BT /F1 12 Tf (one) Tj ET"))))
+	data := buildPdf(objs)
+
+	events := make([]string, 0)
+	importer := NewImporter()
+	importer.SetTraceFunc(func(event string, args ...interface{}) {
+		events = append(events, event+" "+fmt.Sprint(args...))
+	})
+	if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	importer.ImportPage(1, "/TrimBox")
+	if _, _, err := importer.PutFormXobjectsWithIds(idCounter(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		fmt.Sprintf("xref %d", bytes.Index(data, []byte("\nxref"))+1),
+		"object 1 0",
+		"object 2 0",
+		"object 10 0",
+		"object 11 0",
+		"object 3 0",
+		"filter /FlateDecode",
+		"fallback page 1 /TrimBox uses /MediaBox",
+	}
+	for _, event := range want {
+		if !in_array(event, events) {
+			t.Errorf("no event %q in %q", event, events)
+		}
+	}
+
+}
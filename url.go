@@ -0,0 +1,90 @@
+package gofpdi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Downloads up to this size are kept in memory.  Larger downloads, or downloads of unknown size,
+// are written to a temporary file.
+const maxInMemoryDownload = 16 << 20
+
+// Download a pdf and set it as the source.  Downloading the same url again reuses the first download.
+func (this *Importer) SetSourceURL(ctx context.Context, url string) error {
+	if _, ok := this.readers[url]; ok {
+		return this.setSourceStream(url, nil)
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create request")
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "Failed to download "+url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(fmt.Sprintf("Failed to download %s: %s", url, resp.Status))
+	}
+
+	rs, err := bufferBody(resp.Body, resp.ContentLength)
+	if err != nil {
+		return errors.Wrap(err, "Failed to download "+url)
+	}
+
+	if err = this.setSourceStream(url, rs); err != nil {
+		if f, ok := rs.(*os.File); ok {
+			f.Close()
+		}
+		return err
+	}
+
+	// The reader owns the temporary file, so that Close and Reset close it
+	if f, ok := rs.(*os.File); ok {
+		this.readers[url].file = f
+	}
+
+	return nil
+}
+
+// Make a seekable copy of a download, in memory if it is small enough, otherwise in a temporary file
+func bufferBody(body io.Reader, length int64) (io.ReadSeeker, error) {
+	if length >= 0 && length <= maxInMemoryDownload {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+
+	f, err := ioutil.TempFile("", "gofpdi")
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to create temporary file")
+	}
+
+	// The file stays open for as long as the reader uses it.  Removing it now means it is deleted
+	// once it is closed (this has no effect on Windows, where open files cannot be removed).
+	os.Remove(f.Name())
+
+	if _, err = io.Copy(f, body); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "Unable to write temporary file")
+	}
+
+	if _, err = f.Seek(0, 0); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "Unable to seek temporary file")
+	}
+
+	return f, nil
+}
@@ -0,0 +1,57 @@
+package gofpdi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestSetSourceURL(t *testing.T) {
+	data := buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET"))
+
+	tests := []struct {
+		name     string
+		length   bool // Send a Content-Length, so that the download is kept in memory
+		tempFile bool
+	}{
+		{"known length", true, false},
+		{"unknown length", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.length {
+					w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				}
+				w.Write(data[:10])
+				// Without a Content-Length, flushing before the end makes the response chunked
+				w.(http.Flusher).Flush()
+				w.Write(data[10:])
+			}))
+			defer server.Close()
+
+			importer := NewImporter()
+			if err := importer.SetSourceURL(context.Background(), server.URL); err != nil {
+				t.Fatal(err)
+			}
+			if n := importer.GetNumPages(); n != 1 {
+				t.Errorf("got %d pages, want 1", n)
+			}
+
+			f := importer.GetReader().file
+			if test.tempFile != (f != nil) {
+				t.Fatalf("temporary file used: %v, want %v", f != nil, test.tempFile)
+			}
+
+			importer.Reset()
+			if f != nil {
+				if _, err := f.Stat(); err == nil {
+					t.Errorf("temporary file is still open after Reset")
+				}
+			}
+		})
+	}
+}
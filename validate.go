@@ -0,0 +1,96 @@
+package gofpdi
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Errors returned by ValidateFile and ValidateStream.  Use errors.Cause(err) to compare.
+var (
+	ErrInvalidXref  = errors.New("Invalid xref table")
+	ErrMissingRoot  = errors.New("Missing or invalid root object")
+	ErrInvalidPages = errors.New("Invalid page tree")
+	ErrEncrypted    = errors.New("Encrypted pdf is not supported")
+)
+
+// Check that a pdf file can be parsed without importing anything.
+// Returns nil for a good file, or an error describing the first structural problem found.
+func ValidateFile(path string) error {
+	reader, err := newPdfReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return reader.validate()
+}
+
+// Check that a pdf stream can be parsed without importing anything.
+// Returns nil for a good stream, or an error describing the first structural problem found.
+func ValidateStream(rs io.ReadSeeker) error {
+	reader, err := newPdfReaderFromStream("", rs)
+	if err != nil {
+		return err
+	}
+
+	return reader.validate()
+}
+
+// Run the parse pipeline step by step and map failures to one of the validation errors
+func (this *PdfReader) validate() error {
+	var err error
+
+	if err = this.findXref(); err != nil {
+		return errors.Wrap(ErrInvalidXref, err.Error())
+	}
+
+	if err = this.readXref(); err != nil {
+		return errors.Wrap(ErrInvalidXref, err.Error())
+	}
+
+	if this.trailer == nil {
+		return errors.Wrap(ErrMissingRoot, "Trailer with /Root not found")
+	}
+
+	if err = this.checkEncryption(); err != nil {
+		return err
+	}
+
+	if err = this.readRoot(); err != nil {
+		return errors.Wrap(ErrMissingRoot, err.Error())
+	}
+
+	if this.catalog.Value == nil || this.catalog.Value.Type != PDF_TYPE_DICTIONARY {
+		return errors.Wrap(ErrMissingRoot, "Root object is not a dictionary")
+	}
+
+	if _, ok := this.catalog.Value.Dictionary["/Pages"]; !ok {
+		return errors.Wrap(ErrInvalidPages, "Root object has no /Pages")
+	}
+
+	if err = this.readPages(); err != nil {
+		return errors.Wrap(ErrInvalidPages, err.Error())
+	}
+
+	// Make sure every page can be resolved
+	for i := 0; i < len(this.pages); i++ {
+		if this.pages[i] == nil {
+			return errors.Wrap(ErrInvalidPages, fmt.Sprintf("Page %d is missing from page tree", i+1))
+		}
+
+		page, err := this.resolveObject(this.pages[i])
+		if err != nil {
+			return errors.Wrap(ErrInvalidPages, err.Error())
+		}
+
+		if page.Value == nil || page.Value.Type != PDF_TYPE_DICTIONARY {
+			return errors.Wrap(ErrInvalidPages, fmt.Sprintf("Page %d is not a dictionary", i+1))
+		}
+	}
+
+	this.alreadyRead = true
+
+	return nil
+}
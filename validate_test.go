@@ -0,0 +1,99 @@
+package gofpdi
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestValidate(t *testing.T) {
+	good := func() map[int]string {
+		return pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET")
+	}
+
+	tests := []struct {
+		name string
+		pdf  func() []byte
+		want error
+	}{
+		{"good", func() []byte {
+			return buildPdf(good())
+		}, nil},
+		{"startxref past the end", func() []byte {
+			data := buildPdf(good())
+			i := bytes.LastIndex(data, []byte("startxref\n"))
+			return append(data[:i], "startxref\n999999\n%%EOF\n"...)
+		}, ErrInvalidXref},
+		{"no startxref", func() []byte {
+			data := buildPdf(good())
+			return data[:bytes.LastIndex(data, []byte("startxref"))]
+		}, ErrInvalidXref},
+		{"trailer without /Root", func() []byte {
+			return bytes.Replace(buildPdf(good()), []byte("/Root 1 0 R"), []byte("/Info 1 0 R"), 1)
+		}, ErrMissingRoot},
+		{"root is not a dictionary", func() []byte {
+			objs := good()
+			objs[1] = "42"
+			return buildPdf(objs)
+		}, ErrMissingRoot},
+		{"root without /Pages", func() []byte {
+			objs := good()
+			objs[1] = "<< /Type /Catalog >>"
+			return buildPdf(objs)
+		}, ErrInvalidPages},
+		{"pages is not a dictionary", func() []byte {
+			objs := good()
+			objs[2] = "[10 0 R 12 0 R]"
+			return buildPdf(objs)
+		}, ErrInvalidPages},
+		{"count is not a number", func() []byte {
+			objs := good()
+			objs[2] = "<< /Type /Pages /Kids [10 0 R 12 0 R] /Count /Two >>"
+			return buildPdf(objs)
+		}, ErrInvalidPages},
+		{"pages object is missing", func() []byte {
+			objs := good()
+			delete(objs, 2)
+			return buildPdf(objs)
+		}, ErrInvalidPages},
+
+		// Kids that are missing are skipped with a warning, like null kids
+		{"missing page", func() []byte {
+			objs := good()
+			delete(objs, 12)
+			return buildPdf(objs)
+		}, nil},
+		{"encrypted", func() []byte {
+			objs := good()
+			objs[5] = "<< /Filter /Standard /V 2 /R 3 /Length 128 /O <00> /U <00> /P -4 >>"
+			return bytes.Replace(buildPdf(objs), []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Encrypt 5 0 R /ID [<01> <01>]"), 1)
+		}, ErrEncrypted},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.pdf()
+			file := writeTempPdf(t, data)
+			defer os.Remove(file)
+
+			results := map[string]error{
+				"file":   ValidateFile(file),
+				"stream": ValidateStream(bytes.NewReader(data)),
+			}
+			for source, err := range results {
+				if errors.Cause(err) != test.want {
+					t.Errorf("%s: got %v, want %v", source, err, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateMissingFile(t *testing.T) {
+	if err := ValidateFile("does-not-exist.pdf"); err == nil || !strings.Contains(err.Error(), "Failed to open file") {
+		t.Errorf("expected an error opening the file, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package gofpdi
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPageWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		catalog string
+		want    []string
+	}{
+		{
+			"filters in name order",
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			[]string{
+				"Resource /XObject /Im1 uses non-standard filter /Foo which is passed through undecoded",
+				"Resource /XObject /Im2 uses non-standard filter /Bar which is passed through undecoded",
+			},
+		},
+		{
+			"unresolvable catalog entries are skipped",
+			"<< /Type /Catalog /Pages 2 0 R /Names 98 0 R /OpenAction 99 0 R >>",
+			[]string{
+				"Resource /XObject /Im1 uses non-standard filter /Foo which is passed through undecoded",
+				"Resource /XObject /Im2 uses non-standard filter /Bar which is passed through undecoded",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("q /Im1 Do Q q /Im2 Do Q")
+			objs[1] = test.catalog
+			objs[10] = "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /XObject << /Im2 5 0 R /Im1 4 0 R >> >> /Contents 11 0 R >>"
+			objs[4] = pdfStream("/Type /XObject /Subtype /Image /Width 1 /Height 1 /Filter /Foo", "x")
+			objs[5] = pdfStream("/Type /XObject /Subtype /Image /Width 1 /Height 1 /Filter [/Bar]", "y")
+
+			// Record the objects that are read, to check that the image data is not
+			read := make(map[int]bool, 0)
+			importer := NewImporter()
+			importer.SetTraceFunc(func(event string, args ...interface{}) {
+				if event == "object" {
+					read[args[0].(int)] = true
+				}
+			})
+			var rs io.ReadSeeker = bytes.NewReader(buildPdf(objs))
+			importer.SetSourceStream(&rs)
+
+			tplid, err := importer.ImportPages([]int{1}, "/MediaBox")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := importer.GetTemplateWarnings(tplid[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if read[4] || read[5] {
+				t.Errorf("image streams were read to collect warnings")
+			}
+		})
+	}
+}
+
+// Pages larger than the maximum page size get a warning
+func TestMaxPageSize(t *testing.T) {
+	const large = "Page /MediaBox is 14401 x 792 units, larger than 14400; viewers may clip it unless it is scaled down and /UserUnit is set to keep its size"
+
+	tests := []struct {
+		name     string
+		mediaBox string
+		maxSize  float64
+		want     []string
+	}{
+		{"letter", "[0 0 612 792]", 0, nil},
+		{"largest", "[0 0 14400 14400]", 0, nil},
+		{"oversized", "[0 0 14401 792]", 0, []string{large}},
+		{"oversized with offset", "[100 0 14501 792]", 0, []string{large}},
+		{"oversized height", "[0 0 612 20000]", 0, []string{"Page /MediaBox is 612 x 20000 units, larger than 14400; viewers may clip it unless it is scaled down and /UserUnit is set to keep its size"}},
+		{"configured size", "[0 0 612 792]", 700, []string{"Page /MediaBox is 612 x 792 units, larger than 700; viewers may clip it unless it is scaled down and /UserUnit is set to keep its size"}},
+		{"disabled", "[0 0 14401 792]", -1, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT ET")
+			objs[10] = strings.Replace(objs[10], "[0 0 612 792]", test.mediaBox, 1)
+
+			importer := NewImporter()
+			importer.SetMaxPageSize(test.maxSize)
+			if err := importer.setSourceStream("test.pdf", bytes.NewReader(buildPdf(objs))); err != nil {
+				t.Fatal(err)
+			}
+			tplid := importer.ImportPage(1, "/MediaBox")
+
+			got, err := importer.GetTemplateWarnings(tplid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.want) || (len(got) > 0 && !reflect.DeepEqual(got, test.want)) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -7,8 +7,11 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"math"
 	"os"
+	"sort"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -33,6 +36,23 @@ type PdfWriter struct {
 	current_obj_id  int
 	tpl_id_offset   int
 	use_hash        bool
+	stream          bool
+	tpl_name_prefix string
+	alloc_obj_id    func() int
+	import_annots   bool
+	annot_ids       map[int]bool
+	annot_matrix    map[int][6]float64
+	best_effort     bool
+	import_struct   bool
+	struct_elems    map[int]*PdfValue
+	flatten_forms   bool
+	max_page_size   float64
+	xref_stream     bool
+	rewrite_content func(pageno int, content []byte) ([]byte, error)
+	hash_ids        map[string]int
+	hash_err        error
+	keep_refs       bool
+	mu              sync.Mutex // Held by Importer while it imports a template with this writer
 }
 
 type PdfObjectId struct {
@@ -57,16 +77,117 @@ func (this *PdfWriter) Init() {
 	this.written_objs = make(map[*PdfObjectId][]byte, 0)
 	this.written_obj_pos = make(map[*PdfObjectId]map[int]string, 0)
 	this.current_obj = new(PdfObject)
+	this.tpl_name_prefix = "GOFPDITPL"
+	this.annot_ids = make(map[int]bool, 0)
+	this.annot_matrix = make(map[int][6]float64, 0)
+	this.hash_ids = make(map[string]int, 0)
+	this.struct_elems = make(map[int]*PdfValue, 0)
+}
+
+// In best effort mode, recoverable problems (e.g. a missing page box, or an object that cannot be
+// resolved) are recorded as warnings of the source document and a substitute is used, instead of
+// failing the import
+func (this *PdfWriter) SetBestEffort(b bool) {
+	this.best_effort = b
+}
+
+// Set the prefix of template names (default GOFPDITPL, giving /GOFPDITPL0, /GOFPDITPL1, etc.)
+// Use a different prefix for each importer whose templates end up in the same output.
+func (this *PdfWriter) SetTemplateNamePrefix(prefix string) {
+	this.tpl_name_prefix = prefix
+}
+
+// Get the name of a template (e.g. /GOFPDITPL1)
+func (this *PdfWriter) tplName(tpl *PdfTemplate) string {
+	return fmt.Sprintf("/%s%d", this.tpl_name_prefix, tpl.Id)
+}
+
+// Import the annotations of pages (e.g. links, stamps, signature appearances) along with their
+// appearance streams.  The object ids of the imported annotations are in the template's AnnotObjIds
+// after PutFormXobjects, and should be added to the /Annots of the page the template is used on.
+// The /Rect of the annotations is rotated and moved like the template, so it is right for templates
+// that are drawn unscaled at the origin of the page, unless a placement is set with
+// PdfTemplate.SetPlacement.
+func (this *PdfWriter) SetImportAnnotations(b bool) {
+	this.import_annots = b
+}
+
+// Pages wider or higher than this get a warning by default.  Acrobat 4 and older viewers do not
+// support larger pages, and other viewers may clip them.
+const defaultMaxPageSize = 14400
+
+// Set the size in units above which the box of an imported page gets a template warning
+// (default 14400, 200 inches).  A negative size disables the warning.
+func (this *PdfWriter) SetMaxPageSize(size float64) {
+	this.max_page_size = size
+}
+
+// Draw the appearances of form fields into the content of imported pages, so that the fields are
+// part of the page and can no longer be edited.  Check boxes and radio buttons are drawn in their
+// current state.  Flattened fields are not imported as annotations.
+func (this *PdfWriter) SetFlattenForms(b bool) {
+	this.flatten_forms = b
+}
+
+// Set a function that rewrites the decoded content of each imported page before it is stored in
+// the template, e.g. to change colors or remove a watermark.  It is called with the page number and
+// the content, and returns the new content.  Pass nil to disable it.
+func (this *PdfWriter) SetContentRewriter(fn func(pageno int, content []byte) ([]byte, error)) {
+	this.rewrite_content = fn
+}
+
+// Import the structure elements of tagged pages that the marked content of the page belongs to,
+// and their ancestors.  The top elements must be added to the structure tree of the output by the
+// caller (see PdfTemplate.StructObjIds).
+func (this *PdfWriter) SetImportStructure(b bool) {
+	this.import_struct = b
 }
 
 func (this *PdfWriter) SetUseHash(b bool) {
 	this.use_hash = b
 }
 
+// Use fn to allocate the ids of new objects instead of counting up from SetNextObjectID.
+// This lets a pdf generation library hand out its own object ids, so imported objects
+// reference real ids and no hashes need to be replaced.
+func (this *PdfWriter) SetObjectIdAllocator(fn func() int) {
+	this.alloc_obj_id = fn
+}
+
 func (this *PdfWriter) SetNextObjectID(id int) {
 	this.n = id - 1
 }
 
+// Write objects to w as soon as they are complete, instead of keeping them in memory for
+// GetImportedObjects.  offset is the position in the output pdf at which w starts, and is used to
+// calculate the xref offsets returned by GetObjectOffsets.  Call Flush when done.
+func (this *PdfWriter) SetOutput(w io.Writer, offset int) {
+	this.w = bufio.NewWriter(w)
+	this.offset = offset
+	this.offsets = make(map[int]int, 0)
+	this.stream = true
+}
+
+// Write a cross-reference stream (PDF 1.5) instead of an xref table and trailer at the end of the
+// output set by SetOutput, which is smaller for large documents
+func (this *PdfWriter) SetXrefStream(xrefStream bool) {
+	this.xref_stream = xrefStream
+}
+
+// Get the offsets of the objects that have been written to the output set by SetOutput
+func (this *PdfWriter) GetObjectOffsets() map[int]int {
+	return this.offsets
+}
+
+// Flush any buffered data to the output set by SetOutput
+func (this *PdfWriter) Flush() error {
+	if this.w == nil {
+		return nil
+	}
+
+	return this.w.Flush()
+}
+
 func NewPdfWriter(filename string) (*PdfWriter, error) {
 	writer := &PdfWriter{}
 	writer.Init()
@@ -97,6 +218,45 @@ type PdfTemplate struct {
 	H         float64
 	Rotation  int
 	N         int
+	Warnings  []string
+	released  bool
+	// Annotations of the page, if annotations are imported
+	Annots      []*PdfValue
+	AnnotObjIds []*PdfObjectId
+	// Extra transformation set by SetMatrix
+	Matrix *[6]float64
+	// Transformation of the template on the output page set by SetPlacement
+	Placement *[6]float64
+	// Box that the template is clipped to, if it is not Box
+	ClipBox map[string]float64
+	// Structure elements of the page, if the structure is imported
+	StructElems  map[int]*PdfValue
+	StructTop    []*PdfValue
+	StructObjIds []*PdfObjectId
+}
+
+// Set a transformation matrix (a b c d e f) that is applied to the template in addition to the
+// one gofpdi calculates.  It works in the coordinates of the imported box, with the origin at its
+// lower left corner, e.g. [-1 0 0 1 W 0] mirrors the page horizontally.
+// Must be called before PutFormXobjects.
+func (this *PdfTemplate) SetMatrix(m [6]float64) {
+	this.Matrix = &m
+}
+
+// Set the transformation matrix (a b c d e f) that the template is drawn with on the output page,
+// i.e. the operands of the cm operator before its Do operator, so that the /Rect of its imported
+// annotations is transformed to the output page.  Must be called before PutFormXobjects.
+func (this *PdfTemplate) SetPlacement(m [6]float64) {
+	this.Placement = &m
+}
+
+// Get the box that the template is clipped to
+func (this *PdfTemplate) clipBox() map[string]float64 {
+	if len(this.ClipBox) > 0 {
+		return this.ClipBox
+	}
+
+	return this.Box
 }
 
 func (this *PdfWriter) GetImportedObjects() map[*PdfObjectId][]byte {
@@ -115,48 +275,99 @@ func (this *PdfWriter) ClearImportedObjects() {
 
 // Create a PdfTemplate object from a page number (e.g. 1) and a boxName (e.g. MediaBox)
 func (this *PdfWriter) ImportPage(reader *PdfReader, pageno int, boxName string) (int, error) {
+	return this.ImportPageWithClipBox(reader, pageno, boxName, "")
+}
+
+// Like ImportPage, but clip the template to clipBoxName (e.g. /TrimBox) instead of boxName, which
+// only sets the size and position of the template.  If clipBoxName is empty, boxName is used.
+func (this *PdfWriter) ImportPageWithClipBox(reader *PdfReader, pageno int, boxName string, clipBoxName string) (int, error) {
 	var err error
 
 	// Set default scale to 1
 	this.k = 1
 
+	// A page that does not exist is an error even in best effort mode
+	if _, err = reader.getPageRef(pageno); err != nil {
+		return -1, err
+	}
+
 	// Get all page boxes
-	pageBoxes, err := reader.getPageBoxes(1, this.k)
+	pageBoxes, err := reader.getPageBoxes(pageno, this.k)
 	if err != nil {
-		return -1, errors.Wrap(err, "Failed to get page boxes")
+		err = errors.Wrap(err, "Failed to get page boxes")
+		if !this.tolerate(reader, pageno, err) {
+			return -1, err
+		}
+		pageBoxes = make(map[string]map[string]float64, 0)
 	}
 
-	// If requested box name does not exist for this page, use an alternate box
-	if _, ok := pageBoxes[boxName]; !ok {
-		if boxName == "/BleedBox" || boxName == "/TrimBox" || boxName == "ArtBox" {
-			boxName = "/CropBox"
-		} else if boxName == "/CropBox" {
-			boxName = "/MediaBox"
+	// If requested box name does not exist for this page, use the box it defaults to
+	requestedBox := boxName
+	boxName, _ = resolveBoxWithFallback(pageBoxes, boxName)
+
+	// If the requested box name or an alternate box name cannot be found, trigger an error
+	if boxName == "" {
+		err = errors.New("Box not found: " + requestedBox)
+		if !this.tolerate(reader, pageno, err) {
+			return -1, err
 		}
+
+		// Use the default page size of US Letter
+		boxName = requestedBox
+		pageBoxes[boxName] = map[string]float64{"x": 0, "y": 0, "w": 612, "h": 792, "llx": 0, "lly": 0, "urx": 612, "ury": 792}
 	}
 
-	// If the requested box name or an alternate box name cannot be found, trigger an error
-	// TODO: Improve error handling
-	if _, ok := pageBoxes[boxName]; !ok {
-		return -1, errors.New("Box not found: " + boxName)
+	if boxName != requestedBox && reader.trace != nil {
+		reader.trace("fallback", fmt.Sprintf("page %d %s uses %s", pageno, requestedBox, boxName))
+	}
+
+	// The box to clip to, if it is not the box that sets the size
+	var clipBox map[string]float64
+	if clipBoxName != "" && clipBoxName != requestedBox {
+		name, box := resolveBoxWithFallback(pageBoxes, clipBoxName)
+		if name == "" {
+			err = errors.New("Clip box not found: " + clipBoxName)
+			if !this.tolerate(reader, pageno, err) {
+				return -1, err
+			}
+		}
+		clipBox = box
 	}
 
 	pageResources, err := reader.getPageResources(pageno)
 	if err != nil {
-		return -1, errors.Wrap(err, "Failed to get page resources")
+		err = errors.Wrap(err, "Failed to get page resources")
+		if !this.tolerate(reader, pageno, err) {
+			return -1, err
+		}
+		pageResources = &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, 0)}
 	}
 
 	content, err := reader.getContent(pageno)
 	if err != nil {
-		return -1, errors.Wrap(err, "Failed to get content")
+		err = errors.Wrap(err, "Failed to get content")
+		if !this.tolerate(reader, pageno, err) {
+			return -1, err
+		}
+		content = ""
+	}
+
+	if this.rewrite_content != nil {
+		rewritten, err := this.rewrite_content(pageno, []byte(content))
+		if err != nil {
+			return -1, errors.Wrap(err, "Failed to rewrite content")
+		}
+		content = string(rewritten)
 	}
 
 	// Set template values
 	tpl := &PdfTemplate{}
+	tpl.Id = len(this.tpls) + this.tpl_id_offset
 	tpl.Reader = reader
 	tpl.Resources = pageResources
 	tpl.Buffer = content
 	tpl.Box = pageBoxes[boxName]
+	tpl.ClipBox = clipBox
 	tpl.Boxes = pageBoxes
 	tpl.X = 0
 	tpl.Y = 0
@@ -164,31 +375,64 @@ func (this *PdfWriter) ImportPage(reader *PdfReader, pageno int, boxName string)
 	tpl.H = tpl.Box["h"]
 
 	// Set template rotation
-	rotation, err := reader.getPageRotation(pageno)
+	angle, err := reader.getNormalizedPageRotation(pageno)
 	if err != nil {
-		return -1, errors.Wrap(err, "Failed to get page rotation")
+		err = errors.Wrap(err, "Failed to get page rotation")
+		if !this.tolerate(reader, pageno, err) {
+			return -1, err
+		}
+		angle = 0
 	}
-	angle := rotation.Int % 360
 
-	// Normalize angle
 	if angle != 0 {
-		steps := angle / 90
-		w := tpl.W
-		h := tpl.H
+		// Swap width and height for pages rotated by 90 or 270 degrees
+		if angle%180 != 0 {
+			tpl.W, tpl.H = tpl.H, tpl.W
+		}
 
-		if steps%2 == 0 {
-			tpl.W = w
-			tpl.H = h
-		} else {
-			tpl.W = h
-			tpl.H = w
+		tpl.Rotation = angle * -1
+	}
+
+	// Collect warnings about features that cannot be fully reproduced
+	tpl.Warnings = reader.getPageWarnings(pageno, this.import_annots)
+
+	maxSize := this.max_page_size
+	if maxSize == 0 {
+		maxSize = defaultMaxPageSize
+	}
+	if maxSize > 0 && (tpl.Box["w"] > maxSize || tpl.Box["h"] > maxSize) {
+		tpl.Warnings = append(tpl.Warnings, fmt.Sprintf("Page %s is %.0f x %.0f units, larger than %.0f; viewers may clip it unless it is scaled down and /UserUnit is set to keep its size", boxName, tpl.Box["w"], tpl.Box["h"], maxSize))
+	}
+
+	if this.import_annots {
+		tpl.Annots, err = reader.getPageAnnots(pageno)
+		if err != nil {
+			err = errors.Wrap(err, "Failed to get page annotations")
+			if !this.tolerate(reader, pageno, err) {
+				return -1, err
+			}
+			tpl.Annots = nil
 		}
+	}
 
-		if angle < 0 {
-			angle += 360
+	if this.flatten_forms {
+		if err = this.flattenForms(reader, tpl, pageno); err != nil {
+			err = errors.Wrap(err, "Failed to flatten form fields")
+			if !this.tolerate(reader, pageno, err) {
+				return -1, err
+			}
 		}
+	}
 
-		tpl.Rotation = angle * -1
+	if this.import_struct {
+		tpl.StructElems, tpl.StructTop, err = reader.getPageStructure(pageno)
+		if err != nil {
+			err = errors.Wrap(err, "Failed to get page structure")
+			if !this.tolerate(reader, pageno, err) {
+				return -1, err
+			}
+			tpl.StructElems, tpl.StructTop = nil, nil
+		}
 	}
 
 	this.tpls = append(this.tpls, tpl)
@@ -197,10 +441,61 @@ func (this *PdfWriter) ImportPage(reader *PdfReader, pageno int, boxName string)
 	return len(this.tpls) - 1, nil
 }
 
+// Import a region (llx, lly, urx, ury in the coordinates of the page, e.g. [0 0 306 396] for the
+// lower left quarter of a letter page) of a page, e.g. to crop a figure out of the page.  The
+// template is sized to the region and clipped to it, and the region is limited to boxName.
+func (this *PdfWriter) ImportPageRegion(reader *PdfReader, pageno int, region [4]float64, boxName string) (int, error) {
+	tplid, err := this.ImportPage(reader, pageno, boxName)
+	if err != nil {
+		return -1, err
+	}
+
+	tpl := this.tpls[tplid]
+	llx := math.Max(math.Min(region[0], region[2]), tpl.Box["llx"])
+	lly := math.Max(math.Min(region[1], region[3]), tpl.Box["lly"])
+	urx := math.Min(math.Max(region[0], region[2]), tpl.Box["urx"])
+	ury := math.Min(math.Max(region[1], region[3]), tpl.Box["ury"])
+	if urx <= llx || ury <= lly {
+		this.tpls = this.tpls[:tplid]
+		return -1, errors.New(fmt.Sprintf("Region [%.2F %.2F %.2F %.2F] is outside of %s", region[0], region[1], region[2], region[3], boxName))
+	}
+
+	tpl.Box = map[string]float64{"x": llx / this.k, "y": lly / this.k, "w": (urx - llx) / this.k, "h": (ury - lly) / this.k,
+		"llx": llx, "lly": lly, "urx": urx, "ury": ury}
+	tpl.ClipBox = nil
+	tpl.W = tpl.Box["w"]
+	tpl.H = tpl.Box["h"]
+	if tpl.Rotation%180 != 0 {
+		tpl.W, tpl.H = tpl.H, tpl.W
+	}
+
+	return tplid, nil
+}
+
+// In best effort mode, record a recoverable problem as a warning of the source document and return
+// true, so that the caller continues with a substitute.  Otherwise return false.
+func (this *PdfWriter) tolerate(reader *PdfReader, pageno int, err error) bool {
+	if !this.best_effort {
+		return false
+	}
+
+	if pageno > 0 {
+		reader.warnings = append(reader.warnings, fmt.Sprintf("Page %d: %s", pageno, err.Error()))
+	} else {
+		reader.warnings = append(reader.warnings, err.Error())
+	}
+
+	return true
+}
+
 // Create a new object and keep track of the offset for the xref table
 func (this *PdfWriter) newObj(objId int, onlyNewObj bool) {
 	if objId < 0 {
-		this.n++
+		if this.alloc_obj_id != nil {
+			this.n = this.alloc_obj_id()
+		} else {
+			this.n++
+		}
 		objId = this.n
 	}
 
@@ -222,14 +517,126 @@ func (this *PdfWriter) newObj(objId int, onlyNewObj bool) {
 func (this *PdfWriter) endObj() {
 	this.out("endobj")
 
-	this.written_objs[this.current_obj.id] = this.current_obj.buffer.Bytes()
+	if this.stream {
+		this.writeObj()
+	} else {
+		this.written_objs[this.current_obj.id] = this.current_obj.buffer.Bytes()
+	}
 	this.current_obj_id = -1
 }
 
-func (this *PdfWriter) shaOfInt(i int) string {
+// Write the current object to the output and keep track of its offset for the xref table
+func (this *PdfWriter) writeObj() {
+	header := fmt.Sprintf("%d 0 obj\n", this.current_obj.id.id)
+
+	this.offsets[this.current_obj.id.id] = this.offset
+	this.offset += len(header) + this.current_obj.buffer.Len()
+
+	this.w.WriteString(header)
+	this.w.Write(this.current_obj.buffer.Bytes())
+
+	// The hash positions are only needed for objects returned by GetImportedObjects
+	delete(this.written_obj_pos, this.current_obj.id)
+}
+
+// Write an xref table and trailer for the objects written to the output set by SetOutput
+func (this *PdfWriter) putXref(root int) error {
+	size := 1
+	for id := range this.offsets {
+		if id >= size {
+			size = id + 1
+		}
+	}
+
+	if this.xref_stream {
+		return this.putXrefStream(root, size)
+	}
+
+	xrefPos := this.offset
+
+	this.w.WriteString(fmt.Sprintf("xref\n0 %d\n", size))
+	this.w.WriteString("0000000000 65535 f \n")
+	for id := 1; id < size; id++ {
+		if offset, ok := this.offsets[id]; ok {
+			this.w.WriteString(fmt.Sprintf("%010d 00000 n \n", offset))
+		} else {
+			this.w.WriteString("0000000000 65535 f \n")
+		}
+	}
+
+	this.w.WriteString(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, root, xrefPos))
+
+	return this.Flush()
+}
+
+// Write a cross-reference stream as object size, for objects 0 to size, and its startxref
+func (this *PdfWriter) putXrefStream(root int, size int) error {
+	xrefPos := this.offset
+
+	// The offset field is as wide as needed for the largest offset, which is that of the stream
+	offsetWidth := 1
+	for n := xrefPos >> 8; n > 0; n >>= 8 {
+		offsetWidth++
+	}
+
+	// Each row is the type (0 = free, 1 = in use), the offset (or next free object) and the generation
+	var rows bytes.Buffer
+	row := func(typ int, offset int, gen int) {
+		rows.WriteByte(byte(typ))
+		for i := offsetWidth - 1; i >= 0; i-- {
+			rows.WriteByte(byte(offset >> uint(8*i)))
+		}
+		rows.WriteByte(byte(gen >> 8))
+		rows.WriteByte(byte(gen))
+	}
+
+	row(0, 0, 65535)
+	for id := 1; id < size; id++ {
+		if offset, ok := this.offsets[id]; ok {
+			row(1, offset, 0)
+		} else {
+			row(0, 0, 65535)
+		}
+	}
+	row(1, xrefPos, 0)
+
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(rows.Bytes())
+	w.Close()
+
+	this.newObj(size, false)
+	this.out(fmt.Sprintf("<< /Type /XRef /Size %d /Root %d 0 R /W [1 %d 2] /Filter /FlateDecode /Length %d >>", size+1, root, offsetWidth, b.Len()))
+	this.out("stream")
+	this.out(b.String())
+	this.out("endstream")
+	this.endObj()
+
+	this.w.WriteString(fmt.Sprintf("startxref\n%d\n%%%%EOF\n", xrefPos))
+
+	return this.Flush()
+}
+
+// The hash of an object id of a source file, which stands in for the id until the objects are
+// renumbered.  This is a variable so that tests can force collisions.
+var hashObjectId = func(id int, sourceFile string) string {
 	hasher := sha1.New()
-	hasher.Write([]byte(fmt.Sprintf("%d-%s", i, this.r.sourceFile)))
-	sha := hex.EncodeToString(hasher.Sum(nil))
+	hasher.Write([]byte(fmt.Sprintf("%d-%s", id, sourceFile)))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+func (this *PdfWriter) shaOfInt(i int) string {
+	sha := hashObjectId(i, this.r.sourceFile)
+
+	// A hash that two objects share would make their references indistinguishable
+	if id, ok := this.hash_ids[sha]; ok && id != i {
+		if this.hash_err == nil {
+			this.hash_err = errors.New(fmt.Sprintf("Objects %d and %d have the same hash %s", id, i, sha))
+		}
+	} else {
+		this.hash_ids[sha] = i
+	}
+
 	return sha
 }
 
@@ -247,6 +654,146 @@ func (this *PdfWriter) outObjRef(objId int) {
 	this.current_obj.buffer.WriteString(" 0 R ")
 }
 
+// Put a referenced object on the object stack (unless it is already there) and get its new object id
+func (this *PdfWriter) queueObj(value *PdfValue) int {
+	// Check to see if object already exists on the don_obj_stack.
+	if _, ok := this.don_obj_stack[value.Id]; !ok {
+		this.newObj(-1, true)
+		this.obj_stack[value.Id] = &PdfValue{Type: PDF_TYPE_OBJREF, Gen: value.Gen, Id: value.Id, NewId: this.n}
+		this.don_obj_stack[value.Id] = &PdfValue{Type: PDF_TYPE_OBJREF, Gen: value.Gen, Id: value.Id, NewId: this.n}
+	}
+
+	// Get object ID from don_obj_stack
+	return this.don_obj_stack[value.Id].NewId
+}
+
+// Put the annotations of a template on the object stack, so they are written with the
+// template's other dependencies (including their /AP appearance streams)
+func (this *PdfWriter) queueAnnots(reader *PdfReader, tpl *PdfTemplate) error {
+	tpl.AnnotObjIds = make([]*PdfObjectId, 0)
+
+	// The annotations are transformed from source page coordinates like the template
+	matrix := this.templateMatrix(tpl)
+	if tpl.Placement != nil {
+		matrix = multiplyMatrix(matrix, *tpl.Placement)
+	}
+
+	for _, annot := range tpl.Annots {
+		// Annotations must be indirect objects
+		if annot.Type != PDF_TYPE_OBJREF {
+			continue
+		}
+
+		// A popup annotation is also written as an annotation, so that its /P is removed
+		dict, err := reader.resolveValue(annot)
+		if err != nil {
+			// In best effort mode, leave out annotations that cannot be resolved
+			err = errors.Wrap(err, "Failed to resolve annotation")
+			if this.tolerate(reader, 0, err) {
+				continue
+			}
+			return err
+		}
+
+		this.annot_ids[annot.Id] = true
+		this.annot_matrix[annot.Id] = matrix
+
+		if popup, ok := dict.Dictionary["/Popup"]; ok && popup.Type == PDF_TYPE_OBJREF {
+			this.annot_ids[popup.Id] = true
+			this.annot_matrix[popup.Id] = matrix
+		}
+
+		objId := this.queueObj(annot)
+		tpl.AnnotObjIds = append(tpl.AnnotObjIds, &PdfObjectId{id: objId, hash: this.shaOfInt(objId)})
+	}
+
+	return nil
+}
+
+// Put the top structure elements of a template on the object stack.  The other elements are written
+// as they are referenced by their parents.
+func (this *PdfWriter) queueStructure(tpl *PdfTemplate) {
+	tpl.StructObjIds = make([]*PdfObjectId, 0)
+
+	for id, elem := range tpl.StructElems {
+		this.struct_elems[id] = elem
+	}
+
+	for _, ref := range tpl.StructTop {
+		objId := this.queueObj(ref)
+		tpl.StructObjIds = append(tpl.StructObjIds, &PdfObjectId{id: objId, hash: this.shaOfInt(objId)})
+	}
+}
+
+// Get a copy of an annotation without references to the source page and form field tree,
+// which would otherwise import the whole source document
+func stripAnnot(annot *PdfValue) *PdfValue {
+	if annot.Type != PDF_TYPE_DICTIONARY {
+		return annot
+	}
+
+	result := &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, len(annot.Dictionary))}
+	for k, v := range annot.Dictionary {
+		result.Dictionary[k] = v
+	}
+
+	delete(result.Dictionary, "/P")
+
+	// The /Parent of a popup is the annotation it belongs to, which is imported as well
+	if subtype, ok := result.Dictionary["/Subtype"]; !ok || subtype.Token != "/Popup" {
+		delete(result.Dictionary, "/Parent")
+	}
+
+	return result
+}
+
+// Get a copy of an annotation with its /Rect and /QuadPoints transformed by a matrix, scaling
+// them like the /BBox of templates.  The appearance stream is not transformed, so the appearance
+// of an annotation on a rotated page is not rotated.
+func (this *PdfWriter) transformAnnot(reader *PdfReader, annot *PdfValue, matrix [6]float64) *PdfValue {
+	if annot.Type != PDF_TYPE_DICTIONARY || (this.k == 1 && matrix == [6]float64{1, 0, 0, 1, 0, 0}) {
+		return annot
+	}
+
+	result := &PdfValue{Type: PDF_TYPE_DICTIONARY, Dictionary: make(map[string]*PdfValue, len(annot.Dictionary))}
+	for k, v := range annot.Dictionary {
+		result.Dictionary[k] = v
+	}
+
+	transform := func(x float64, y float64) (float64, float64) {
+		x, y = x*this.k, y*this.k
+		return matrix[0]*x + matrix[2]*y + matrix[4], matrix[1]*x + matrix[3]*y + matrix[5]
+	}
+
+	if rect, err := reader.getNumbers(annot.Dictionary["/Rect"], 4); err == nil {
+		// The transformed corners are normalized, so that the rectangle is lower left to upper right
+		x1, y1 := transform(rect[0], rect[1])
+		x2, y2 := transform(rect[2], rect[3])
+		result.Dictionary["/Rect"] = realArray([]float64{math.Min(x1, x2), math.Min(y1, y2), math.Max(x1, x2), math.Max(y1, y2)})
+	}
+
+	if quad := annot.Dictionary["/QuadPoints"]; quad != nil && quad.Type == PDF_TYPE_ARRAY && len(quad.Array)%2 == 0 {
+		if points, err := reader.getNumbers(quad, len(quad.Array)); err == nil {
+			for i := 0; i < len(points); i += 2 {
+				points[i], points[i+1] = transform(points[i], points[i+1])
+			}
+			result.Dictionary["/QuadPoints"] = realArray(points)
+		}
+	}
+
+	return result
+}
+
+// Get an array of real numbers
+func realArray(numbers []float64) *PdfValue {
+	array := &PdfValue{Type: PDF_TYPE_ARRAY, Array: make([]*PdfValue, len(numbers))}
+	for i, n := range numbers {
+		array.Array[i] = &PdfValue{Type: PDF_TYPE_REAL, Real: n}
+	}
+
+	return array
+}
+
 // Output PDF data with a newline
 func (this *PdfWriter) out(s string) {
 	this.current_obj.buffer.WriteString(s)
@@ -291,16 +838,14 @@ func (this *PdfWriter) writeValue(value *PdfValue) {
 		break
 
 	case PDF_TYPE_OBJREF:
-		// An indirect object reference.  Fill the object stack if needed.
-		// Check to see if object already exists on the don_obj_stack.
-		if _, ok := this.don_obj_stack[value.Id]; !ok {
-			this.newObj(-1, true)
-			this.obj_stack[value.Id] = &PdfValue{Type: PDF_TYPE_OBJREF, Gen: value.Gen, Id: value.Id, NewId: this.n}
-			this.don_obj_stack[value.Id] = &PdfValue{Type: PDF_TYPE_OBJREF, Gen: value.Gen, Id: value.Id, NewId: this.n}
+		// Keep the reference of the source document, see GetRawObject
+		if this.keep_refs {
+			this.straightOut(fmt.Sprintf("%d %d R ", value.Id, value.Gen))
+			break
 		}
 
-		// Get object ID from don_obj_stack
-		objId := this.don_obj_stack[value.Id].NewId
+		// An indirect object reference.  Fill the object stack if needed.
+		objId := this.queueObj(value)
 		this.outObjRef(objId)
 		//this.out(fmt.Sprintf("%d 0 R", objId))
 		break
@@ -312,6 +857,8 @@ func (this *PdfWriter) writeValue(value *PdfValue) {
 
 	case PDF_TYPE_STREAM:
 		// A stream.  First, output the stream dictionary, then the stream data itself.
+		// The data is written exactly as it was read, without decoding, so image streams using filters
+		// that gofpdi cannot decode (e.g. /JBIG2Decode, /CCITTFaxDecode) pass through byte for byte.
 		this.writeValue(value.Value)
 		this.out("stream")
 		this.out(string(value.Stream.Bytes))
@@ -357,6 +904,11 @@ func (this *PdfWriter) PutFormXobjects(reader *PdfReader) (map[string]*PdfObject
 		if tpl == nil {
 			return nil, errors.New("Template is nil")
 		}
+
+		// Skip templates that have already been written and released
+		if tpl.released {
+			continue
+		}
 		var p string
 		if compress {
 			var b bytes.Buffer
@@ -380,53 +932,22 @@ func (this *PdfWriter) PutFormXobjects(reader *PdfReader) (map[string]*PdfObject
 		pdfObjId := new(PdfObjectId)
 		pdfObjId.id = cN
 		pdfObjId.hash = this.shaOfInt(cN)
-		result[fmt.Sprintf("/GOFPDITPL%d", i+this.tpl_id_offset)] = pdfObjId
+		result[this.tplName(tpl)] = pdfObjId
 
 		this.out("<<" + filter + "/Type /XObject")
 		this.out("/Subtype /Form")
 		this.out("/FormType 1")
 
-		this.out(fmt.Sprintf("/BBox [%.2F %.2F %.2F %.2F]", tpl.Box["llx"]*this.k, tpl.Box["lly"]*this.k, (tpl.Box["urx"]+tpl.X)*this.k, (tpl.Box["ury"]-tpl.Y)*this.k))
-
-		var c, s, tx, ty float64
-		c = 1
-
-		// Handle rotated pages
-		if tpl.Box != nil {
-			tx = -tpl.Box["llx"]
-			ty = -tpl.Box["lly"]
-
-			if tpl.Rotation != 0 {
-				angle := float64(tpl.Rotation) * math.Pi / 180.0
-				c = math.Cos(float64(angle))
-				s = math.Sin(float64(angle))
-
-				switch tpl.Rotation {
-				case -90:
-					tx = -tpl.Box["lly"]
-					ty = tpl.Box["urx"]
-					break
-
-				case -180:
-					tx = tpl.Box["urx"]
-					ty = tpl.Box["ury"]
-					break
+		// The /BBox is in source page coordinates, so it clips the content to the selected box.
+		// The /Matrix rotates the box and moves its lower left corner to the origin, so that boxes
+		// which do not start at (0,0), e.g. a /CropBox offset from the /MediaBox, are placed correctly.
+		clip := tpl.clipBox()
+		this.out(fmt.Sprintf("/BBox [%.2F %.2F %.2F %.2F]", clip["llx"]*this.k, clip["lly"]*this.k, clip["urx"]*this.k, clip["ury"]*this.k))
 
-				case -270:
-					tx = tpl.Box["ury"]
-					ty = -tpl.Box["llx"]
-				}
-			}
-		} else {
-			tx = -tpl.Box["x"] * 2
-			ty = tpl.Box["y"] * 2
-		}
-
-		tx *= this.k
-		ty *= this.k
+		matrix := this.templateMatrix(tpl)
 
-		if c != 1 || s != 0 || tx != 0 || ty != 0 {
-			this.out(fmt.Sprintf("/Matrix [%.5F %.5F %.5F %.5F %.5F %.5F]", c, s, -s, c, tx, ty))
+		if matrix != [6]float64{1, 0, 0, 1, 0, 0} {
+			this.out(fmt.Sprintf("/Matrix [%.5F %.5F %.5F %.5F %.5F %.5F]", matrix[0], matrix[1], matrix[2], matrix[3], matrix[4], matrix[5]))
 		}
 
 		// Now write resources
@@ -451,6 +972,12 @@ func (this *PdfWriter) PutFormXobjects(reader *PdfReader) (map[string]*PdfObject
 
 		this.n = nN // reset to new "n"
 
+		if err = this.queueAnnots(reader, tpl); err != nil {
+			return nil, errors.Wrap(err, "Failed to import annotations")
+		}
+
+		this.queueStructure(tpl)
+
 		// Put imported objects, starting with the ones from the XObject's Resources,
 		// then from dependencies of those resources).
 		err = this.putImportedObjects(reader)
@@ -459,22 +986,231 @@ func (this *PdfWriter) PutFormXobjects(reader *PdfReader) (map[string]*PdfObject
 		}
 	}
 
+	if this.hash_err != nil {
+		return nil, this.hash_err
+	}
+
 	return result, nil
 }
 
+// Get the content of a template as operators that can be inlined in a page content stream, instead
+// of placing the template as a form xobject, and its resources dictionary.  The content sets the
+// same matrix and clipping path as the form xobject, enclosed in q/Q.  The objects the resources
+// depend on are written as imported objects.  Annotations are not imported.
+func (this *PdfWriter) GetTemplateContent(reader *PdfReader, tplid int) ([]byte, []byte, error) {
+	// Set current reader
+	this.r = reader
+
+	if tplid < 0 || tplid >= len(this.tpls) {
+		return nil, nil, errors.New(fmt.Sprintf("Template %d not found", tplid))
+	}
+
+	tpl := this.tpls[tplid]
+	if tpl == nil || tpl.released {
+		return nil, nil, errors.New("Template is nil or already released")
+	}
+	if tpl.Resources == nil {
+		return nil, nil, errors.New("Template resources are empty")
+	}
+
+	matrix := this.templateMatrix(tpl)
+
+	var content bytes.Buffer
+	content.WriteString("q\n")
+	if matrix != [6]float64{1, 0, 0, 1, 0, 0} {
+		content.WriteString(fmt.Sprintf("%.5F %.5F %.5F %.5F %.5F %.5F cm\n", matrix[0], matrix[1], matrix[2], matrix[3], matrix[4], matrix[5]))
+	}
+
+	// Clip to the box, like the /BBox of the form xobject
+	clip := tpl.clipBox()
+	llx, lly := clip["llx"]*this.k, clip["lly"]*this.k
+	urx, ury := clip["urx"]*this.k, clip["ury"]*this.k
+	content.WriteString(fmt.Sprintf("%.2F %.2F %.2F %.2F re W n\n", llx, lly, urx-llx, ury-lly))
+
+	content.WriteString(tpl.Buffer)
+	content.WriteString("\nQ\n")
+
+	resources, err := this.writeDirectValue(reader, tpl.Resources)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return content.Bytes(), resources, nil
+}
+
+// Merge the resources of templates imported from the same reader, to inline their content in one
+// page (see GetTemplateContent).  Colliding names are renamed, see PdfReader.mergeResources for the
+// returned renames, which must be applied to the content of the templates.  The objects the
+// resources depend on are written as imported objects.
+func (this *PdfWriter) MergeTemplateResources(reader *PdfReader, tplids []int) ([]byte, []map[string]map[string]string, error) {
+	// Set current reader
+	this.r = reader
+
+	resources := make([]*PdfValue, len(tplids))
+	for i, tplid := range tplids {
+		if tplid < 0 || tplid >= len(this.tpls) {
+			return nil, nil, errors.New(fmt.Sprintf("Template %d not found", tplid))
+		}
+
+		tpl := this.tpls[tplid]
+		if tpl == nil || tpl.released || tpl.Resources == nil {
+			return nil, nil, errors.New(fmt.Sprintf("Template %d has no resources or is already released", tplid))
+		}
+		resources[i] = tpl.Resources
+	}
+
+	merged, renamed, err := reader.mergeResources(resources)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to merge resources")
+	}
+
+	result, err := this.writeDirectValue(reader, merged)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, renamed, nil
+}
+
+// Get an object of the source document, serialized like an imported object, for debugging and
+// custom extraction.  References to other objects are kept as they are (e.g. 5 0 R), so nothing
+// else is imported.  Streams are written with their data as stored, without decoding.
+func (this *PdfWriter) GetRawObject(reader *PdfReader, id int, gen int) ([]byte, error) {
+	obj, err := reader.resolveObject(&PdfValue{Type: PDF_TYPE_OBJREF, Id: id, Gen: gen})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Failed to resolve object %d %d", id, gen))
+	}
+
+	value := obj.Value
+	if obj.Type == PDF_TYPE_STREAM {
+		value = obj
+	}
+	if value == nil {
+		return nil, errors.New(fmt.Sprintf("Object %d %d has no value", id, gen))
+	}
+
+	this.r = reader
+	this.keep_refs = true
+	defer func() { this.keep_refs = false }()
+
+	this.current_obj = new(PdfObject)
+	this.current_obj.buffer = new(bytes.Buffer)
+	this.current_obj.id = new(PdfObjectId)
+
+	this.writeValue(value)
+	this.current_obj_id = -1
+
+	return bytes.TrimSpace(this.current_obj.buffer.Bytes()), nil
+}
+
+// Write a value to a temporary object, which is not output itself, and return it.  The objects it
+// references are written as imported objects.
+func (this *PdfWriter) writeDirectValue(reader *PdfReader, value *PdfValue) ([]byte, error) {
+	this.current_obj = new(PdfObject)
+	this.current_obj.buffer = new(bytes.Buffer)
+	this.current_obj.id = new(PdfObjectId)
+	this.written_obj_pos[this.current_obj.id] = make(map[int]string, 0)
+
+	this.writeValue(value)
+	result := this.current_obj.buffer.Bytes()
+
+	delete(this.written_obj_pos, this.current_obj.id)
+	this.current_obj_id = -1
+
+	err := this.putImportedObjects(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to put imported objects")
+	}
+
+	return bytes.TrimSpace(result), nil
+}
+
+// Get the form matrix of a template, which maps source page coordinates to the template
+func (this *PdfWriter) templateMatrix(tpl *PdfTemplate) [6]float64 {
+	matrix := boxMatrix(tpl.Box, tpl.Rotation)
+	matrix[4] *= this.k
+	matrix[5] *= this.k
+	if tpl.Matrix != nil {
+		matrix = multiplyMatrix(matrix, *tpl.Matrix)
+	}
+
+	// Products of 0 and negative numbers are -0, which would be written as -0.00000
+	for i := range matrix {
+		matrix[i] += 0
+	}
+
+	return matrix
+}
+
+// Get the form matrix that rotates a page box by rotation degrees (0, -90, -180 or -270) and moves
+// the lower left corner of the rotated box to the origin
+func boxMatrix(box map[string]float64, rotation int) [6]float64 {
+	llx, lly, urx, ury := box["llx"], box["lly"], box["urx"], box["ury"]
+
+	switch rotation {
+	case -90:
+		// (x, y) -> (y-lly, urx-x)
+		return [6]float64{0, -1, 1, 0, -lly, urx}
+	case -180:
+		// (x, y) -> (urx-x, ury-y)
+		return [6]float64{-1, 0, 0, -1, urx, ury}
+	case -270:
+		// (x, y) -> (ury-y, x-llx)
+		return [6]float64{0, 1, -1, 0, ury, -llx}
+	}
+
+	// (x, y) -> (x-llx, y-lly)
+	return [6]float64{1, 0, 0, 1, -llx, -lly}
+}
+
+// Multiply two transformation matrices (a b c d e f), so that m1 is applied first and then m2
+func multiplyMatrix(m1 [6]float64, m2 [6]float64) [6]float64 {
+	return [6]float64{
+		m1[0]*m2[0] + m1[1]*m2[2],
+		m1[0]*m2[1] + m1[1]*m2[3],
+		m1[2]*m2[0] + m1[3]*m2[2],
+		m1[2]*m2[1] + m1[3]*m2[3],
+		m1[4]*m2[0] + m1[5]*m2[2] + m2[4],
+		m1[4]*m2[1] + m1[5]*m2[3] + m2[5],
+	}
+}
+
+// Release the content and resources of templates that have been written by PutFormXobjects.
+// Only the template size is kept, which is all that UseTemplate needs.
+func (this *PdfWriter) releaseTemplates() {
+	for _, tpl := range this.tpls {
+		if tpl.N == 0 {
+			continue
+		}
+		tpl.Buffer = ""
+		tpl.Resources = nil
+		tpl.Reader = nil
+		tpl.Annots = nil
+		tpl.StructElems = nil
+		tpl.StructTop = nil
+		tpl.released = true
+	}
+}
+
 func (this *PdfWriter) putImportedObjects(reader *PdfReader) error {
 	var err error
 	var nObj *PdfValue
 
-	// obj_stack will have new items added to it in the inner loop, so do another loop to check for extras
-	// TODO make the order of this the same every time
+	// obj_stack will have new items added to it in the inner loop (e.g. an image's /SMask or a font's
+	// /FontFile), so do another loop to check for extras
 	for {
 		atLeastOne := false
 
-		// FIXME:  How to determine number of objects before this loop?
-		for i := 0; i < 9999; i++ {
-			k := i
-			v := this.obj_stack[i]
+		// Sort object ids so that objects are written in the same order every time.
+		// All ids are checked, not just a fixed range, so that no dependency is left behind.
+		ids := make([]int, 0, len(this.obj_stack))
+		for id := range this.obj_stack {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+
+		for _, k := range ids {
+			v := this.obj_stack[k]
 
 			if v == nil {
 				continue
@@ -484,7 +1220,13 @@ func (this *PdfWriter) putImportedObjects(reader *PdfReader) error {
 
 			nObj, err = reader.resolveObject(v)
 			if err != nil {
-				return errors.Wrap(err, "Unable to resolve object")
+				err = errors.Wrap(err, fmt.Sprintf("Unable to resolve object %d", k))
+				if !this.tolerate(reader, 0, err) {
+					return err
+				}
+
+				// Write a null object, so that references to the object stay valid
+				nObj = &PdfValue{Type: PDF_TYPE_OBJECT, Value: &PdfValue{Type: PDF_TYPE_NULL}}
 			}
 
 			// New object with "NewId" field
@@ -492,6 +1234,10 @@ func (this *PdfWriter) putImportedObjects(reader *PdfReader) error {
 
 			if nObj.Type == PDF_TYPE_STREAM {
 				this.writeValue(nObj)
+			} else if this.annot_ids[k] {
+				this.writeValue(this.transformAnnot(reader, stripAnnot(nObj.Value), this.annot_matrix[k]))
+			} else if elem, ok := this.struct_elems[k]; ok {
+				this.writeValue(elem)
 			} else {
 				this.writeValue(nObj.Value)
 			}
@@ -499,7 +1245,7 @@ func (this *PdfWriter) putImportedObjects(reader *PdfReader) error {
 			this.endObj()
 
 			// Remove from stack
-			this.obj_stack[k] = nil
+			delete(this.obj_stack, k)
 		}
 
 		if !atLeastOne {
@@ -539,6 +1285,59 @@ func (this *PdfWriter) getTemplateSize(tplid int, _w float64, _h float64) map[st
 	return result
 }
 
+// Like UseTemplate, but fit the template into a box (x, y, w, h) with mode, e.g. to fit a page into
+// a cell.  With FIT_COVER, the caller must clip to the box to hide the parts of the template that
+// overflow it.
+func (this *PdfWriter) UseTemplateFit(tplid int, box [4]float64, mode FitMode) (string, float64, float64, float64, float64) {
+	tpl := this.tpls[tplid]
+
+	x, y, w, h := box[0], box[1], box[2], box[3]
+
+	if mode != FIT_STRETCH && tpl.W > 0 && tpl.H > 0 {
+		scale := math.Min(w/tpl.W, h/tpl.H)
+		if mode == FIT_COVER {
+			scale = math.Max(w/tpl.W, h/tpl.H)
+		}
+
+		// Center the scaled template in the box
+		x += (w - tpl.W*scale) / 2
+		y += (h - tpl.H*scale) / 2
+		w = tpl.W * scale
+		h = tpl.H * scale
+	}
+
+	return this.UseTemplate(tplid, x, y, w, h)
+}
+
+// The placement of a template with opacity, see UseTemplateWithOpacity
+type OpacityPlacement struct {
+	Name           string  // Template name, as returned by UseTemplate
+	ScaleX, ScaleY float64 // Scale of the template, as returned by UseTemplate
+	TX, TY         float64 // Translation of the template, as returned by UseTemplate
+	GState         string  // Name of the graphics state (e.g. /GOFPDIGS500) to add to the /ExtGState resources of the page
+	GStateDict     string  // Graphics state dictionary that sets the opacity, to add as GState
+}
+
+// Like UseTemplate, but draw the template with opacity alpha (0 is transparent, 1 is opaque), e.g.
+// for a watermark.  The graphics state that sets the opacity is named after alpha, so that templates
+// with the same opacity can share it.
+func (this *PdfWriter) UseTemplateWithOpacity(tplid int, x float64, y float64, w float64, h float64, alpha float64) OpacityPlacement {
+	alpha = math.Max(0, math.Min(1, alpha))
+
+	var p OpacityPlacement
+	p.Name, p.ScaleX, p.ScaleY, p.TX, p.TY = this.UseTemplate(tplid, x, y, w, h)
+	p.GState = fmt.Sprintf("/GOFPDIGS%d", int(math.Round(alpha*1000)))
+	p.GStateDict = fmt.Sprintf("<< /Type /ExtGState /ca %.3F /CA %.3F >>", alpha, alpha)
+
+	return p
+}
+
+// Get the content operators that draw the template with its opacity on a page of height pageHeight
+// (in points), enclosed in q/Q
+func (this OpacityPlacement) Content(pageHeight float64) string {
+	return fmt.Sprintf("q %s gs %.4F 0 0 %.4F %.4F %.4F cm %s Do Q", this.GState, this.ScaleX, this.ScaleY, this.TX, pageHeight+this.TY, this.Name)
+}
+
 func (this *PdfWriter) UseTemplate(tplid int, _x float64, _y float64, _w float64, _h float64) (string, float64, float64, float64, float64) {
 	tpl := this.tpls[tplid]
 
@@ -548,7 +1347,7 @@ func (this *PdfWriter) UseTemplate(tplid int, _x float64, _y float64, _w float64
 	_x += tpl.X
 	_y += tpl.Y
 
-	wh := this.getTemplateSize(0, _w, _h)
+	wh := this.getTemplateSize(tplid, _w, _h)
 
 	_w = wh["w"]
 	_h = wh["h"]
@@ -564,5 +1363,5 @@ func (this *PdfWriter) UseTemplate(tplid int, _x float64, _y float64, _w float64
 	tData["ty"] = (0 - _y - _h)
 	tData["lty"] = (0 - _y - _h) - (0-h)*(_h/h)
 
-	return fmt.Sprintf("/GOFPDITPL%d", tplid+this.tpl_id_offset), tData["scaleX"], tData["scaleY"], tData["tx"] * this.k, tData["ty"] * this.k
+	return this.tplName(tpl), tData["scaleX"], tData["scaleY"], tData["tx"] * this.k, tData["ty"] * this.k
 }
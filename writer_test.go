@@ -0,0 +1,252 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHashCollision(t *testing.T) {
+	// Calls that put the form xobjects of an importer and return their error or panic
+	put := func(fn func(importer *Importer)) func(importer *Importer) error {
+		return func(importer *Importer) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%v", r)
+				}
+			}()
+			fn(importer)
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name string
+		put  func(importer *Importer) error
+	}{
+		{"PutFormXobjects", put(func(importer *Importer) {
+			importer.PutFormXobjects()
+			importer.GetImportedObjects()
+		})},
+		{"PutFormXobjectsUnordered", put(func(importer *Importer) {
+			importer.PutFormXobjectsUnordered()
+			importer.GetImportedObjectsUnordered()
+		})},
+		{"PutFormXobjectsWithIds", func(importer *Importer) error {
+			_, _, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The form xobject references its font, so there are two objects
+			importer := newTestImporter(t, buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET")))
+			importer.ImportPage(1, "/MediaBox")
+			if err := test.put(importer); err != nil {
+				t.Fatal(err)
+			}
+
+			defer func(hash func(int, string) string) {
+				hashObjectId = hash
+			}(hashObjectId)
+			hashObjectId = func(int, string) string {
+				return strings.Repeat("0", 40)
+			}
+
+			importer = newTestImporter(t, buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET")))
+			importer.ImportPage(1, "/MediaBox")
+			err := test.put(importer)
+			if err == nil || !strings.Contains(err.Error(), "have the same hash") {
+				t.Errorf("expected a hash collision error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTemplateMatrix(t *testing.T) {
+	matrixRegexp := regexp.MustCompile(`/Matrix \[([^\]]*)\]`)
+
+	tests := []struct {
+		name   string
+		page   string
+		matrix *[6]float64
+		want   string
+	}{
+		{"none", "/MediaBox [0 0 612 792]", nil, ""},
+		{"horizontal flip", "/MediaBox [0 0 612 792]", &[6]float64{-1, 0, 0, 1, 612, 0}, "-1.00000 0.00000 0.00000 1.00000 612.00000 0.00000"},
+		{"vertical flip", "/MediaBox [0 0 612 792]", &[6]float64{1, 0, 0, -1, 0, 792}, "1.00000 0.00000 0.00000 -1.00000 0.00000 792.00000"},
+		{"skew", "/MediaBox [0 0 612 792]", &[6]float64{1, 0, 0.5, 1, 0, 0}, "1.00000 0.00000 0.50000 1.00000 0.00000 0.00000"},
+
+		// The flip is applied after the box is moved to the origin and rotated
+		{"horizontal flip of offset box", "/MediaBox [100 100 712 892]", &[6]float64{-1, 0, 0, 1, 612, 0}, "-1.00000 0.00000 0.00000 1.00000 712.00000 -100.00000"},
+		{"horizontal flip of rotated page", "/MediaBox [0 0 612 792] /Rotate 90", &[6]float64{-1, 0, 0, 1, 792, 0}, "0.00000 -1.00000 -1.00000 0.00000 792.00000 612.00000"},
+		{"identity of rotated page", "/MediaBox [0 0 612 792] /Rotate 90", &[6]float64{1, 0, 0, 1, 0, 0}, "0.00000 -1.00000 1.00000 0.00000 0.00000 612.00000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			objs[10] = strings.Replace(objs[10], "/MediaBox [0 0 612 792]", test.page, 1)
+			importer := newTestImporter(t, buildPdf(objs))
+
+			tplid := importer.ImportPage(1, "/MediaBox")
+			if test.matrix != nil {
+				if err := importer.SetTemplateMatrix(tplid, *test.matrix); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			templates, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 0, 0)
+			form := objects[templates[name]]
+
+			got := ""
+			if m := matrixRegexp.FindSubmatch(form); m != nil {
+				got = string(m[1])
+			}
+			if got != test.want {
+				t.Errorf("got /Matrix [%s], want [%s]", got, test.want)
+			}
+		})
+	}
+}
+
+// Templates of importers with different prefixes have different names in the same output
+func TestTemplateNamePrefix(t *testing.T) {
+	data := buildPdf(pagesPdf("BT /F1 12 Tf (one) Tj ET", "BT /F1 12 Tf (two) Tj ET"))
+
+	tests := []struct {
+		name   string
+		prefix string
+		before bool // Whether the prefix is set before the source
+		want   string
+	}{
+		{"default", "", false, "/GOFPDITPL"},
+		{"prefix before source", "DOCA", true, "/DOCA"},
+		{"prefix after source", "DOCB", false, "/DOCB"},
+	}
+
+	names := make(map[string]string, 0)
+	for _, test := range tests {
+		importer := NewImporter()
+		if test.before {
+			importer.SetTemplateNamePrefix(test.prefix)
+		}
+		if err := importer.setSourceStream("test.pdf", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if test.prefix != "" && !test.before {
+			importer.SetTemplateNamePrefix(test.prefix)
+		}
+
+		for pageno := 1; pageno <= 2; pageno++ {
+			tplid := importer.ImportPage(pageno, "/MediaBox")
+			name, _, _, _, _ := importer.UseTemplate(tplid, 0, 0, 100, 0)
+			if !regexp.MustCompile("^" + test.want + `\d+$`).MatchString(name) {
+				t.Errorf("%s: got template name %s, want %s followed by a number", test.name, name, test.want)
+			}
+			if other, ok := names[name]; ok {
+				t.Errorf("%s: template name %s is also used by %s", test.name, name, other)
+			}
+			names[name] = test.name
+		}
+
+		templates, _, err := importer.PutFormXobjectsWithIds(idCounter(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name := range templates {
+			if names[name] != test.name {
+				t.Errorf("%s: put template %s, which was not used", test.name, name)
+			}
+		}
+	}
+}
+
+// A 600 x 800 template fitted into a box with each fit mode
+func TestUseTemplateFit(t *testing.T) {
+	tests := []struct {
+		name                   string
+		box                    [4]float64
+		mode                   FitMode
+		scaleX, scaleY, tx, ty float64
+	}{
+		{"contain", [4]float64{10, 20, 300, 300}, FIT_CONTAIN, 0.375, 0.375, 47.5, -320},
+		{"contain in a wide box", [4]float64{0, 0, 400, 200}, FIT_CONTAIN, 0.25, 0.25, 125, -200},
+		{"cover", [4]float64{10, 20, 300, 300}, FIT_COVER, 0.5, 0.5, 10, -370},
+		{"stretch", [4]float64{10, 20, 300, 300}, FIT_STRETCH, 0.5, 0.375, 10, -320},
+	}
+
+	objs := pagesPdf("BT ET")
+	objs[10] = strings.Replace(objs[10], "[0 0 612 792]", "[0 0 600 800]", 1)
+	importer := newTestImporter(t, buildPdf(objs))
+	tplid := importer.ImportPage(1, "/MediaBox")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, scaleX, scaleY, tx, ty, err := importer.UseTemplateFit(tplid, test.box, test.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scaleX != test.scaleX || scaleY != test.scaleY || tx != test.tx || ty != test.ty {
+				t.Errorf("got scale %g x %g and translation %g, %g, want scale %g x %g and translation %g, %g", scaleX, scaleY, tx, ty, test.scaleX, test.scaleY, test.tx, test.ty)
+			}
+		})
+	}
+
+	if _, _, _, _, _, err := importer.UseTemplateFit(tplid+1, [4]float64{0, 0, 100, 100}, FIT_CONTAIN); err == nil {
+		t.Error("expected an error for a template that does not exist")
+	}
+}
+
+// A template placed with opacity is drawn in a graphics state that sets the alpha
+func TestUseTemplateWithOpacity(t *testing.T) {
+	tests := []struct {
+		name   string
+		alpha  float64
+		gstate string
+		dict   string
+	}{
+		{"half", 0.5, "/GOFPDIGS500", "<< /Type /ExtGState /ca 0.500 /CA 0.500 >>"},
+		{"watermark", 0.125, "/GOFPDIGS125", "<< /Type /ExtGState /ca 0.125 /CA 0.125 >>"},
+		{"transparent", -1, "/GOFPDIGS0", "<< /Type /ExtGState /ca 0.000 /CA 0.000 >>"},
+		{"opaque", 2, "/GOFPDIGS1000", "<< /Type /ExtGState /ca 1.000 /CA 1.000 >>"},
+	}
+
+	objs := pagesPdf("BT ET")
+	objs[10] = strings.Replace(objs[10], "[0 0 612 792]", "[0 0 600 800]", 1)
+	importer := newTestImporter(t, buildPdf(objs))
+	tplid := importer.ImportPage(1, "/MediaBox")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := importer.UseTemplateWithOpacity(tplid, 10, 20, 300, 400, test.alpha)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.GState != test.gstate || p.GStateDict != test.dict {
+				t.Errorf("got graphics state %s %s, want %s %s", p.GState, p.GStateDict, test.gstate, test.dict)
+			}
+
+			// The template is placed as by UseTemplate, in the graphics state
+			name, scaleX, scaleY, tx, ty := importer.UseTemplate(tplid, 10, 20, 300, 400)
+			if p.Name != name || p.ScaleX != scaleX || p.ScaleY != scaleY || p.TX != tx || p.TY != ty {
+				t.Errorf("got placement %+v, want %s %g %g %g %g", p, name, scaleX, scaleY, tx, ty)
+			}
+			want := "q " + test.gstate + " gs 0.5000 0 0 0.5000 10.0000 380.0000 cm " + name + " Do Q"
+			if content := p.Content(800); content != want {
+				t.Errorf("got content %q, want %q", content, want)
+			}
+		})
+	}
+
+	if _, err := importer.UseTemplateWithOpacity(tplid+1, 0, 0, 100, 100, 0.5); err == nil {
+		t.Error("expected an error for a template that does not exist")
+	}
+}
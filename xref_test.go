@@ -0,0 +1,141 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// An xref table of an incremental update may lead to an xref stream with /Prev, or with /XRefStm in
+// hybrid files
+func TestXrefTableToXrefStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		trailer string
+	}{
+		{"prev", "/Root 1 0 R /Prev %d"},
+		{"hybrid", "/Root 1 0 R /XRefStm %d"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The font is in an object stream of the original file, and the update replaces the content
+			objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+			compressed := map[int]string{3: objs[3]}
+			delete(objs, 3)
+			data := buildObjStmPdf(objs, compressed, "/FlateDecode", deflate)
+			data = appendUpdate(data, map[int]string{11: pdfStream("", "BT /F1 12 Tf (two) Tj ET")}, test.trailer)
+
+			importer := newTestImporter(t, data)
+			if n := importer.GetNumPages(); n != 1 {
+				t.Fatalf("got %d pages, want 1", n)
+			}
+			content, err := importer.GetPageContentStream(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "BT /F1 12 Tf (two) Tj ET" {
+				t.Errorf("got content %q, want the content of the update", content)
+			}
+
+			importer.ImportPage(1, "/MediaBox")
+			_, objects, err := importer.PutFormXobjectsWithIds(idCounter(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			findObject(t, objects, "/BaseFont /Helvetica")
+		})
+	}
+}
+
+// An object defined more than once in one xref table uses its last definition, like an object that is
+// redefined by an incremental update
+func TestDuplicateXrefEntry(t *testing.T) {
+	// Object 20 is a second definition of object 11, which a second subsection points to
+	objs := pagesPdf("BT /F1 12 Tf (one) Tj ET")
+	objs[20] = pdfStream("", "BT /F1 12 Tf (two) Tj ET")
+	data := bytes.Replace(buildPdf(objs), []byte("\n20 0 obj"), []byte("\n11 0 obj"), 1)
+	offset := bytes.LastIndex(data[:bytes.Index(data, []byte("(two)"))], []byte("11 0 obj"))
+	data = bytes.Replace(data, []byte("trailer\n"), []byte(fmt.Sprintf("11 1\n%010d 00000 n \ntrailer\n", offset)), 1)
+
+	warning := fmt.Sprintf("Object 11 is defined more than once in the xref table at offset %d; the last definition is used", bytes.Index(data, []byte("\nxref\n"))+1)
+
+	// The definitions of the table are not used if the object is redefined by an update
+	tests := []struct {
+		name    string
+		update  bool
+		want    string
+		warning bool
+	}{
+		{"last definition", false, "BT /F1 12 Tf (two) Tj ET", true},
+		{"incremental update", true, "BT /F1 12 Tf (three) Tj ET", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := data
+			if test.update {
+				data = appendUpdate(data, map[int]string{11: pdfStream("", "BT /F1 12 Tf (three) Tj ET")}, "/Root 1 0 R /Prev %d")
+			}
+
+			importer := newTestImporter(t, data)
+			content, err := importer.GetPageContentStream(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != test.want {
+				t.Errorf("got content %q, want %q", content, test.want)
+			}
+
+			if strings.Contains(strings.Join(importer.GetWarnings(), "\n"), warning) != test.warning {
+				t.Errorf("got warnings %q, want warning %v", importer.GetWarnings(), test.warning)
+			}
+		})
+	}
+}
+
+// The /Root of the newest trailer is used when the trailers of older sections also have a /Root
+func TestNewestRoot(t *testing.T) {
+	// The update adds a catalog with a page tree of two pages
+	update := pagesPdf("BT /F1 12 Tf (new one) Tj ET", "BT /F1 12 Tf (new two) Tj ET")
+	delete(update, 3)
+	objs := map[int]string{20: strings.Replace(update[1], "2 0 R", "21 0 R", 1), 21: "<< /Type /Pages /Kids [22 0 R 24 0 R] /Count 2 >>"}
+	for id, obj := range update {
+		if id >= 10 {
+			obj = strings.Replace(obj, "/Parent 2 0 R", "/Parent 21 0 R", 1)
+			objs[id+12] = strings.Replace(obj, fmt.Sprintf("/Contents %d 0 R", id+1), fmt.Sprintf("/Contents %d 0 R", id+13), 1)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"xref table", buildPdf(pagesPdf("BT /F1 12 Tf (old) Tj ET"))},
+		{"xref stream", buildObjStmPdf(pagesPdf("BT /F1 12 Tf (old) Tj ET"), nil, "", nil)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := appendUpdate(test.data, objs, "/Root 20 0 R /Prev %d")
+
+			// A later update that keeps the new catalog, and has no /Root
+			data = appendUpdate(data, map[int]string{4: "42"}, "/Prev %d")
+
+			importer := newTestImporter(t, data)
+			if n := importer.GetNumPages(); n != 2 {
+				t.Fatalf("got %d pages, want 2", n)
+			}
+			for pageno, want := range []string{"(new one)", "(new two)"} {
+				content, err := importer.GetPageContentStream(pageno + 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(content), want) {
+					t.Errorf("got content %q of page %d, want %s", content, pageno+1, want)
+				}
+			}
+		})
+	}
+}